@@ -25,26 +25,39 @@ type MCPBridge struct {
 	scanner   *bufio.Scanner
 	mu        sync.Mutex
 	requestID int
-	pending   map[interface{}]chan json.RawMessage
+	pending   map[interface{}]chan MCPResponse
+	
+	// Progress notifications are relayed to every open progress stream
+	progressMu   sync.Mutex
+	progressSubs map[chan json.RawMessage]struct{}
 }
 
 type MCPRequest struct {
 	JSONRPC string                 `json:"jsonrpc"`
-	ID      interface{}            `json:"id"`
+	ID      interface{}            `json:"id,omitempty"`
 	Method  string                 `json:"method"`
-	Params  map[string]interface{} `json:"params"`
+	Params  map[string]interface{} `json:"params,omitempty"`
 }
 
+// MCPResponse is a message from the MCP server: a response, or a
+// notification when Method is set
 type MCPResponse struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      interface{}     `json:"id"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   *MCPError       `json:"error,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
 }
 
 type MCPError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *MCPError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
 }
 
 type APIRequest struct {
@@ -56,6 +69,10 @@ type APIResponse struct {
 	Success bool            `json:"success"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   string          `json:"error,omitempty"`
+	
+	// Data is the structuredContent of a tool result, such as file IDs,
+	// sizes and listings, for callers that want typed values
+	Data json.RawMessage `json:"data,omitempty"`
 }
 
 var upgrader = websocket.Upgrader{
@@ -93,9 +110,14 @@ func NewMCPBridge() (*MCPBridge, error) {
 		stdout:  stdout,
 		stderr:  stderr,
 		scanner: bufio.NewScanner(stdout),
-		pending: make(map[interface{}]chan json.RawMessage),
+		pending: make(map[interface{}]chan MCPResponse),
+		
+		progressSubs: make(map[chan json.RawMessage]struct{}),
 	}
 	
+	// Responses such as read_file results can be megabytes long
+	bridge.scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	
 	// Start reading responses
 	go bridge.readResponses()
 	go bridge.readErrors()
@@ -114,7 +136,14 @@ func (b *MCPBridge) initialize() error {
 		JSONRPC: "2.0",
 		ID:      "init",
 		Method:  "initialize",
-		Params:  map[string]interface{}{},
+		Params: map[string]interface{}{
+			"protocolVersion": "2025-06-18",
+			"capabilities":    map[string]interface{}{},
+			"clientInfo": map[string]interface{}{
+				"name":    "koneksi-mcp-bridge",
+				"version": "1.0.0",
+			},
+		},
 	}
 	
 	resp, err := b.sendRequest(req)
@@ -123,7 +152,24 @@ func (b *MCPBridge) initialize() error {
 	}
 	
 	log.Printf("MCP initialized: %s", resp)
-	return nil
+	
+	// Complete the handshake so the server accepts other requests
+	return b.sendNotification("notifications/initialized", nil)
+}
+
+// sendNotification sends a JSON-RPC notification, which gets no response
+func (b *MCPBridge) sendNotification(method string, params map[string]interface{}) error {
+	data, err := json.Marshal(MCPRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	
+	_, err = b.stdin.Write(append(data, '\n'))
+	return err
 }
 
 func (b *MCPBridge) sendRequest(req MCPRequest) (json.RawMessage, error) {
@@ -134,7 +180,7 @@ func (b *MCPBridge) sendRequest(req MCPRequest) (json.RawMessage, error) {
 	}
 	
 	// Create response channel
-	respChan := make(chan json.RawMessage, 1)
+	respChan := make(chan MCPResponse, 1)
 	b.pending[req.ID] = respChan
 	b.mu.Unlock()
 	
@@ -157,11 +203,20 @@ func (b *MCPBridge) sendRequest(req MCPRequest) (json.RawMessage, error) {
 	// Wait for response with timeout
 	select {
 	case resp := <-respChan:
-		return resp, nil
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
 	case <-time.After(30 * time.Second):
 		b.mu.Lock()
 		delete(b.pending, req.ID)
 		b.mu.Unlock()
+		
+		// Stop the server working on a request nobody is waiting for
+		b.sendNotification("notifications/cancelled", map[string]interface{}{
+			"requestId": req.ID,
+			"reason":    "request timed out in the bridge",
+		})
 		return nil, fmt.Errorf("request timeout")
 	}
 }
@@ -176,18 +231,83 @@ func (b *MCPBridge) readResponses() {
 			continue
 		}
 		
+		if resp.Method != "" {
+			if resp.Method == "notifications/progress" {
+				b.publishProgress(resp.Params)
+			}
+			continue
+		}
+		
 		b.mu.Lock()
 		if ch, ok := b.pending[resp.ID]; ok {
 			delete(b.pending, resp.ID)
 			if resp.Error != nil {
 				log.Printf("MCP error: %v", resp.Error)
-				ch <- nil
-			} else {
-				ch <- resp.Result
 			}
+			ch <- resp
 		}
 		b.mu.Unlock()
 	}
+	
+	if err := b.scanner.Err(); err != nil {
+		log.Printf("Stopped reading MCP responses: %v", err)
+	}
+}
+
+func (b *MCPBridge) publishProgress(params json.RawMessage) {
+	b.progressMu.Lock()
+	defer b.progressMu.Unlock()
+	
+	for ch := range b.progressSubs {
+		// Drop updates for slow listeners rather than stall the MCP reader
+		select {
+		case ch <- params:
+		default:
+		}
+	}
+}
+
+// handleProgress streams the MCP server's progress notifications to the
+// browser as server-sent events. Each event is the notification's params,
+// so clients pick out their own transfers by progressToken.
+func (b *MCPBridge) handleProgress(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	
+	ch := make(chan json.RawMessage, 16)
+	b.progressMu.Lock()
+	b.progressSubs[ch] = struct{}{}
+	b.progressMu.Unlock()
+	defer func() {
+		b.progressMu.Lock()
+		delete(b.progressSubs, ch)
+		b.progressMu.Unlock()
+	}()
+	
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	
+	for {
+		select {
+		case params := <-ch:
+			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", params)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// withProgressToken asks the MCP server for progress notifications on a tool call
+func withProgressToken(params map[string]interface{}, token string) {
+	if token != "" {
+		params["_meta"] = map[string]interface{}{"progressToken": token}
+	}
 }
 
 func (b *MCPBridge) readErrors() {
@@ -239,8 +359,9 @@ func (b *MCPBridge) handleAPIRequest(w http.ResponseWriter, r *http.Request) {
 
 func (b *MCPBridge) handleToolCall(w http.ResponseWriter, r *http.Request) {
 	var toolCall struct {
-		Name      string                 `json:"name"`
-		Arguments map[string]interface{} `json:"arguments"`
+		Name          string                 `json:"name"`
+		Arguments     map[string]interface{} `json:"arguments"`
+		ProgressToken string                 `json:"progressToken"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&toolCall); err != nil {
@@ -270,6 +391,7 @@ func (b *MCPBridge) handleToolCall(w http.ResponseWriter, r *http.Request) {
 			"arguments": string(argsJSON),
 		},
 	}
+	withProgressToken(mcpReq.Params, toolCall.ProgressToken)
 	
 	// Send to MCP server
 	result, err := b.sendRequest(mcpReq)
@@ -281,12 +403,53 @@ func (b *MCPBridge) handleToolCall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Tool failures come back as a result with isError set
+	if msg, failed := toolFailure(result); failed {
+		respondWithJSON(w, http.StatusOK, APIResponse{
+			Success: false,
+			Result:  result,
+			Error:   msg,
+		})
+		return
+	}
+	
 	respondWithJSON(w, http.StatusOK, APIResponse{
 		Success: true,
 		Result:  result,
+		Data:    structuredContent(result),
 	})
 }
 
+// structuredContent returns the typed data of a tools/call result, if any
+func structuredContent(result json.RawMessage) json.RawMessage {
+	var toolResult struct {
+		StructuredContent json.RawMessage `json:"structuredContent"`
+	}
+	if err := json.Unmarshal(result, &toolResult); err != nil {
+		return nil
+	}
+	return toolResult.StructuredContent
+}
+
+// toolFailure reports whether a tools/call result has isError set, along with its text
+func toolFailure(result json.RawMessage) (string, bool) {
+	var toolResult struct {
+		IsError bool `json:"isError"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(result, &toolResult); err != nil || !toolResult.IsError {
+		return "", false
+	}
+	
+	msg := "tool call failed"
+	if len(toolResult.Content) > 0 && toolResult.Content[0].Text != "" {
+		msg = toolResult.Content[0].Text
+	}
+	return msg, true
+}
+
 func (b *MCPBridge) handleListTools(w http.ResponseWriter, r *http.Request) {
 	mcpReq := MCPRequest{
 		JSONRPC: "2.0",
@@ -416,6 +579,7 @@ func (b *MCPBridge) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 			"arguments": string(mustMarshalJSON(args)),
 		},
 	}
+	withProgressToken(mcpReq.Params, r.FormValue("progress_token"))
 
 	// Send to MCP server
 	result, err := b.sendRequest(mcpReq)
@@ -434,6 +598,9 @@ func (b *MCPBridge) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 		"filename": header.Filename,
 		"size":     header.Size,
 	}
+	if data := structuredContent(result); data != nil {
+		response["data"] = data
+	}
 
 	respondWithJSON(w, http.StatusOK, response)
 }
@@ -470,6 +637,7 @@ func main() {
 	router.HandleFunc("/api/v1/mcp/request", bridge.handleAPIRequest).Methods("POST")
 	router.HandleFunc("/api/v1/mcp/tools/list", bridge.handleListTools).Methods("GET")
 	router.HandleFunc("/api/v1/mcp/tools/call", bridge.handleToolCall).Methods("POST")
+	router.HandleFunc("/api/v1/mcp/progress", bridge.handleProgress).Methods("GET")
 	
 	// File upload endpoint
 	router.HandleFunc("/api/v1/upload", bridge.handleFileUpload).Methods("POST")
@@ -512,6 +680,7 @@ func main() {
 	log.Println("  POST /api/v1/mcp/request - Send raw MCP request")
 	log.Println("  GET  /api/v1/mcp/tools/list - List available tools")
 	log.Println("  POST /api/v1/mcp/tools/call - Call a specific tool")
+	log.Println("  GET  /api/v1/mcp/progress - Stream progress of long-running tool calls (SSE)")
 	log.Println("  WS   /ws - WebSocket connection for real-time communication")
 	
 	if err := http.ListenAndServe(":"+port, router); err != nil {
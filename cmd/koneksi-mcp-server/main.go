@@ -1,12 +1,18 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"flag"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/koneksi/mcp-server/internal/index"
 	"github.com/koneksi/mcp-server/internal/koneksi"
 	"github.com/koneksi/mcp-server/internal/mcp"
 )
@@ -17,6 +23,11 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	readOnly := flag.Bool("read-only", envBool("KONEKSI_READ_ONLY"), "Only offer the tools that change nothing")
+	dryRun := flag.Bool("dry-run", envBool("KONEKSI_DRY_RUN"), "Report what tools would store instead of storing it")
+	profile := flag.String("profile", os.Getenv("KONEKSI_PROFILE"), "Tool profile to offer, from KONEKSI_TOOL_PROFILES")
+	flag.Parse()
+
 	// Initialize Koneksi client
 	clientID := os.Getenv("KONEKSI_API_CLIENT_ID")
 	clientSecret := os.Getenv("KONEKSI_API_CLIENT_SECRET")
@@ -36,56 +47,230 @@ func main() {
 	// Create MCP server
 	server := mcp.NewServer("koneksi-storage", "1.0.0", koneksiClient)
 
-	// Setup stdin/stdout communication
-	scanner := bufio.NewScanner(os.Stdin)
-	encoder := json.NewEncoder(os.Stdout)
+	// Browse-only access, or tools that only say what they would do
+	server.SetReadOnly(*readOnly)
+	server.SetDryRun(*dryRun)
+
+	// Team-specific prompt templates
+	if dir := os.Getenv("KONEKSI_PROMPTS_DIR"); dir != "" {
+		if err := server.LoadPrompts(dir); err != nil {
+			log.Fatalf("Failed to load prompts: %v", err)
+		}
+	}
+
+	// Tool calls that need the user's approval, based on the tool annotations
+	if v := os.Getenv("KONEKSI_AUTO_APPROVE"); v != "" {
+		policy, err := mcp.ParseApprovalPolicy(v)
+		if err != nil {
+			log.Fatalf("Invalid KONEKSI_AUTO_APPROVE: %v", err)
+		}
+		server.SetApprovalPolicy(policy)
+	}
+
+	// What uploads do with content that contains secrets
+	if v := os.Getenv("KONEKSI_SECRET_POLICY"); v != "" {
+		policy, err := mcp.ParseSecretPolicy(v)
+		if err != nil {
+			log.Fatalf("Invalid KONEKSI_SECRET_POLICY: %v", err)
+		}
+		server.SetSecretPolicy(policy)
+	}
+
+	if v := os.Getenv("KONEKSI_ON_CONFLICT"); v != "" {
+		action, err := mcp.ParseConflictAction(v)
+		if err != nil {
+			log.Fatalf("Invalid KONEKSI_ON_CONFLICT: %v", err)
+		}
+		server.SetConflictDefault(action)
+	}
 
-	log.Println("Koneksi MCP server started")
+	// Organisation rules for what may be stored, reloaded when the file changes
+	if path := os.Getenv("KONEKSI_UPLOAD_POLICY"); path != "" {
+		if err := server.LoadUploadPolicy(path); err != nil {
+			log.Fatalf("Failed to load the upload policy: %v", err)
+		}
+		go server.WatchUploadPolicy(path, 5*time.Second, make(chan struct{}))
+	}
 
-	// Main message loop
-	for scanner.Scan() {
-		request := scanner.Text()
-		
-		// Parse request to check if it's a notification
-		var req map[string]interface{}
-		if err := json.Unmarshal([]byte(request), &req); err != nil {
-			log.Printf("Error parsing request: %v", err)
-			continue
+	// Local files tools may read and write: the home directory unless
+	// configured otherwise, narrowed down to the client's roots
+	sandbox := mcp.Sandbox{
+		Roots: filepath.SplitList(os.Getenv("KONEKSI_ALLOWED_ROOTS")),
+		Deny:  mcp.DefaultDenyPatterns,
+	}
+	if len(sandbox.Roots) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("Failed to find the home directory, set KONEKSI_ALLOWED_ROOTS: %v", err)
 		}
-		
-		response, err := server.HandleRequest(request)
+		sandbox.Roots = []string{home}
+	}
+	if v, ok := os.LookupEnv("KONEKSI_DENY_PATTERNS"); ok {
+		sandbox.Deny = splitList(v)
+	}
+	if err := server.SetSandbox(sandbox); err != nil {
+		log.Fatalf("Invalid sandbox: %v", err)
+	}
+
+	// Optional full-text index over stored text files
+	if enabled, _ := strconv.ParseBool(os.Getenv("KONEKSI_CONTENT_INDEX")); enabled {
+		idx, err := index.Open(os.Getenv("KONEKSI_INDEX_PATH"))
 		if err != nil {
-			log.Printf("Error handling request: %v", err)
-			
-			// For notifications (no ID), don't send any response
-			if req["id"] == nil {
-				continue
+			log.Fatalf("Failed to open content index: %v", err)
+		}
+
+		interval := 10 * time.Minute
+		if v := os.Getenv("KONEKSI_INDEX_INTERVAL"); v != "" {
+			if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+				log.Fatalf("Invalid KONEKSI_INDEX_INTERVAL: %q", v)
 			}
-			
-			errorResponse := map[string]interface{}{
-				"jsonrpc": "2.0",
-				"id":      req["id"],
-				"error": map[string]interface{}{
-					"code":    -32603,
-					"message": err.Error(),
-				},
+		}
+
+		indexer := index.NewIndexer(koneksiClient, idx)
+		defer indexer.Flush()
+		server.SetIndexer(indexer)
+		go indexer.Run(interval, make(chan struct{}))
+		log.Printf("Content index enabled (%d documents, sync every %s)", idx.Len(), interval)
+	}
+
+	// Tool profiles, loaded once every tool they can name is registered
+	if path := os.Getenv("KONEKSI_TOOL_PROFILES"); path != "" {
+		if err := server.LoadToolProfiles(path); err != nil {
+			log.Fatalf("Failed to load the tool profiles: %v", err)
+		}
+	}
+	if *profile != "" {
+		if err := server.UseProfile(*profile); err != nil {
+			log.Fatalf("Invalid tool profile, check KONEKSI_TOOL_PROFILES: %v", err)
+		}
+	}
+
+	// Poll for remote changes to drive resource subscriptions
+	pollInterval := 30 * time.Second
+	if v := os.Getenv("KONEKSI_POLL_INTERVAL"); v != "" {
+		var err error
+		if pollInterval, err = time.ParseDuration(v); err != nil || pollInterval <= 0 {
+			log.Fatalf("Invalid KONEKSI_POLL_INTERVAL: %q", v)
+		}
+	}
+	go server.WatchResources(pollInterval, make(chan struct{}))
+
+	workers := mcp.DefaultWorkers
+	if v := os.Getenv("KONEKSI_MAX_CONCURRENCY"); v != "" {
+		var err error
+		if workers, err = strconv.Atoi(v); err != nil || workers <= 0 {
+			log.Fatalf("Invalid KONEKSI_MAX_CONCURRENCY: %q", v)
+		}
+	}
+
+	maxMessageSize := mcp.DefaultMaxMessageSize
+	if v := os.Getenv("KONEKSI_MAX_MESSAGE_SIZE"); v != "" {
+		var err error
+		if maxMessageSize, err = strconv.Atoi(v); err != nil || maxMessageSize <= 0 {
+			log.Fatalf("Invalid KONEKSI_MAX_MESSAGE_SIZE: %q", v)
+		}
+	}
+
+	switch transport := os.Getenv("KONEKSI_TRANSPORT"); transport {
+	case "", "stdio":
+		log.Println("Koneksi MCP server started")
+
+		// Requests run concurrently; responses and notifications share stdout
+		opts := mcp.StdioOptions{
+			Workers:        workers,
+			MaxMessageSize: maxMessageSize,
+		}
+		if err := server.ServeStdio(os.Stdin, os.Stdout, opts); err != nil {
+			log.Printf("Error reading stdin: %v", err)
+		}
+	case "http", "sse":
+		addr := os.Getenv("KONEKSI_HTTP_ADDR")
+		if addr == "" {
+			addr = "127.0.0.1:8090"
+		}
+
+		opts := mcp.HTTPOptions{
+			Workers:        workers,
+			MaxMessageSize: maxMessageSize,
+		}
+		if v := os.Getenv("KONEKSI_SESSION_TIMEOUT"); v != "" {
+			var err error
+			if opts.SessionTimeout, err = time.ParseDuration(v); err != nil || opts.SessionTimeout <= 0 {
+				log.Fatalf("Invalid KONEKSI_SESSION_TIMEOUT: %q", v)
+			}
+		}
+		opts.AllowedOrigins = splitList(os.Getenv("KONEKSI_ALLOWED_ORIGINS"))
+
+		mux := http.NewServeMux()
+
+		// OAuth is required unless the server is only reachable from this machine
+		if resource := os.Getenv("KONEKSI_AUTH_RESOURCE"); resource != "" {
+			auth, err := mcp.NewAuthorizer(mcp.AuthOptions{
+				Resource:             resource,
+				AuthorizationServers: splitList(os.Getenv("KONEKSI_AUTH_ISSUERS")),
+				JWKSURL:              os.Getenv("KONEKSI_AUTH_JWKS_URL"),
+				IntrospectionURL:     os.Getenv("KONEKSI_AUTH_INTROSPECTION_URL"),
+				ClientID:             os.Getenv("KONEKSI_AUTH_CLIENT_ID"),
+				ClientSecret:         os.Getenv("KONEKSI_AUTH_CLIENT_SECRET"),
+			})
+			if err != nil {
+				log.Fatalf("Invalid OAuth configuration: %v", err)
 			}
-			
-			encoder.Encode(errorResponse)
-			continue
+			opts.Auth = auth
+			mux.HandleFunc("/.well-known/oauth-protected-resource", auth.ServeMetadata)
+			if path := auth.MetadataPath(); path != "/.well-known/oauth-protected-resource" {
+				mux.HandleFunc(path, auth.ServeMetadata)
+			}
+			log.Printf("OAuth enabled for %s", resource)
+		} else if !isLoopback(addr) {
+			log.Fatalf("Refusing to serve %s without OAuth: set KONEKSI_AUTH_RESOURCE or listen on a loopback address", addr)
 		}
 
-		// Don't send response for notifications
-		if req["id"] == nil {
-			continue
+		if transport == "http" {
+			mux.Handle("/mcp", mcp.NewHTTPHandler(server, opts))
+			log.Printf("Koneksi MCP server listening on http://%s/mcp", addr)
+		} else {
+			// The legacy transport for clients from before Streamable HTTP
+			handler := mcp.NewSSEHandler(server, "/message", opts)
+			mux.Handle("/sse", handler)
+			mux.Handle("/message", handler)
+			log.Printf("Koneksi MCP server listening on http://%s/sse", addr)
 		}
 
-		if err := encoder.Encode(response); err != nil {
-			log.Printf("Error encoding response: %v", err)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Fatalf("HTTP server failed: %v", err)
 		}
+	default:
+		log.Fatalf("Invalid KONEKSI_TRANSPORT: %q", transport)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading stdin: %v", err)
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(v string) []string {
+	var values []string
+	for _, value := range strings.Split(v, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envBool reads a boolean setting, which is false unless set to a true value
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+// isLoopback reports whether addr only accepts connections from this machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
@@ -0,0 +1,357 @@
+// Package backup transforms files for backup to Koneksi storage: gzip
+// compression and password-based encryption.
+//
+// Encrypted backups start with a header:
+//
+//	magic "KNXENC1\n"         8 bytes
+//	PBKDF2 iterations         4 bytes, big endian
+//	salt                      16 bytes
+//	nonce prefix              7 bytes
+//
+// The key is PBKDF2-HMAC-SHA256 of the password and salt. The data follows in
+// chunks of ChunkSize bytes, the last one shorter or empty, each sealed with
+// AES-256-GCM using the header as additional data and the nonce prefix,
+// a 4-byte big-endian chunk counter and a byte that is 1 for the last chunk
+// and 0 otherwise as nonce. Reordered, dropped or truncated chunks fail to
+// decrypt.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// ChunkSize is the number of plaintext bytes in each encrypted chunk
+const ChunkSize = 64 << 10
+
+const (
+	magic      = "KNXENC1\n"
+	saltSize   = 16
+	prefixSize = 7
+	headerSize = len(magic) + 4 + saltSize + prefixSize
+	keySize    = 32
+
+	// maxIterations bounds the work a forged header can ask for
+	maxIterations = 10_000_000
+)
+
+// iterations is the PBKDF2 iteration count of new backups
+var iterations = 600_000
+
+// ErrDecrypt is returned when encrypted data is corrupt, truncated or
+// encrypted with another password
+var ErrDecrypt = errors.New("backup: wrong password or corrupt data")
+
+// Options select how a file is transformed for backup
+type Options struct {
+	Compress bool
+
+	// Password encrypts the backup when not empty
+	Password string
+}
+
+// Extension returns the file name suffix of backups made with these options
+func (o Options) Extension() string {
+	var ext string
+	if o.Compress {
+		ext += ".gz"
+	}
+	if o.Password != "" {
+		ext += ".enc"
+	}
+	return ext
+}
+
+// Write writes the backup of src to dst, compressed and then encrypted as
+// opts say
+func Write(dst io.Writer, src io.Reader, opts Options) error {
+	w := io.WriteCloser(nopCloser{dst})
+
+	if opts.Password != "" {
+		ew, err := NewEncryptWriter(dst, opts.Password)
+		if err != nil {
+			return err
+		}
+		w = ew
+	}
+	closers := []io.Closer{w}
+
+	if opts.Compress {
+		gw := gzip.NewWriter(w)
+		w = gw
+		closers = append([]io.Closer{gw}, closers...)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewReader returns a reader of the original file of a backup made with
+// opts, which is read from r. A wrong password fails here, data corrupted
+// later in the backup fails the read that reaches it.
+func NewReader(r io.Reader, opts Options) (io.Reader, error) {
+	if opts.Password != "" {
+		dr, err := NewDecryptReader(r, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		// The first chunk only decrypts with the right password
+		if err := dr.open(); err != nil {
+			return nil, err
+		}
+		r = dr
+	}
+	if opts.Compress {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("backup: not a compressed backup: %w", err)
+		}
+		r = gr
+	}
+	return r, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// EncryptWriter encrypts what is written to it. Close must be called to
+// write the last chunk; it does not close the underlying writer.
+type EncryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint64
+	buf     []byte
+	closed  bool
+}
+
+// NewEncryptWriter writes the header of an encrypted backup to w and returns
+// a writer that encrypts to it with a key derived from password
+func NewEncryptWriter(w io.Writer, password string) (*EncryptWriter, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], uint32(iterations))
+	if _, err := rand.Read(header[len(magic)+4:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(password, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &EncryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: header[headerSize-prefixSize:],
+		buf:    make([]byte, 0, ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (e *EncryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("backup: write to closed EncryptWriter")
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, as the last
+		// chunk is sealed differently
+		if len(e.buf) == ChunkSize {
+			if err := e.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		free := ChunkSize - len(e.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		e.buf = append(e.buf, p[:free]...)
+		p = p[free:]
+	}
+	return n, nil
+}
+
+// Close seals and writes the last chunk
+func (e *EncryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *EncryptWriter) seal(last bool) error {
+	nonce, err := chunkNonce(e.prefix, e.counter, last)
+	if err != nil {
+		return err
+	}
+	e.counter++
+
+	sealed := e.aead.Seal(e.buf[:0], nonce, e.buf, e.header)
+	e.buf = e.buf[:0]
+	_, err = e.w.Write(sealed)
+	return err
+}
+
+// DecryptReader decrypts an encrypted backup
+type DecryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint64
+	chunk   []byte
+	plain   []byte
+	done    bool
+}
+
+// NewDecryptReader reads the header of an encrypted backup from r and
+// returns a reader of the decrypted data
+func NewDecryptReader(r io.Reader, password string) (*DecryptReader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, errors.New("backup: not an encrypted backup")
+	}
+
+	aead, err := newAEAD(password, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DecryptReader{
+		r:      bufio.NewReaderSize(r, ChunkSize+aead.Overhead()),
+		aead:   aead,
+		header: header,
+		prefix: header[headerSize-prefixSize:],
+		chunk:  make([]byte, ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk
+func (d *DecryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one when nothing follows it
+		if _, err := d.r.Peek(1); err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	nonce, err := chunkNonce(d.prefix, d.counter, d.done)
+	if err != nil {
+		return err
+	}
+	d.counter++
+
+	plain, err := d.aead.Open(d.chunk[:0], nonce, d.chunk[:n], d.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.plain = plain
+	return nil
+}
+
+func newAEAD(password string, header []byte) (cipher.AEAD, error) {
+	rounds := binary.BigEndian.Uint32(header[len(magic):])
+	if rounds == 0 || rounds > maxIterations {
+		return nil, fmt.Errorf("backup: unsupported iteration count %d", rounds)
+	}
+	salt := header[len(magic)+4 : len(magic)+4+saltSize]
+
+	block, err := aes.NewCipher(pbkdf2(sha256.New, []byte(password), salt, int(rounds), keySize))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint64, last bool) ([]byte, error) {
+	if counter > math.MaxUint32 {
+		return nil, errors.New("backup: too much data for one backup")
+	}
+
+	nonce := make([]byte, prefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(counter))
+	if last {
+		nonce[prefixSize+4] = 1
+	}
+	return nonce, nil
+}
+
+// pbkdf2 derives a key from a password as in RFC 8018
+func pbkdf2(h func() hash.Hash, password, salt []byte, rounds, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	size := prf.Size()
+
+	var key []byte
+	u := make([]byte, size)
+	t := make([]byte, size)
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < rounds; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
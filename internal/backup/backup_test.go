@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Key derivation is deliberately slow; the tests only need it correct
+	iterations = 1000
+	os.Exit(m.Run())
+}
+
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		rounds int
+		want   string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2(sha256.New, []byte("password"), []byte("salt"), tt.rounds, 32))
+		if got != tt.want {
+			t.Errorf("pbkdf2 with %d rounds = %s, want %s", tt.rounds, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	random := make([]byte, 3*ChunkSize+17)
+	rand.Read(random)
+
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("hello, backup"),
+		"one chunk":  bytes.Repeat([]byte("a"), ChunkSize),
+		"two chunks": bytes.Repeat([]byte("b"), 2*ChunkSize),
+		"random":     random,
+	}
+	options := []Options{
+		{},
+		{Compress: true},
+		{Password: "s3cret"},
+		{Compress: true, Password: "s3cret"},
+	}
+
+	for name, input := range inputs {
+		for _, opts := range options {
+			var stored bytes.Buffer
+			if err := Write(&stored, bytes.NewReader(input), opts); err != nil {
+				t.Fatalf("%s%s: Write failed: %v", name, opts.Extension(), err)
+			}
+			if opts.Password != "" && bytes.Contains(stored.Bytes(), []byte("hello")) {
+				t.Errorf("%s%s: plaintext visible in the backup", name, opts.Extension())
+			}
+
+			restored, err := restore(&stored, opts)
+			if err != nil {
+				t.Fatalf("%s%s: reading the backup failed: %v", name, opts.Extension(), err)
+			}
+			if !bytes.Equal(restored, input) {
+				t.Errorf("%s%s: read %d bytes, want the original %d", name, opts.Extension(), len(restored), len(input))
+			}
+		}
+	}
+}
+
+func TestEncryptionTampering(t *testing.T) {
+	input := bytes.Repeat([]byte("data"), ChunkSize/2)
+	var stored bytes.Buffer
+	if err := Write(&stored, bytes.NewReader(input), Options{Password: "s3cret"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	encrypted := stored.Bytes()
+
+	chunk := ChunkSize + 16
+	tests := map[string]struct {
+		password string
+		data     []byte
+	}{
+		"wrong password":       {"wrong", encrypted},
+		"flipped bit":          {"s3cret", flip(encrypted, headerSize+10)},
+		"changed header":       {"s3cret", flip(encrypted, headerSize-1)},
+		"dropped last chunk":   {"s3cret", encrypted[:headerSize+chunk]},
+		"truncated last chunk": {"s3cret", encrypted[:len(encrypted)-1]},
+	}
+
+	for name, tt := range tests {
+		_, err := restore(bytes.NewReader(tt.data), Options{Password: tt.password})
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: expected ErrDecrypt, got %v", name, err)
+		}
+	}
+
+	if _, err := restore(bytes.NewReader([]byte("plain text")), Options{Password: "s3cret"}); err == nil {
+		t.Error("Expected data without a header to be refused")
+	}
+	if _, err := restore(bytes.NewReader([]byte("plain text")), Options{Compress: true}); err == nil {
+		t.Error("Expected uncompressed data to be refused")
+	}
+}
+
+// restore reads the original file of a backup
+func restore(r io.Reader, opts Options) ([]byte, error) {
+	original, err := NewReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(original)
+}
+
+func flip(data []byte, i int) []byte {
+	changed := append([]byte(nil), data...)
+	changed[i] ^= 1
+	return changed
+}
+
+func TestExtension(t *testing.T) {
+	tests := map[string]Options{
+		"":        {},
+		".gz":     {Compress: true},
+		".enc":    {Password: "x"},
+		".gz.enc": {Compress: true, Password: "x"},
+	}
+	for want, opts := range tests {
+		if got := opts.Extension(); got != want {
+			t.Errorf("Extension(%+v) = %q, want %q", opts, got, want)
+		}
+	}
+}
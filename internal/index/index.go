@@ -0,0 +1,451 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BM25 tuning parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Maximum number of bytes of a document kept for indexing and snippets
+const MaxDocumentBytes = 1 << 20
+
+type Document struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DirectoryID string `json:"directory_id"`
+	ContentType string `json:"content_type"`
+	Hash        string `json:"hash"`
+	Text        string `json:"text"`
+
+	length int
+}
+
+type Result struct {
+	ID          string
+	Name        string
+	DirectoryID string
+	Score       float64
+	Snippet     string
+}
+
+// Index is an in-memory BM25 inverted index, optionally persisted to a JSON file
+type Index struct {
+	// saveMu makes saves one at a time, so they cannot mix their files
+	saveMu sync.Mutex
+
+	mu       sync.RWMutex
+	path     string
+	docs     map[string]*Document
+	postings map[string]map[string]int
+	totalLen int
+}
+
+func New() *Index {
+	return &Index{
+		docs:     make(map[string]*Document),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// Open loads an index from path, starting empty if the file does not exist yet
+// or cannot be parsed, in which case the next sync rebuilds it. An empty path
+// gives an in-memory index.
+func Open(path string) (*Index, error) {
+	idx := New()
+	if path == "" {
+		return idx, nil
+	}
+	idx.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	var docs []*Document
+	if err := json.Unmarshal(data, &docs); err != nil {
+		log.Printf("Index: %s is corrupt, rebuilding it: %v", path, err)
+		return idx, nil
+	}
+
+	for _, doc := range docs {
+		idx.add(doc)
+	}
+
+	return idx, nil
+}
+
+// Save writes the index to the path it was opened from; in-memory indexes are a no-op
+func (idx *Index) Save() error {
+	if idx.path == "" {
+		return nil
+	}
+
+	idx.saveMu.Lock()
+	defer idx.saveMu.Unlock()
+
+	idx.mu.RLock()
+	docs := make([]*Document, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		docs = append(docs, doc)
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated index
+	tmp, err := os.CreateTemp(filepath.Dir(idx.path), filepath.Base(idx.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), idx.path); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// Add indexes doc, replacing any previous version with the same ID
+func (idx *Index) Add(doc Document) {
+	if len(doc.Text) > MaxDocumentBytes {
+		doc.Text = strings.ToValidUTF8(doc.Text[:MaxDocumentBytes], "")
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(doc.ID)
+	idx.add(&doc)
+}
+
+func (idx *Index) Remove(id string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.remove(id)
+}
+
+// Get returns a copy of the stored document metadata
+func (idx *Index) Get(id string) (Document, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	doc, ok := idx.docs[id]
+	if !ok {
+		return Document{}, false
+	}
+	return *doc, true
+}
+
+func (idx *Index) IDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := make([]string, 0, len(idx.docs))
+	for id := range idx.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Search ranks documents against query with BM25. An empty directoryID searches everything.
+func (idx *Index) Search(query, directoryID string, limit int) []Result {
+	terms := uniqueTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docs))
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(idx.totalLen) / n
+
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for id, tf := range postings {
+			doc := idx.docs[id]
+			if directoryID != "" && doc.DirectoryID != directoryID {
+				continue
+			}
+
+			freq := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(doc.length)/avgLen
+			scores[id] += idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		doc := idx.docs[id]
+		results = append(results, Result{
+			ID:          doc.ID,
+			Name:        doc.Name,
+			DirectoryID: doc.DirectoryID,
+			Score:       score,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	// Only build snippets for the results we actually return
+	for i := range results {
+		results[i].Snippet = Snippet(idx.docs[results[i].ID].Text, terms)
+	}
+
+	return results
+}
+
+func (idx *Index) add(doc *Document) {
+	tokens := Tokenize(doc.Text)
+	doc.length = len(tokens)
+
+	for _, tok := range tokens {
+		postings, ok := idx.postings[tok.Term]
+		if !ok {
+			postings = make(map[string]int)
+			idx.postings[tok.Term] = postings
+		}
+		postings[doc.ID]++
+	}
+
+	idx.docs[doc.ID] = doc
+	idx.totalLen += doc.length
+}
+
+func (idx *Index) remove(id string) bool {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return false
+	}
+
+	for _, tok := range Tokenize(doc.Text) {
+		postings := idx.postings[tok.Term]
+		delete(postings, id)
+		if len(postings) == 0 {
+			delete(idx.postings, tok.Term)
+		}
+	}
+
+	idx.totalLen -= doc.length
+	delete(idx.docs, id)
+	return true
+}
+
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into lower-cased letter/digit runs with their byte offsets
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, Token{Term: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Term: strings.ToLower(text[start:]), Start: start, End: len(text)})
+	}
+
+	return tokens
+}
+
+func uniqueTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, tok := range Tokenize(query) {
+		if !seen[tok.Term] {
+			seen[tok.Term] = true
+			terms = append(terms, tok.Term)
+		}
+	}
+	return terms
+}
+
+// Number of tokens shown around the best match in a snippet
+const snippetTokens = 24
+
+// Snippet returns the passage of text with the most query matches, with matches wrapped in **
+func Snippet(text string, terms []string) string {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	match := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		match[term] = true
+	}
+
+	// Slide a fixed-size window over the tokens and keep the densest one
+	best, bestCount, count := 0, -1, 0
+	for i, tok := range tokens {
+		if match[tok.Term] {
+			count++
+		}
+		if i >= snippetTokens && match[tokens[i-snippetTokens].Term] {
+			count--
+		}
+		start := i - snippetTokens + 1
+		if start < 0 {
+			start = 0
+		}
+		if count > bestCount {
+			best, bestCount = start, count
+		}
+	}
+
+	end := best + snippetTokens
+	if end > len(tokens) {
+		end = len(tokens)
+	}
+
+	var b strings.Builder
+	if best > 0 {
+		b.WriteString("…")
+	}
+
+	pos := tokens[best].Start
+	for _, tok := range tokens[best:end] {
+		b.WriteString(text[pos:tok.Start])
+		if match[tok.Term] {
+			b.WriteString("**" + text[tok.Start:tok.End] + "**")
+		} else {
+			b.WriteString(text[tok.Start:tok.End])
+		}
+		pos = tok.End
+	}
+
+	if end < len(tokens) {
+		b.WriteString("…")
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Extensions treated as text regardless of the content type reported by Koneksi
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".log": true, ".csv": true, ".tsv": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true,
+	".xml": true, ".html": true, ".htm": true, ".rst": true, ".adoc": true, ".tex": true,
+	".go": true, ".py": true, ".js": true, ".ts": true, ".java": true, ".rs": true,
+	".c": true, ".h": true, ".cpp": true, ".sh": true, ".sql": true, ".css": true,
+}
+
+// IsText reports whether a file looks like text, by content type or extension
+func IsText(name, contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case strings.HasPrefix(ct, "text/"):
+		return true
+	case ct == "application/json", ct == "application/xml", ct == "application/x-yaml",
+		ct == "application/yaml", ct == "application/javascript", ct == "application/x-sh":
+		return true
+	case strings.HasSuffix(ct, "+json"), strings.HasSuffix(ct, "+xml"):
+		return true
+	}
+
+	return textExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// LooksBinary reports whether content contains NUL bytes or is not valid UTF-8
+func LooksBinary(content []byte) bool {
+	sample := content
+	truncated := false
+	if len(sample) > 8192 {
+		sample = sample[:8192]
+		truncated = true
+	}
+
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == 0 {
+			return true
+		}
+		if r == utf8.RuneError && size == 1 {
+			// A multi-byte rune may have been cut off by the sample boundary
+			if truncated && len(sample)-i < utf8.UTFMax {
+				break
+			}
+			return true
+		}
+		i += size
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Hello, World! Meeting-notes 2024")
+
+	expected := []string{"hello", "world", "meeting", "notes", "2024"}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, term := range expected {
+		if tokens[i].Term != term {
+			t.Errorf("Expected token %d to be %s, got %s", i, term, tokens[i].Term)
+		}
+	}
+
+	if tokens[1].Start != 7 || tokens[1].End != 12 {
+		t.Errorf("Expected offsets 7-12 for 'World', got %d-%d", tokens[1].Start, tokens[1].End)
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	idx := New()
+	idx.Add(Document{ID: "a", Name: "standup.md", DirectoryID: "dir1", Text: "Standup notes: the deployment failed twice. Deployment rollback scheduled."})
+	idx.Add(Document{ID: "b", Name: "retro.md", DirectoryID: "dir1", Text: "Retro: we discussed the deployment pipeline once."})
+	idx.Add(Document{ID: "c", Name: "server.log", DirectoryID: "dir2", Text: "INFO server started on port 8080"})
+
+	results := idx.Search("deployment", "", 10)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].ID != "a" {
+		t.Errorf("Expected the document mentioning deployment twice to rank first, got %s", results[0].ID)
+	}
+	if !strings.Contains(results[0].Snippet, "**deployment**") {
+		t.Errorf("Expected snippet to highlight the match, got %q", results[0].Snippet)
+	}
+
+	if results := idx.Search("deployment", "dir2", 10); len(results) != 0 {
+		t.Errorf("Expected directory filter to exclude all results, got %d", len(results))
+	}
+
+	if results := idx.Search("deployment", "", 1); len(results) != 1 {
+		t.Errorf("Expected limit to cap results at 1, got %d", len(results))
+	}
+
+	if results := idx.Search("   ", "", 10); results != nil {
+		t.Errorf("Expected no results for an empty query, got %v", results)
+	}
+}
+
+func TestIndex_Remove(t *testing.T) {
+	idx := New()
+	idx.Add(Document{ID: "a", Name: "old.txt", Text: "quarterly budget review"})
+
+	if results := idx.Search("budget", "", 10); len(results) != 1 {
+		t.Fatalf("Expected the document in results, got %v", results)
+	}
+	if !idx.Remove("a") {
+		t.Fatal("Expected remove to succeed")
+	}
+	if results := idx.Search("budget", "", 10); len(results) != 0 {
+		t.Errorf("Expected no results after removal, got %d", len(results))
+	}
+	if len(idx.postings) != 0 {
+		t.Errorf("Expected postings to be empty after removal, got %d terms", len(idx.postings))
+	}
+}
+
+func TestIndex_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	idx.Add(Document{ID: "a", Name: "notes.md", Hash: "h1", Text: "kubernetes upgrade plan"})
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	results := reopened.Search("kubernetes", "", 10)
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Expected persisted document to be searchable, got %v", results)
+	}
+
+	// Concurrent saves each write a whole index
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			idx.Add(Document{ID: fmt.Sprintf("doc-%d", i), Name: "notes.md", Text: strings.Repeat("upgrade plan ", 1000)})
+			if err := idx.Save(); err != nil {
+				t.Errorf("Failed to save index: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if reopened, err := Open(path); err != nil || reopened.Len() != 21 {
+		t.Errorf("Expected every document to be saved, got %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected only the index file to be left, found %d files", len(entries))
+	}
+
+	// A corrupt index starts empty, to be rebuilt
+	if err := os.WriteFile(path, []byte(`[{"id":"a","na`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if reopened, err := Open(path); err != nil || reopened.Len() != 0 {
+		t.Errorf("Expected a corrupt index to start empty, got %v", err)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("filler ", 50) + "the needle is here " + strings.Repeat("filler ", 50)
+
+	snippet := Snippet(text, []string{"needle"})
+	if !strings.Contains(snippet, "**needle**") {
+		t.Errorf("Expected snippet to contain highlighted match, got %q", snippet)
+	}
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("Expected snippet to be elided on both sides, got %q", snippet)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    bool
+	}{
+		{"notes.md", "", true},
+		{"data", "application/json", true},
+		{"page", "text/html; charset=utf-8", true},
+		{"photo.jpg", "image/jpeg", false},
+		{"archive.zip", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsText(tt.name, tt.contentType); got != tt.expected {
+			t.Errorf("IsText(%q, %q) = %v, expected %v", tt.name, tt.contentType, got, tt.expected)
+		}
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	if LooksBinary([]byte("plain text, ünïcødé")) {
+		t.Error("Expected UTF-8 text not to look binary")
+	}
+	if !LooksBinary([]byte{0x89, 'P', 'N', 'G', 0x00}) {
+		t.Error("Expected content with NUL bytes to look binary")
+	}
+}
@@ -0,0 +1,234 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+// Default cap on the size of remote files the indexer downloads
+const DefaultMaxFileSize = 4 << 20
+
+// saveDelay is how long uploads are collected before the index is saved, so
+// that a burst of uploads saves it once
+var saveDelay = 2 * time.Second
+
+// Indexer keeps an Index in sync with the text files stored in Koneksi
+type Indexer struct {
+	client      *koneksi.Client
+	index       *Index
+	MaxFileSize int64
+
+	syncMu sync.Mutex
+
+	mu        sync.Mutex
+	lastSync  time.Time
+	skipped   map[string]string
+	saveTimer *time.Timer
+}
+
+func NewIndexer(client *koneksi.Client, idx *Index) *Indexer {
+	return &Indexer{
+		client:      client,
+		index:       idx,
+		MaxFileSize: DefaultMaxFileSize,
+		skipped:     make(map[string]string),
+	}
+}
+
+func (ix *Indexer) Index() *Index {
+	return ix.index
+}
+
+// LastSync returns when the last full sync finished, or the zero time if none has
+func (ix *Indexer) LastSync() time.Time {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.lastSync
+}
+
+// IndexContent indexes freshly uploaded content. It returns false if the file is not text.
+func (ix *Indexer) IndexContent(fileID, name, directoryID, contentType string, content []byte) bool {
+	if fileID == "" || !ix.indexable(name, contentType, int64(len(content))) || LooksBinary(content) {
+		return false
+	}
+
+	ix.index.Add(Document{
+		ID:          fileID,
+		Name:        name,
+		DirectoryID: directoryID,
+		ContentType: contentType,
+		Text:        string(content),
+	})
+	ix.saveLater()
+	return true
+}
+
+func (ix *Indexer) Search(query, directoryID string, limit int) []Result {
+	return ix.index.Search(query, directoryID, limit)
+}
+
+// Sync walks every directory, indexes new or changed text files, picks up
+// renames, and drops files that no longer exist remotely. Koneksi has no
+// delete or rename operations the server could watch, so this is how
+// deletes and renames reach the index.
+func (ix *Indexer) Sync() error {
+	ix.syncMu.Lock()
+	defer ix.syncMu.Unlock()
+
+	directories, err := ix.client.ListDirectories()
+	if err != nil {
+		return fmt.Errorf("failed to list directories: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, dir := range directories {
+		// The root comes first; its files are listed by its alias if the
+		// API leaves out its ID
+		if dir.ID == "" {
+			dir.ID = "root"
+		}
+		files, err := ix.client.GetDirectoryFiles(dir.ID)
+		if err != nil {
+			// Without a complete listing we cannot tell deleted files apart
+			return fmt.Errorf("failed to list files in %s: %w", dir.ID, err)
+		}
+
+		for _, file := range files {
+			if !ix.indexable(file.Name, file.ContentType, file.Size) {
+				continue
+			}
+			seen[file.ID] = true
+
+			// Content indexed on upload has no hash to compare, so it is
+			// indexed again to be sure it is the content stored
+			if doc, ok := ix.index.Get(file.ID); ok && doc.Hash != "" && doc.Hash == file.Hash {
+				if doc.Name != file.Name || doc.DirectoryID != dir.ID {
+					doc.Name = file.Name
+					doc.DirectoryID = dir.ID
+					ix.index.Add(doc)
+				}
+				continue
+			}
+
+			// Don't download the same non-text file again until it changes
+			ix.mu.Lock()
+			skippedHash, skipped := ix.skipped[file.ID]
+			ix.mu.Unlock()
+			if skipped && skippedHash == file.Hash {
+				continue
+			}
+
+			if err := ix.fetch(file, dir.ID); err != nil {
+				log.Printf("Indexer: skipping %s: %v", file.ID, err)
+				ix.mu.Lock()
+				ix.skipped[file.ID] = file.Hash
+				ix.mu.Unlock()
+			}
+		}
+	}
+
+	for _, id := range ix.index.IDs() {
+		if !seen[id] {
+			ix.index.Remove(id)
+		}
+	}
+
+	ix.mu.Lock()
+	ix.lastSync = time.Now()
+	ix.mu.Unlock()
+
+	ix.save()
+	return nil
+}
+
+// Run syncs immediately and then every interval until stop is closed
+func (ix *Indexer) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ix.Sync(); err != nil {
+			log.Printf("Indexer: sync failed: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ix *Indexer) fetch(file koneksi.FileInfo, directoryID string) error {
+	reader, err := ix.client.DownloadFile(file.ID)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, ix.MaxFileSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if int64(len(content)) > ix.MaxFileSize {
+		return fmt.Errorf("file exceeds %d bytes", ix.MaxFileSize)
+	}
+	if LooksBinary(content) {
+		return fmt.Errorf("content is not text")
+	}
+
+	ix.index.Add(Document{
+		ID:          file.ID,
+		Name:        file.Name,
+		DirectoryID: directoryID,
+		ContentType: file.ContentType,
+		Hash:        file.Hash,
+		Text:        string(content),
+	})
+	return nil
+}
+
+func (ix *Indexer) indexable(name, contentType string, size int64) bool {
+	return IsText(name, contentType) && size <= ix.MaxFileSize
+}
+
+// saveLater saves the index after saveDelay, unless a save is already due
+func (ix *Indexer) saveLater() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.saveTimer == nil {
+		ix.saveTimer = time.AfterFunc(saveDelay, ix.save)
+	}
+}
+
+// Flush saves the index now if uploads are waiting to be saved
+func (ix *Indexer) Flush() {
+	ix.mu.Lock()
+	pending := ix.saveTimer != nil && ix.saveTimer.Stop()
+	ix.mu.Unlock()
+
+	if pending {
+		ix.save()
+	}
+}
+
+// save saves the index, including any uploads waiting to be saved
+func (ix *Indexer) save() {
+	ix.mu.Lock()
+	if ix.saveTimer != nil {
+		ix.saveTimer.Stop()
+		ix.saveTimer = nil
+	}
+	ix.mu.Unlock()
+
+	if err := ix.index.Save(); err != nil {
+		log.Printf("Indexer: failed to save index: %v", err)
+	}
+}
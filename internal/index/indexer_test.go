@@ -0,0 +1,169 @@
+package index
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+type mockStorage struct {
+	rootFiles []map[string]interface{}
+	files     []map[string]interface{}
+	contents  map[string]string
+	downloads int
+}
+
+func (m *mockStorage) handler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/directories/root"):
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"directory":      map[string]interface{}{"id": "root", "name": "root"},
+				"subdirectories": []map[string]interface{}{{"id": "docs", "name": "docs"}},
+				"files":          m.rootFiles,
+			},
+		})
+	case strings.HasSuffix(r.URL.Path, "/directories/docs"):
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"files": m.files},
+		})
+	case strings.HasSuffix(r.URL.Path, "/download"):
+		m.downloads++
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/clients/v1/files/"), "/download")
+		w.Write([]byte(m.contents[id]))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestIndexer_Sync(t *testing.T) {
+	storage := &mockStorage{
+		files: []map[string]interface{}{
+			{"id": "f1", "name": "notes.md", "size": 30, "content_type": "text/markdown", "hash": "h1"},
+			{"id": "f2", "name": "photo.jpg", "size": 30, "content_type": "image/jpeg", "hash": "h2"},
+		},
+		contents: map[string]string{
+			"f1": "migration checklist for friday",
+		},
+	}
+	mockServer := httptest.NewServer(http.HandlerFunc(storage.handler))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	indexer := NewIndexer(client, New())
+
+	if err := indexer.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if indexer.LastSync().IsZero() {
+		t.Error("Expected LastSync to be set")
+	}
+
+	results := indexer.Search("migration", "", 10)
+	if len(results) != 1 || results[0].ID != "f1" {
+		t.Fatalf("Expected notes.md to be indexed, got %v", results)
+	}
+	if storage.downloads != 1 {
+		t.Errorf("Expected only the text file to be downloaded, got %d downloads", storage.downloads)
+	}
+
+	// Unchanged files are not downloaded again, renames are picked up
+	storage.files[0]["name"] = "renamed.md"
+	if err := indexer.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if storage.downloads != 1 {
+		t.Errorf("Expected no new downloads for an unchanged file, got %d", storage.downloads)
+	}
+	if results := indexer.Search("migration", "", 10); len(results) != 1 || results[0].Name != "renamed.md" {
+		t.Errorf("Expected rename to be reflected, got %v", results)
+	}
+
+	// Files that disappear remotely are dropped
+	storage.files = storage.files[1:]
+	if err := indexer.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if results := indexer.Search("migration", "", 10); len(results) != 0 {
+		t.Errorf("Expected deleted file to be removed from the index, got %v", results)
+	}
+}
+
+func TestIndexer_IndexContent(t *testing.T) {
+	indexer := NewIndexer(nil, New())
+
+	if !indexer.IndexContent("f1", "todo.txt", "dir1", "", []byte("buy milk")) {
+		t.Error("Expected text content to be indexed")
+	}
+	if indexer.IndexContent("f2", "image.png", "dir1", "", []byte("not really an image")) {
+		t.Error("Expected non-text file names to be skipped")
+	}
+	if indexer.IndexContent("f3", "blob.txt", "dir1", "", []byte{0x00, 0x01, 0x02}) {
+		t.Error("Expected binary content to be skipped")
+	}
+
+	if results := indexer.Search("milk", "dir1", 10); len(results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(results))
+	}
+}
+
+func TestIndexer_SaveUploads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := NewIndexer(nil, idx)
+
+	// Uploads are saved together after a while, or when flushed
+	indexer.IndexContent("f1", "todo.txt", "dir1", "", []byte("buy milk"))
+	indexer.IndexContent("f2", "done.txt", "dir1", "", []byte("bought bread"))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the index not to be saved on every upload, got %v", err)
+	}
+	indexer.Flush()
+	if reopened, err := Open(path); err != nil || reopened.Len() != 2 {
+		t.Errorf("Expected both uploads to be saved, got %v", err)
+	}
+}
+
+func TestIndexer_SyncUploadedContent(t *testing.T) {
+	storage := &mockStorage{
+		rootFiles: []map[string]interface{}{
+			{"id": "f1", "name": "todo.txt", "size": 30, "content_type": "text/plain", "hash": "h1"},
+		},
+		contents: map[string]string{"f1": "buy oat milk"},
+	}
+	mockServer := httptest.NewServer(http.HandlerFunc(storage.handler))
+	defer mockServer.Close()
+
+	indexer := NewIndexer(koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""), New())
+
+	// Indexed on upload to the root, then changed remotely
+	indexer.IndexContent("f1", "todo.txt", "", "", []byte("buy milk"))
+	if err := indexer.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if storage.downloads != 1 {
+		t.Errorf("Expected content without a hash to be indexed again, got %d downloads", storage.downloads)
+	}
+	results := indexer.Search("oat", "", 10)
+	if len(results) != 1 || results[0].DirectoryID != "root" {
+		t.Errorf("Expected the root file to stay indexed with its current content, got %v", results)
+	}
+
+	// Once it has a hash, it is not downloaded again
+	if err := indexer.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if storage.downloads != 1 {
+		t.Errorf("Expected no new download, got %d", storage.downloads)
+	}
+}
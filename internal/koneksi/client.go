@@ -2,6 +2,7 @@ package koneksi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -50,6 +51,77 @@ type FileInfo struct {
 	Hash        string `json:"hash"`
 }
 
+// APIError is returned when the Koneksi API answers with a non-success status
+type APIError struct {
+	Op         string
+	StatusCode int
+	Code       string
+	Message    string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s failed with status %d: %s", e.Op, e.StatusCode, e.Body)
+}
+
+// newAPIError extracts the Koneksi error code and message from a JSON error body when present
+func newAPIError(op string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		Op:         op,
+		StatusCode: statusCode,
+		Body:       string(body),
+	}
+
+	var errResp struct {
+		Code      json.RawMessage `json:"code"`
+		ErrorCode json.RawMessage `json:"error_code"`
+		Message   string          `json:"message"`
+		Error     json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) != nil {
+		return apiErr
+	}
+
+	apiErr.Message = errResp.Message
+	for _, raw := range []json.RawMessage{errResp.Code, errResp.ErrorCode} {
+		if code := rawString(raw); code != "" {
+			apiErr.Code = code
+			break
+		}
+	}
+
+	// Some endpoints nest the details as {"error": {"code": ..., "message": ...}}
+	var nested struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(errResp.Error, &nested) == nil {
+		if apiErr.Code == "" {
+			apiErr.Code = rawString(nested.Code)
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = nested.Message
+		}
+	} else if apiErr.Message == "" {
+		apiErr.Message = rawString(errResp.Error)
+	}
+
+	return apiErr
+}
+
+// rawString renders a JSON string or number as a plain string
+func rawString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
 func NewClient(baseURL, clientID, clientSecret, directoryID string) *Client {
 	return &Client{
 		BaseURL:      baseURL,
@@ -62,7 +134,20 @@ func NewClient(baseURL, clientID, clientSecret, directoryID string) *Client {
 	}
 }
 
+// UploadFile uploads to the client's default directory
 func (c *Client) UploadFile(fileName string, fileData io.Reader, size int64, checksum string) (*FileUploadResponse, error) {
+	return c.UploadFileToDirectory(c.DirectoryID, fileName, fileData, size, checksum)
+}
+
+// UploadFileToDirectory uploads to directoryID, or to the root directory when
+// it is empty. Unlike changing DirectoryID, it is safe for concurrent use.
+func (c *Client) UploadFileToDirectory(directoryID, fileName string, fileData io.Reader, size int64, checksum string) (*FileUploadResponse, error) {
+	return c.UploadFileToDirectoryContext(context.Background(), directoryID, fileName, fileData, size, checksum)
+}
+
+// UploadFileToDirectoryContext is UploadFileToDirectory with a context that
+// aborts the upload when it is cancelled
+func (c *Client) UploadFileToDirectoryContext(ctx context.Context, directoryID, fileName string, fileData io.Reader, size int64, checksum string) (*FileUploadResponse, error) {
 	endpoint := "/api/clients/v1/files"
 
 	// Create multipart form
@@ -86,14 +171,21 @@ func (c *Client) UploadFile(fileName string, fileData io.Reader, size int64, che
 
 	// Create request
 	url := c.BaseURL + endpoint
-	if c.DirectoryID != "" {
-		url += fmt.Sprintf("?directory_id=%s", c.DirectoryID)
+	if directoryID != "" {
+		url += fmt.Sprintf("?directory_id=%s", directoryID)
+	}
+
+	var body io.Reader = &buf
+	contentLength := int64(buf.Len())
+	if progress := progressFrom(ctx); progress != nil {
+		body = &countingReader{r: &buf, total: contentLength, progress: progress}
 	}
 
-	req, err := http.NewRequest("POST", url, &buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = contentLength
 
 	// Set headers
 	req.Header.Set("Client-ID", c.ClientID)
@@ -109,7 +201,7 @@ func (c *Client) UploadFile(fileName string, fileData io.Reader, size int64, che
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("upload", resp.StatusCode, body)
 	}
 
 	// Parse response
@@ -142,26 +234,30 @@ func (c *Client) UploadFile(fileName string, fileData io.Reader, size int64, che
 }
 
 func (c *Client) UploadFileFromBytes(fileName string, fileContent []byte, directoryID string) (*FileUploadResponse, error) {
+	return c.UploadFileFromBytesContext(context.Background(), fileName, fileContent, directoryID)
+}
+
+func (c *Client) UploadFileFromBytesContext(ctx context.Context, fileName string, fileContent []byte, directoryID string) (*FileUploadResponse, error) {
 	// Create a reader from the byte array
 	reader := bytes.NewReader(fileContent)
 	
-	// Save the current directory ID and restore it after
-	originalDirID := c.DirectoryID
-	if directoryID != "" {
-		c.DirectoryID = directoryID
+	if directoryID == "" {
+		directoryID = c.DirectoryID
 	}
-	defer func() {
-		c.DirectoryID = originalDirID
-	}()
 	
-	// Use the existing UploadFile method
-	return c.UploadFile(fileName, reader, int64(len(fileContent)), "")
+	return c.UploadFileToDirectoryContext(ctx, directoryID, fileName, reader, int64(len(fileContent)), "")
 }
 
 func (c *Client) DownloadFile(fileID string) (io.ReadCloser, error) {
+	return c.DownloadFileContext(context.Background(), fileID)
+}
+
+// DownloadFileContext is DownloadFile with a context; cancelling it also stops
+// reads from the returned body
+func (c *Client) DownloadFileContext(ctx context.Context, fileID string) (io.ReadCloser, error) {
 	endpoint := fmt.Sprintf("/api/clients/v1/files/%s/download", fileID)
 	
-	req, err := http.NewRequest("GET", c.BaseURL+endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -177,17 +273,32 @@ func (c *Client) DownloadFile(fileID string) (io.ReadCloser, error) {
 	if resp.StatusCode != http.StatusOK {
 		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("download", resp.StatusCode, body)
+	}
+
+	if progress := progressFrom(ctx); progress != nil {
+		total := resp.ContentLength
+		if total < 0 {
+			total = 0
+		}
+		return countingReadCloser{
+			countingReader: &countingReader{r: resp.Body, total: total, progress: progress},
+			Closer:         resp.Body,
+		}, nil
 	}
 
 	return resp.Body, nil
 }
 
 func (c *Client) ListDirectories() ([]DirectoryInfo, error) {
+	return c.ListDirectoriesContext(context.Background())
+}
+
+func (c *Client) ListDirectoriesContext(ctx context.Context) ([]DirectoryInfo, error) {
 	// Default to root directory
 	endpoint := "/api/clients/v1/directories/root"
 
-	req, err := http.NewRequest("GET", c.BaseURL+endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -204,7 +315,7 @@ func (c *Client) ListDirectories() ([]DirectoryInfo, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("request", resp.StatusCode, body)
 	}
 
 	var apiResp struct {
@@ -264,6 +375,10 @@ func (c *Client) ListDirectories() ([]DirectoryInfo, error) {
 }
 
 func (c *Client) CreateDirectory(name, description string) (*DirectoryResponse, error) {
+	return c.CreateDirectoryContext(context.Background(), name, description)
+}
+
+func (c *Client) CreateDirectoryContext(ctx context.Context, name, description string) (*DirectoryResponse, error) {
 	endpoint := "/api/clients/v1/directories"
 
 	reqBody := map[string]string{
@@ -276,7 +391,7 @@ func (c *Client) CreateDirectory(name, description string) (*DirectoryResponse,
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.BaseURL+endpoint, bytes.NewReader(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+endpoint, bytes.NewReader(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -293,7 +408,7 @@ func (c *Client) CreateDirectory(name, description string) (*DirectoryResponse,
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("request", resp.StatusCode, body)
 	}
 
 	var apiResp struct {
@@ -320,9 +435,13 @@ func (c *Client) CreateDirectory(name, description string) (*DirectoryResponse,
 }
 
 func (c *Client) GetDirectoryFiles(directoryID string) ([]FileInfo, error) {
+	return c.GetDirectoryFilesContext(context.Background(), directoryID)
+}
+
+func (c *Client) GetDirectoryFilesContext(ctx context.Context, directoryID string) ([]FileInfo, error) {
 	endpoint := fmt.Sprintf("/api/clients/v1/directories/%s", directoryID)
 
-	req, err := http.NewRequest("GET", c.BaseURL+endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -338,7 +457,7 @@ func (c *Client) GetDirectoryFiles(directoryID string) ([]FileInfo, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("request", resp.StatusCode, body)
 	}
 
 	var apiResp struct {
@@ -369,4 +488,4 @@ func (c *Client) GetDirectoryFiles(directoryID string) ([]FileInfo, error) {
 	}
 
 	return files, nil
-}
\ No newline at end of file
+}
@@ -1,10 +1,13 @@
 package koneksi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -371,4 +374,143 @@ func TestClient_ErrorHandling(t *testing.T) {
 			t.Error("Expected error for invalid JSON response")
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestClient_APIError(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedCode    string
+		expectedMessage string
+	}{
+		{
+			name:            "flat error body",
+			body:            `{"status":"error","code":"FILE_NOT_FOUND","message":"file does not exist"}`,
+			expectedCode:    "FILE_NOT_FOUND",
+			expectedMessage: "file does not exist",
+		},
+		{
+			name:            "nested error body",
+			body:            `{"error":{"code":4041,"message":"no such file"}}`,
+			expectedCode:    "4041",
+			expectedMessage: "no such file",
+		},
+		{
+			name:            "plain text body",
+			body:            "File not found",
+			expectedCode:    "",
+			expectedMessage: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "test-id", "test-secret", "")
+			_, err := client.DownloadFile("missing")
+
+			apiErr, ok := err.(*APIError)
+			if !ok {
+				t.Fatalf("Expected *APIError, got %T", err)
+			}
+			if apiErr.StatusCode != http.StatusNotFound {
+				t.Errorf("Expected status 404, got %d", apiErr.StatusCode)
+			}
+			if apiErr.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, apiErr.Code)
+			}
+			if apiErr.Message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, apiErr.Message)
+			}
+			if !strings.Contains(err.Error(), "download failed with status 404") {
+				t.Errorf("Unexpected error text: %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body is read
+		io.ReadAll(r.Body)
+		requested <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-id", "test-secret", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+
+	_, err := client.CreateDirectoryContext(ctx, "slow", "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a context.Canceled error, got %v", err)
+	}
+
+	// A directory given explicitly wins over the client's default
+	var query string
+	upload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"file_id": "f"}})
+	}))
+	defer upload.Close()
+
+	client = NewClient(upload.URL, "test-id", "test-secret", "default-dir")
+	if _, err := client.UploadFileToDirectoryContext(context.Background(), "other-dir", "a.txt", strings.NewReader("a"), 1, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if query != "directory_id=other-dir" || client.DirectoryID != "default-dir" {
+		t.Errorf("Expected an upload to other-dir leaving the default alone, got query %q and default %q", query, client.DirectoryID)
+	}
+}
+
+func TestClient_Progress(t *testing.T) {
+	content := strings.Repeat("x", 100<<10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			io.Copy(io.Discard, r.Body)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"file_id": "f"}})
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-id", "test-secret", "")
+
+	var transferred, total int64
+	ctx := WithProgress(context.Background(), func(n, t int64) {
+		transferred, total = n, t
+	})
+
+	if _, err := client.UploadFileFromBytesContext(ctx, "big.txt", []byte(content), ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The multipart body is a little larger than the file itself
+	if total <= int64(len(content)) || transferred != total {
+		t.Errorf("Expected upload progress to reach its total, got %d of %d", transferred, total)
+	}
+
+	transferred, total = 0, 0
+	reader, err := client.DownloadFileContext(ctx, "f")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	io.Copy(io.Discard, reader)
+	reader.Close()
+
+	if transferred != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("Expected download progress of %d bytes, got %d of %d", len(content), transferred, total)
+	}
+}
@@ -0,0 +1,46 @@
+package koneksi
+
+import (
+	"context"
+	"io"
+)
+
+// ProgressFunc is called as an upload or download advances, with the bytes
+// transferred so far and the total, which is 0 when it is not known
+type ProgressFunc func(transferred, total int64)
+
+type progressKey struct{}
+
+// WithProgress returns a context that makes uploads and downloads using it
+// report their progress to fn
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progressFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+// countingReader reports every read through it to a ProgressFunc
+type countingReader struct {
+	r           io.Reader
+	transferred int64
+	total       int64
+	progress    ProgressFunc
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.transferred += int64(n)
+		c.progress(c.transferred, c.total)
+	}
+	return n, err
+}
+
+// countingReadCloser is a countingReader that keeps the Close of the stream it wraps
+type countingReadCloser struct {
+	*countingReader
+	io.Closer
+}
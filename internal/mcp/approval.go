@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// maxApprovalArguments is how much of a call's arguments the user is shown
+// when asked to approve it
+const maxApprovalArguments = 500
+
+// ApprovalPolicy decides, from a tool's annotations, which calls run without
+// the user approving them first. The server asks the user through
+// elicitation; calls that need approval fail for clients that do not
+// support it.
+type ApprovalPolicy int
+
+const (
+	// ApproveAll runs every call, leaving approval entirely to the client
+	ApproveAll ApprovalPolicy = iota
+
+	// ApproveNonDestructive runs calls to tools that only read or add data
+	ApproveNonDestructive
+
+	// ApproveReadOnly runs calls to read-only tools
+	ApproveReadOnly
+
+	// ApproveNone runs no call unless it is approved
+	ApproveNone
+)
+
+// ParseApprovalPolicy parses the name of a policy: all, non-destructive,
+// read-only or none
+func ParseApprovalPolicy(name string) (ApprovalPolicy, error) {
+	switch name {
+	case "", "all":
+		return ApproveAll, nil
+	case "non-destructive":
+		return ApproveNonDestructive, nil
+	case "read-only":
+		return ApproveReadOnly, nil
+	case "none":
+		return ApproveNone, nil
+	default:
+		return ApproveAll, fmt.Errorf("unknown approval policy %q, expected all, non-destructive, read-only or none", name)
+	}
+}
+
+func (p ApprovalPolicy) String() string {
+	switch p {
+	case ApproveNonDestructive:
+		return "non-destructive"
+	case ApproveReadOnly:
+		return "read-only"
+	case ApproveNone:
+		return "none"
+	default:
+		return "all"
+	}
+}
+
+// autoApproves reports whether calls to a tool with these annotations run
+// without approval
+func (p ApprovalPolicy) autoApproves(annotations ToolAnnotations) bool {
+	switch p {
+	case ApproveAll:
+		return true
+	case ApproveNonDestructive:
+		return annotations.ReadOnly || !annotations.Destructive
+	case ApproveReadOnly:
+		return annotations.ReadOnly
+	default:
+		return false
+	}
+}
+
+// SetApprovalPolicy sets which tool calls need the user's approval. The
+// default, ApproveAll, leaves the decision to the client.
+func (s *Server) SetApprovalPolicy(policy ApprovalPolicy) {
+	s.toolMu.Lock()
+	defer s.toolMu.Unlock()
+
+	s.approval = policy
+}
+
+// checkApproval returns an error for a call the approval policy does not let
+// through on its own, unless the user approves it when asked
+func (s *Server) checkApproval(ctx context.Context, info ToolInfo, arguments string) error {
+	s.toolMu.RLock()
+	policy := s.approval
+	s.toolMu.RUnlock()
+
+	if policy.autoApproves(info.Annotations) {
+		return nil
+	}
+
+	sess := s.sessionFrom(ctx)
+	if !sess.supportsElicitation() {
+		return fmt.Errorf("%s needs the user's approval under this server's %s approval policy, and this client cannot ask the user", info.Name, policy)
+	}
+
+	if len(arguments) > maxApprovalArguments {
+		arguments = strings.ToValidUTF8(arguments[:maxApprovalArguments], "") + "..."
+	}
+	content, ok, err := sess.elicit(ctx, fmt.Sprintf("The assistant wants to call %s with %s. Allow it?", info.Name, arguments), map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"approve": map[string]interface{}{
+				"type":    "boolean",
+				"title":   "Allow this call",
+				"default": true,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%s needs the user's approval, and the user could not be asked: %w", info.Name, err)
+	}
+	if !ok || (content.Get("approve").Exists() && !content.Get("approve").Bool()) {
+		return fmt.Errorf("the user did not approve the call to %s", info.Name)
+	}
+	return nil
+}
+
+// annotationsResult is the annotations object of a tool in tools/list
+func annotationsResult(info ToolInfo) map[string]interface{} {
+	annotations := map[string]interface{}{
+		"readOnlyHint":  info.Annotations.ReadOnly,
+		"openWorldHint": info.Annotations.OpenWorld,
+	}
+	if !info.Annotations.ReadOnly {
+		annotations["destructiveHint"] = info.Annotations.Destructive
+		annotations["idempotentHint"] = info.Annotations.Idempotent
+	}
+	if info.Title != "" {
+		annotations["title"] = info.Title
+	}
+	return annotations
+}
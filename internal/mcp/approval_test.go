@@ -0,0 +1,125 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestServer_ToolAnnotations(t *testing.T) {
+	tests := []struct {
+		version     string
+		annotations bool
+		title       bool
+	}{
+		{"2024-11-05", false, false},
+		{"2025-03-26", true, false},
+		{"2025-06-18", true, true},
+	}
+
+	for _, tt := range tests {
+		server := NewServer("test-server", "1.0.0", nil)
+		server.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"` + tt.version + `"}}`)
+
+		response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+		tools := map[string]map[string]interface{}{}
+		for _, tool := range response.(map[string]interface{})["result"].(map[string]interface{})["tools"].([]map[string]interface{}) {
+			tools[tool["name"].(string)] = tool
+			if _, ok := tool["annotations"]; ok != tt.annotations {
+				t.Errorf("%s: expected annotations on %s to be listed: %t", tt.version, tool["name"], tt.annotations)
+			}
+			if _, ok := tool["title"]; ok != tt.title {
+				t.Errorf("%s: expected a title on %s to be listed: %t", tt.version, tool["name"], tt.title)
+			}
+		}
+		if !tt.annotations {
+			continue
+		}
+
+		read := tools["read_file"]["annotations"].(map[string]interface{})
+		if read["title"] != "Read File" || read["readOnlyHint"] != true || read["openWorldHint"] != false {
+			t.Errorf("%s: unexpected read_file annotations %v", tt.version, read)
+		}
+		download := tools["download_file"]["annotations"].(map[string]interface{})
+		if download["readOnlyHint"] != false || download["destructiveHint"] != true || download["idempotentHint"] != true {
+			t.Errorf("%s: unexpected download_file annotations %v", tt.version, download)
+		}
+		upload := tools["upload_file"]["annotations"].(map[string]interface{})
+		if upload["destructiveHint"] != false || upload["idempotentHint"] != false {
+			t.Errorf("%s: unexpected upload_file annotations %v", tt.version, upload)
+		}
+	}
+}
+
+func TestServer_ApprovalPolicy(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+	for _, info := range []ToolInfo{
+		{Name: "reader", Annotations: ToolAnnotations{ReadOnly: true}},
+		{Name: "writer"},
+		{Name: "deleter", Annotations: ToolAnnotations{Destructive: true}},
+	} {
+		if err := server.AddTool(NewTool(info, func(ctx context.Context, args *struct{}) (interface{}, error) {
+			return map[string]interface{}{"content": textContent("ran")}, nil
+		})); err != nil {
+			t.Fatalf("Failed to add %s: %v", info.Name, err)
+		}
+	}
+
+	call := func(name string) string {
+		response, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `"}}`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(t, response)
+	}
+
+	tests := []struct {
+		policy string
+		ran    map[string]bool
+	}{
+		{"all", map[string]bool{"reader": true, "writer": true, "deleter": true}},
+		{"non-destructive", map[string]bool{"reader": true, "writer": true, "deleter": false}},
+		{"read-only", map[string]bool{"reader": true, "writer": false, "deleter": false}},
+		{"none", map[string]bool{"reader": false, "writer": false, "deleter": false}},
+	}
+
+	for _, tt := range tests {
+		policy, err := ParseApprovalPolicy(tt.policy)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		server.SetApprovalPolicy(policy)
+
+		// The client cannot ask the user, so calls that need approval fail
+		for name, ran := range tt.ran {
+			text := call(name)
+			if (text == "ran") != ran {
+				t.Errorf("%s: expected %s to run: %t, got %q", tt.policy, name, ran, text)
+			}
+			if !ran && !strings.Contains(text, "needs the user's approval") {
+				t.Errorf("%s: expected %s to need approval, got %q", tt.policy, name, text)
+			}
+		}
+	}
+
+	// Clients that support elicitation ask the user
+	var asked []string
+	sess := elicitationSession(t, server, []map[string]interface{}{
+		{"action": "accept", "content": map[string]interface{}{"approve": true}},
+		{"action": "accept", "content": map[string]interface{}{"approve": false}},
+		{"action": "decline"},
+	}, &asked)
+	for i, want := range []string{"ran", "the user did not approve the call to deleter", "the user did not approve the call to deleter"} {
+		response := sess.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"deleter","arguments":{}}}`)
+		if text := resultText(t, response); text != want {
+			t.Errorf("Call %d: expected %q, got %q", i, want, text)
+		}
+	}
+	if len(asked) != 3 || !strings.Contains(asked[0], "deleter with {}") {
+		t.Errorf("Expected the user to be asked about each call, got %v", asked)
+	}
+
+	if _, err := ParseApprovalPolicy("sometimes"); err == nil {
+		t.Error("Expected an unknown policy to be refused")
+	}
+}
@@ -0,0 +1,564 @@
+package mcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// Permission is what a request does with Koneksi storage or the server's
+// local files, which decides the OAuth scope needed to make it
+type Permission int
+
+const (
+	PermissionRead Permission = iota
+	PermissionWrite
+	PermissionDelete
+)
+
+// Default scopes for each permission
+const (
+	DefaultReadScope   = "koneksi:read"
+	DefaultWriteScope  = "koneksi:write"
+	DefaultDeleteScope = "koneksi:delete"
+)
+
+// clockSkew is how far token expiry and not-before times may be off
+var clockSkew = 30 * time.Second
+
+// jwksRefreshInterval is the least time between two fetches of the JWKS,
+// which is fetched again when a token is signed with an unknown key
+var jwksRefreshInterval = time.Minute
+
+// errInvalidToken marks token validation failures, which are answered with
+// 401 and error="invalid_token"
+var errInvalidToken = errors.New("invalid token")
+
+func invalidToken(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errInvalidToken, fmt.Sprintf(format, args...))
+}
+
+// AuthOptions configures OAuth 2.1 authorization for the HTTP transports.
+// Tokens are validated as JWTs when JWKSURL is set and through token
+// introspection otherwise.
+type AuthOptions struct {
+	// Resource is the canonical URL of the MCP endpoint, e.g.
+	// https://mcp.example.com/mcp. Tokens must name it as their audience.
+	Resource string
+	// AuthorizationServers are the issuers clients get tokens from. They are
+	// advertised in the protected resource metadata, and JWTs must come from
+	// one of them.
+	AuthorizationServers []string
+	// JWKSURL is where the keys JWTs are signed with are published
+	JWKSURL string
+	// IntrospectionURL is the RFC 7662 token introspection endpoint, and
+	// ClientID and ClientSecret the credentials to call it with
+	IntrospectionURL string
+	ClientID         string
+	ClientSecret     string
+	// ReadScope, WriteScope and DeleteScope are the scopes granting each
+	// permission, DefaultReadScope and so on when empty
+	ReadScope   string
+	WriteScope  string
+	DeleteScope string
+	// HTTPClient fetches keys and introspects tokens, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// AuthInfo is who an authorized request was made by
+type AuthInfo struct {
+	Subject  string
+	ClientID string
+	Scopes   []string
+	Expiry   time.Time
+}
+
+// HasScope reports whether the token was granted scope
+func (info *AuthInfo) HasScope(scope string) bool {
+	for _, granted := range info.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// owner identifies who a session belongs to, so that a session ID alone is
+// not enough to use someone else's session
+func (info *AuthInfo) owner() string {
+	return info.Subject + "\x00" + info.ClientID
+}
+
+// Authorizer validates the bearer tokens sent to the HTTP transports and
+// serves the protected resource metadata (RFC 9728) that tells clients where
+// to get them
+type Authorizer struct {
+	opts   AuthOptions
+	client *http.Client
+
+	keysMu      sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// NewAuthorizer checks opts and creates an Authorizer
+func NewAuthorizer(opts AuthOptions) (*Authorizer, error) {
+	if _, err := url.ParseRequestURI(opts.Resource); err != nil || opts.Resource == "" {
+		return nil, fmt.Errorf("resource must be the URL of the MCP endpoint, got %q", opts.Resource)
+	}
+	if opts.JWKSURL == "" && opts.IntrospectionURL == "" {
+		return nil, errors.New("either a JWKS URL or an introspection URL is needed to validate tokens")
+	}
+	if opts.ReadScope == "" {
+		opts.ReadScope = DefaultReadScope
+	}
+	if opts.WriteScope == "" {
+		opts.WriteScope = DefaultWriteScope
+	}
+	if opts.DeleteScope == "" {
+		opts.DeleteScope = DefaultDeleteScope
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Authorizer{opts: opts, client: client}, nil
+}
+
+// MetadataPath is where the protected resource metadata is served: the
+// resource's path under /.well-known/oauth-protected-resource
+func (a *Authorizer) MetadataPath() string {
+	u, _ := url.Parse(a.opts.Resource)
+	return "/.well-known/oauth-protected-resource" + strings.TrimSuffix(u.Path, "/")
+}
+
+// MetadataURL is the full URL of the protected resource metadata
+func (a *Authorizer) MetadataURL() string {
+	u, _ := url.Parse(a.opts.Resource)
+	return u.Scheme + "://" + u.Host + a.MetadataPath()
+}
+
+// ServeMetadata answers with the protected resource metadata document
+func (a *Authorizer) ServeMetadata(w http.ResponseWriter, r *http.Request) {
+	authorizationServers := a.opts.AuthorizationServers
+	if authorizationServers == nil {
+		authorizationServers = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"resource":                 a.opts.Resource,
+		"authorization_servers":    authorizationServers,
+		"scopes_supported":         []string{a.opts.ReadScope, a.opts.WriteScope, a.opts.DeleteScope},
+		"bearer_methods_supported": []string{"header"},
+	})
+}
+
+// authenticate validates the request's bearer token. A missing or invalid
+// token is answered with 401 and a pointer to the metadata, and nil is
+// returned. Without an Authorizer every request gets through anonymously.
+func (a *Authorizer) authenticate(w http.ResponseWriter, r *http.Request) (*AuthInfo, bool) {
+	if a == nil {
+		return &AuthInfo{}, true
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata=%q`, a.MetadataURL()))
+		writeHTTPError(w, http.StatusUnauthorized, "authorization required: send a bearer token")
+		return nil, false
+	}
+
+	var info *AuthInfo
+	var err error
+	if a.opts.JWKSURL != "" {
+		info, err = a.verifyJWT(r.Context(), token)
+	} else {
+		info, err = a.introspect(r.Context(), token)
+	}
+
+	if errors.Is(err, errInvalidToken) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata=%q, error="invalid_token", error_description=%q`, a.MetadataURL(), err.Error()))
+		writeHTTPError(w, http.StatusUnauthorized, "%v", err)
+		return nil, false
+	}
+	if err != nil {
+		writeHTTPError(w, http.StatusServiceUnavailable, "cannot validate token: %v", err)
+		return nil, false
+	}
+	return info, true
+}
+
+// authorize checks that the token carries the scopes for the permissions a
+// message needs, and answers with 403 naming the missing scopes otherwise
+func (a *Authorizer) authorize(w http.ResponseWriter, info *AuthInfo, permissions []Permission) bool {
+	if a == nil {
+		return true
+	}
+
+	var missing []string
+	for _, permission := range permissions {
+		scope := a.scopeFor(permission)
+		if !info.HasScope(scope) && !containsString(missing, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) == 0 {
+		return true
+	}
+
+	scopes := strings.Join(missing, " ")
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata=%q, error="insufficient_scope", scope=%q`, a.MetadataURL(), scopes))
+	writeHTTPError(w, http.StatusForbidden, "insufficient scope: this request needs %s", scopes)
+	return false
+}
+
+func (a *Authorizer) scopeFor(permission Permission) string {
+	switch permission {
+	case PermissionWrite:
+		return a.opts.WriteScope
+	case PermissionDelete:
+		return a.opts.DeleteScope
+	default:
+		return a.opts.ReadScope
+	}
+}
+
+// requiredPermissions returns the permissions needed by the requests in a
+// raw message, which may be a batch. Requests that do not touch storage,
+// such as initialize or tools/list, need none, and unknown tools only read.
+func (s *Server) requiredPermissions(message string) []Permission {
+	parsed := gjson.Parse(message)
+	requests := []gjson.Result{parsed}
+	if parsed.IsArray() {
+		requests = parsed.Array()
+	}
+
+	var permissions []Permission
+	for _, request := range requests {
+		switch method := request.Get("method").String(); {
+		case method == "tools/call":
+			permission := PermissionRead
+			if tool, ok := s.lookupTool(request.Get("params.name").String()); ok {
+				permission = tool.Info().Permission
+			}
+			permissions = append(permissions, permission)
+		case strings.HasPrefix(method, "resources/"), method == "prompts/get":
+			permissions = append(permissions, PermissionRead)
+		}
+	}
+	return permissions
+}
+
+// verifyJWT validates a JWT access token against the published keys
+func (a *Authorizer) verifyJWT(ctx context.Context, token string) (*AuthInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed JWT")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || !gjson.ValidBytes(headerJSON) {
+		return nil, invalidToken("malformed JWT header")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !gjson.ValidBytes(payload) {
+		return nil, invalidToken("malformed JWT payload")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed JWT signature")
+	}
+
+	header := gjson.ParseBytes(headerJSON)
+	alg := header.Get("alg").String()
+	key, err := a.signingKey(ctx, header.Get("kid").String())
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := gjson.ParseBytes(payload)
+	if !claims.Get("exp").Exists() {
+		return nil, invalidToken("token has no expiry")
+	}
+	if len(a.opts.AuthorizationServers) > 0 && !containsString(a.opts.AuthorizationServers, claims.Get("iss").String()) {
+		return nil, invalidToken("token was issued by %q, which is not a trusted authorization server", claims.Get("iss").String())
+	}
+	return a.checkClaims(claims)
+}
+
+// introspect validates an opaque access token with the authorization server
+func (a *Authorizer) introspect(ctx context.Context, token string) (*AuthInfo, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.opts.IntrospectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.opts.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(a.opts.ClientID), url.QueryEscape(a.opts.ClientSecret))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("introspection failed with status %d", resp.StatusCode)
+	}
+
+	claims := gjson.ParseBytes(body)
+	if !claims.Get("active").Bool() {
+		return nil, invalidToken("token is not active")
+	}
+	return a.checkClaims(claims)
+}
+
+// checkClaims checks the audience and validity period of a token and
+// extracts who it was issued to
+func (a *Authorizer) checkClaims(claims gjson.Result) (*AuthInfo, error) {
+	now := time.Now()
+	if exp := claims.Get("exp"); exp.Exists() && now.After(time.Unix(exp.Int(), 0).Add(clockSkew)) {
+		return nil, invalidToken("token expired")
+	}
+	if nbf := claims.Get("nbf"); nbf.Exists() && now.Add(clockSkew).Before(time.Unix(nbf.Int(), 0)) {
+		return nil, invalidToken("token is not valid yet")
+	}
+
+	// Tokens must have been issued for this server, so a token meant for
+	// another service cannot be replayed here
+	audience := claims.Get("aud")
+	var audiences []string
+	if audience.IsArray() {
+		for _, aud := range audience.Array() {
+			audiences = append(audiences, aud.String())
+		}
+	} else if audience.Exists() {
+		audiences = []string{audience.String()}
+	}
+	if !containsString(audiences, a.opts.Resource) {
+		return nil, invalidToken("token audience %v does not include %s", audiences, a.opts.Resource)
+	}
+
+	info := &AuthInfo{
+		Subject:  claims.Get("sub").String(),
+		ClientID: claims.Get("client_id").String(),
+		Scopes:   strings.Fields(claims.Get("scope").String()),
+	}
+	// Some issuers list scopes in an scp claim instead
+	if scp := claims.Get("scp"); scp.IsArray() {
+		for _, scope := range scp.Array() {
+			info.Scopes = append(info.Scopes, scope.String())
+		}
+	} else if scp.Exists() {
+		info.Scopes = append(info.Scopes, strings.Fields(scp.String())...)
+	}
+	if exp := claims.Get("exp"); exp.Exists() {
+		info.Expiry = time.Unix(exp.Int(), 0)
+	}
+	return info, nil
+}
+
+// signingKey returns the published key with the given ID, fetching the
+// JWKS again if the key is not known yet, e.g. after a key rotation
+func (a *Authorizer) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+
+	if key := a.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(a.keysFetched) < jwksRefreshInterval {
+		return nil, invalidToken("unknown signing key %q", kid)
+	}
+
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.keys = keys
+	a.keysFetched = time.Now()
+
+	if key := a.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, invalidToken("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID. Tokens without a key ID can only be checked
+// when there is a single key.
+func (a *Authorizer) lookupKey(kid string) crypto.PublicKey {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key
+		}
+	}
+	return a.keys[kid]
+}
+
+func (a *Authorizer) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.opts.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("fetching JWKS failed with status %d", resp.StatusCode)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range gjson.GetBytes(body, "keys").Array() {
+		if use := jwk.Get("use").String(); use != "" && use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			// Keys of types we do not support are skipped, not fatal
+			continue
+		}
+		keys[jwk.Get("kid").String()] = key
+	}
+	return keys, nil
+}
+
+// parseJWK decodes an RSA or EC public key from its JWK form
+func parseJWK(jwk gjson.Result) (crypto.PublicKey, error) {
+	number := func(field string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(jwk.Get(field).String())
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid %s", field)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch kty := jwk.Get("kty").String(); kty {
+	case "RSA":
+		n, err := number("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := number("e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch crv := jwk.Get("crv").String(); crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		x, err := number("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := number("y")
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", kty)
+	}
+}
+
+// verifySignature checks a JWS signature. Only asymmetric algorithms are
+// accepted, so "none" and HMAC tokens are always rejected.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[len(alg)-min(3, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return invalidToken("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	var ok bool
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case strings.HasPrefix(alg, "RS"):
+			ok = rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		case strings.HasPrefix(alg, "PS"):
+			ok = rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+		default:
+			return invalidToken("algorithm %q does not match the RSA signing key", alg)
+		}
+	case *ecdsa.PublicKey:
+		if curveBits := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}[alg]; curveBits != k.Curve.Params().BitSize {
+			return invalidToken("algorithm %q does not match the EC signing key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalidToken("malformed ECDSA signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		ok = ecdsa.Verify(k, digest, r, s)
+	}
+	if !ok {
+		return invalidToken("signature verification failed")
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
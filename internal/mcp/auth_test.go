@@ -0,0 +1,350 @@
+package mcp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+const testResource = "https://mcp.example.com/mcp"
+
+// testIssuer is a small in-process authorization server. It publishes a
+// JWKS, signs JWT access tokens and answers introspection for opaque tokens.
+type testIssuer struct {
+	t      *testing.T
+	url    string
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	opaque map[string]map[string]interface{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	issuer := &testIssuer{
+		t:      t,
+		rsaKey: rsaKey,
+		ecKey:  ecKey,
+		opaque: make(map[string]map[string]interface{}),
+	}
+
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]interface{}{
+				{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+			},
+		})
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "mcp-server" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		issuer.mu.Lock()
+		claims, ok := issuer.opaque[r.FormValue("token")]
+		issuer.mu.Unlock()
+		if !ok {
+			claims = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(claims)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	issuer.url = server.URL
+	return issuer
+}
+
+// claims returns valid claims for a token with scopes, for the test resource
+func (i *testIssuer) claims(subject, scopes string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   i.url,
+		"sub":   subject,
+		"aud":   testResource,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": scopes,
+	}
+}
+
+// sign builds a JWT signed with the issuer's RSA (RS256) or EC (ES256) key
+func (i *testIssuer) sign(alg, kid string, claims map[string]interface{}) string {
+	i.t.Helper()
+
+	header, _ := json.Marshal(map[string]interface{}{"alg": alg, "kid": kid, "typ": "at+jwt"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			i.t.Fatalf("Failed to sign token: %v", err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		if err != nil {
+			i.t.Fatalf("Failed to sign token: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// issueOpaque registers an opaque token that introspection reports as active
+func (i *testIssuer) issueOpaque(token string, claims map[string]interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	claims["active"] = true
+	i.opaque[token] = claims
+}
+
+func (i *testIssuer) authorizer(introspection bool) *Authorizer {
+	i.t.Helper()
+
+	opts := AuthOptions{
+		Resource:             testResource,
+		AuthorizationServers: []string{i.url},
+		JWKSURL:              i.url + "/jwks",
+	}
+	if introspection {
+		opts.JWKSURL = ""
+		opts.IntrospectionURL = i.url + "/introspect"
+		opts.ClientID = "mcp-server"
+		opts.ClientSecret = "s3cret"
+	}
+
+	auth, err := NewAuthorizer(opts)
+	if err != nil {
+		i.t.Fatalf("Failed to create authorizer: %v", err)
+	}
+	return auth
+}
+
+func authenticateToken(auth *Authorizer, token string) (*AuthInfo, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	info, _ := auth.authenticate(recorder, req)
+	return info, recorder
+}
+
+func TestAuthorizer_JWT(t *testing.T) {
+	issuer := newTestIssuer(t)
+	auth := issuer.authorizer(false)
+
+	valid := issuer.claims("alice", "koneksi:read koneksi:write")
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := issuer.claims("alice", "koneksi:read")
+		claims[key] = value
+		return claims
+	}
+	tampered := issuer.sign("RS256", "rsa-1", valid)
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	payload, _ := json.Marshal(valid)
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	noExpiry := issuer.claims("alice", "koneksi:read")
+	delete(noExpiry, "exp")
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", issuer.sign("RS256", "rsa-1", valid), true},
+		{"ES256", issuer.sign("ES256", "ec-1", valid), true},
+		{"audience list", issuer.sign("RS256", "rsa-1", with("aud", []string{"https://other.example.com", testResource})), true},
+		{"no token", "", false},
+		{"expired", issuer.sign("RS256", "rsa-1", with("exp", time.Now().Add(-time.Hour).Unix())), false},
+		{"not yet valid", issuer.sign("RS256", "rsa-1", with("nbf", time.Now().Add(time.Hour).Unix())), false},
+		{"no expiry", issuer.sign("RS256", "rsa-1", noExpiry), false},
+		{"other audience", issuer.sign("RS256", "rsa-1", with("aud", "https://other.example.com")), false},
+		{"untrusted issuer", issuer.sign("RS256", "rsa-1", with("iss", "https://evil.example.com")), false},
+		{"tampered", tampered, false},
+		{"alg none", none, false},
+		{"key of the wrong type", issuer.sign("RS256", "ec-1", valid), false},
+		{"unknown key", issuer.sign("RS256", "rsa-2", valid), false},
+		{"garbage", "not-a-jwt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, recorder := authenticateToken(auth, tt.token)
+			if !tt.valid {
+				if info != nil || recorder.Code != http.StatusUnauthorized {
+					t.Fatalf("Expected 401, got %d", recorder.Code)
+				}
+				if challenge := recorder.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp"`) {
+					t.Errorf("Expected a challenge pointing at the metadata, got %q", challenge)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatalf("Expected the token to be accepted, got %d: %s", recorder.Code, recorder.Body)
+			}
+			if info.Subject != "alice" || !info.HasScope("koneksi:read") {
+				t.Errorf("Unexpected identity %+v", info)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_Introspection(t *testing.T) {
+	issuer := newTestIssuer(t)
+	auth := issuer.authorizer(true)
+
+	issuer.issueOpaque("good", issuer.claims("bob", "koneksi:write"))
+	issuer.issueOpaque("wrong-audience", map[string]interface{}{"sub": "bob", "aud": "https://other.example.com"})
+
+	info, recorder := authenticateToken(auth, "good")
+	if info == nil {
+		t.Fatalf("Expected the token to be accepted, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if info.Subject != "bob" || !info.HasScope("koneksi:write") || info.HasScope("koneksi:read") {
+		t.Errorf("Unexpected identity %+v", info)
+	}
+
+	for _, token := range []string{"revoked", "wrong-audience"} {
+		if info, recorder := authenticateToken(auth, token); info != nil || recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to be rejected with 401, got %d", token, recorder.Code)
+		}
+	}
+}
+
+func TestRequiredPermissions(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	tests := []struct {
+		message string
+		want    []Permission
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, nil},
+		{`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`, []Permission{PermissionRead}},
+		{`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"upload_content"}}`, []Permission{PermissionWrite}},
+		{`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"download_file"}}`, []Permission{PermissionWrite}},
+		{`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"koneksi://file/1"}}`, []Permission{PermissionRead}},
+		{`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"no_such_tool"}}`, []Permission{PermissionRead}},
+		{`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"create_directory"}}]`, []Permission{PermissionWrite}},
+	}
+
+	for _, tt := range tests {
+		got := server.requiredPermissions(tt.message)
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("requiredPermissions(%s) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPHandler_Auth(t *testing.T) {
+	issuer := newTestIssuer(t)
+	auth := issuer.authorizer(false)
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient("http://127.0.0.1:1", "test-id", "test-secret", ""))
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", NewHTTPHandler(server, HTTPOptions{Auth: auth}))
+	mux.HandleFunc(auth.MetadataPath(), auth.ServeMetadata)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	post := func(token, sessionID, body string) *http.Response {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodPost, httpServer.URL+"/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if sessionID != "" {
+			req.Header.Set(sessionIDHeader, sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// The metadata tells clients where to get tokens
+	resp, err := http.Get(httpServer.URL + "/.well-known/oauth-protected-resource/mcp")
+	if err != nil {
+		t.Fatalf("GET metadata failed: %v", err)
+	}
+	var metadata map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&metadata)
+	resp.Body.Close()
+	if metadata["resource"] != testResource || metadata["authorization_servers"].([]interface{})[0] != issuer.url {
+		t.Errorf("Unexpected metadata %v", metadata)
+	}
+
+	initialize := `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	if resp := post("", "", initialize); resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Bearer resource_metadata=") {
+		t.Fatalf("Expected 401 with a challenge, got %d %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	readToken := issuer.sign("RS256", "rsa-1", issuer.claims("alice", "koneksi:read"))
+	resp = post(readToken, "", initialize)
+	sessionID := resp.Header.Get(sessionIDHeader)
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("Expected initialize to succeed, got %d", resp.StatusCode)
+	}
+
+	// Reading is allowed, writing needs the write scope
+	if resp := post(readToken, sessionID, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list_directories","arguments":{}}}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected list_directories to be allowed, got %d", resp.StatusCode)
+	}
+	resp = post(readToken, sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":"a.txt","content":"aGk="}}}`)
+	if challenge := resp.Header.Get("WWW-Authenticate"); resp.StatusCode != http.StatusForbidden || !strings.Contains(challenge, `error="insufficient_scope", scope="koneksi:write"`) {
+		t.Errorf("Expected 403 asking for koneksi:write, got %d %q", resp.StatusCode, challenge)
+	}
+
+	// Downloads write local files, which reading storage does not allow
+	resp = post(readToken, sessionID, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":"f1","outputPath":"a.txt"}}}`)
+	if challenge := resp.Header.Get("WWW-Authenticate"); resp.StatusCode != http.StatusForbidden || !strings.Contains(challenge, `scope="koneksi:write"`) {
+		t.Errorf("Expected download_file to need koneksi:write, got %d %q", resp.StatusCode, challenge)
+	}
+
+	writeToken := issuer.sign("ES256", "ec-1", issuer.claims("alice", "koneksi:read koneksi:write"))
+	if resp := post(writeToken, sessionID, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":"a.txt","content":"aGk="}}}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected upload_content to be allowed with koneksi:write, got %d", resp.StatusCode)
+	}
+
+	// Another user cannot use the session even with a valid token
+	otherToken := issuer.sign("RS256", "rsa-1", issuer.claims("mallory", "koneksi:read koneksi:write"))
+	if resp := post(otherToken, sessionID, `{"jsonrpc":"2.0","id":4,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected another user's session to be hidden, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// elicitationTimeout is how long the server waits for the user to answer
+// an elicitation before giving up
+const elicitationTimeout = 10 * time.Minute
+
+// ConflictAction is what happens when a download or upload would replace an
+// existing file
+type ConflictAction int
+
+const (
+	// ConflictCancel leaves the existing file alone and fails the call
+	ConflictCancel ConflictAction = iota
+
+	// ConflictOverwrite replaces the existing file
+	ConflictOverwrite
+
+	// ConflictRename stores the new file under a free name
+	ConflictRename
+)
+
+// ParseConflictAction parses the name of an action: cancel, overwrite or rename
+func ParseConflictAction(name string) (ConflictAction, error) {
+	switch name {
+	case "", "cancel":
+		return ConflictCancel, nil
+	case "overwrite":
+		return ConflictOverwrite, nil
+	case "rename":
+		return ConflictRename, nil
+	default:
+		return ConflictCancel, fmt.Errorf("unknown conflict action %q, expected cancel, overwrite or rename", name)
+	}
+}
+
+func (a ConflictAction) String() string {
+	switch a {
+	case ConflictOverwrite:
+		return "overwrite"
+	case ConflictRename:
+		return "rename"
+	default:
+		return "cancel"
+	}
+}
+
+// SetConflictDefault sets what happens to existing files when the client
+// cannot ask the user, because it does not support elicitation. The default
+// is ConflictCancel. Calls with overwrite set always overwrite then.
+func (s *Server) SetConflictDefault(action ConflictAction) {
+	s.toolMu.Lock()
+	defer s.toolMu.Unlock()
+
+	s.conflictDefault = action
+}
+
+// resolveConflict decides what to do about an existing file, described by
+// what, that a call would replace. Clients that support elicitation ask the
+// user, who can also pick the name to rename to; otherwise the call's
+// overwrite argument or the configured default decides. It returns the
+// action and, for ConflictRename, the new name, which is suggested unless
+// the user gave another. ConflictCancel comes with the error to fail with.
+func (s *Server) resolveConflict(ctx context.Context, what string, overwrite bool, suggested string) (ConflictAction, string, error) {
+	sess := s.sessionFrom(ctx)
+	if !sess.supportsElicitation() {
+		action := ConflictOverwrite
+		if !overwrite {
+			s.toolMu.RLock()
+			action = s.conflictDefault
+			s.toolMu.RUnlock()
+		}
+		if action == ConflictCancel {
+			return action, "", fmt.Errorf("%s already exists, set overwrite to replace it", what)
+		}
+		return action, suggested, nil
+	}
+
+	message := fmt.Sprintf("%s already exists. Overwrite it, save the new file as %s, or cancel?", what, suggested)
+	if overwrite {
+		message = fmt.Sprintf("%s already exists and the assistant wants to overwrite it. Overwrite it, save the new file as %s, or cancel?", what, suggested)
+	}
+	content, ok, err := sess.elicit(ctx, message, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":      "string",
+				"title":     "Action",
+				"enum":      []string{"overwrite", "rename", "cancel"},
+				"enumNames": []string{"Overwrite", "Rename", "Cancel"},
+			},
+			"newName": map[string]interface{}{
+				"type":        "string",
+				"title":       "New name",
+				"description": "Name to save the new file as when renaming, " + suggested + " if left empty",
+			},
+		},
+		"required": []string{"action"},
+	})
+	if err != nil {
+		return ConflictCancel, "", fmt.Errorf("%s already exists and the user could not be asked what to do: %w", what, err)
+	}
+	if !ok {
+		return ConflictCancel, "", fmt.Errorf("%s already exists and the user declined to replace it", what)
+	}
+
+	action, err := ParseConflictAction(content.Get("action").String())
+	if err != nil || !content.Get("action").Exists() {
+		return ConflictCancel, "", fmt.Errorf("%s already exists and the user gave no valid action", what)
+	}
+	switch action {
+	case ConflictCancel:
+		return action, "", fmt.Errorf("%s already exists and the user chose to keep it", what)
+	case ConflictRename:
+		name := strings.TrimSpace(content.Get("newName").String())
+		if name == "" {
+			return action, suggested, nil
+		}
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return ConflictCancel, "", fmt.Errorf("%s already exists and the new name %q the user gave is not a file name", what, name)
+		}
+		return action, name, nil
+	}
+	return action, "", nil
+}
+
+// elicit asks the user for input through the client, with a form described
+// by schema. It returns the content the user submitted, or false when they
+// declined or dismissed the request.
+func (sess *Session) elicit(ctx context.Context, message string, schema map[string]interface{}) (gjson.Result, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, elicitationTimeout)
+	defer cancel()
+
+	result, err := sess.request(ctx, "elicitation/create", map[string]interface{}{
+		"message":         message,
+		"requestedSchema": schema,
+	})
+	if err != nil {
+		return gjson.Result{}, false, err
+	}
+
+	if result.Get("action").String() != "accept" {
+		return gjson.Result{}, false, nil
+	}
+	return result.Get("content"), true, nil
+}
+
+// freeName returns the first of "name (1).ext", "name (2).ext" and so on
+// for which taken is false
+func freeName(name string, taken func(string) bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// freeLocalName returns a name in the directory of path that no file has
+func freeLocalName(path string) string {
+	dir := filepath.Dir(path)
+	return freeName(filepath.Base(path), func(name string) bool {
+		_, err := os.Lstat(filepath.Join(dir, name))
+		return err == nil
+	})
+}
+
+// resolveUploadConflict checks whether the directory an upload goes to
+// already has a file named name and, if so, resolves the conflict. It
+// returns the name to upload as and, when there was a conflict, a note on
+// how it was resolved. Koneksi keeps every file, so overwriting means
+// storing another file under the same name. Dry runs do not ask the user.
+// Uploads to a directory that cannot be listed fail, as they could replace
+// a file without asking.
+func (s *Server) resolveUploadConflict(ctx context.Context, directoryId, name string, overwrite, dryRun bool) (string, string, error) {
+	// Uploads without a directory go to the root, listed by its alias
+	directoryId = s.policyDirectory(directoryId)
+
+	files, err := s.client.GetDirectoryFilesContext(ctx, directoryId)
+	if err != nil {
+		return "", "", fmt.Errorf("could not check directory %s for a file named %s: %w", directoryId, name, err)
+	}
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		names[file.Name] = true
+	}
+	if !names[name] {
+		return name, "", nil
+	}
+
+	existing := fmt.Sprintf("directory %s already has a file named %s", directoryId, name)
+	if dryRun && s.sessionFrom(ctx).supportsElicitation() {
+		return name, existing + ", the user would be asked whether to store another file under the same name, rename the upload or cancel", nil
+	}
+
+	suggested := freeName(name, func(n string) bool { return names[n] })
+	action, newName, err := s.resolveConflict(ctx, fmt.Sprintf("A file named %s in directory %s", name, directoryId), overwrite, suggested)
+	switch {
+	case err != nil:
+		return "", "", err
+	case action == ConflictRename:
+		if names[newName] {
+			return "", "", fmt.Errorf("directory %s already has a file named %s too", directoryId, newName)
+		}
+		return newName, existing + ", the upload would be stored as " + newName, nil
+	default:
+		return name, existing + ", another file would be stored under the same name", nil
+	}
+}
+
+// admitUpload checks an upload against the upload policy and the files
+// already in its directory, and returns the name to upload as, with a note
+// on any conflict with an existing file. directoryId must be the directory
+// the upload is sent to.
+func (s *Server) admitUpload(ctx context.Context, directoryId, name string, overwrite, dryRun bool, size int64, head []byte) (string, string, error) {
+	if err := s.checkUpload(directoryId, name, size, head); err != nil {
+		return "", "", err
+	}
+	newName, note, err := s.resolveUploadConflict(ctx, directoryId, name, overwrite, dryRun)
+	if err != nil {
+		return "", "", err
+	}
+	if newName != name {
+		if err := s.checkUpload(directoryId, newName, size, head); err != nil {
+			return "", "", err
+		}
+	}
+	return newName, note, nil
+}
@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func TestParseConflictAction(t *testing.T) {
+	for _, name := range []string{"cancel", "overwrite", "rename"} {
+		action, err := ParseConflictAction(name)
+		if err != nil || action.String() != name {
+			t.Errorf("%s: got %v, %v", name, action, err)
+		}
+	}
+	if action, err := ParseConflictAction(""); err != nil || action != ConflictCancel {
+		t.Errorf("Expected cancel to be the default, got %v, %v", action, err)
+	}
+	if _, err := ParseConflictAction("merge"); err == nil {
+		t.Error("Expected an unknown action to be refused")
+	}
+}
+
+func TestServer_DownloadConflictDefault(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("downloaded content"))
+	}))
+	defer mockServer.Close()
+
+	root := t.TempDir()
+	writeFiles(t, root, "report.txt")
+	existing := filepath.Join(root, "report.txt")
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	download := func() string {
+		response, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":"f1","outputPath":%q}}}`, existing))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(t, response)
+	}
+
+	// Renaming keeps the existing file and picks a free name
+	server.SetConflictDefault(ConflictRename)
+	for _, want := range []string{"report (1).txt", "report (2).txt"} {
+		if text := download(); !strings.Contains(text, want) {
+			t.Errorf("Expected the download to be saved as %s, got %q", want, text)
+		}
+		if data, _ := os.ReadFile(filepath.Join(root, want)); string(data) != "downloaded content" {
+			t.Errorf("Expected %s to be downloaded, got %q", want, data)
+		}
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "report.txt" {
+		t.Errorf("Expected the existing file to be unchanged, got %q", data)
+	}
+
+	server.SetConflictDefault(ConflictOverwrite)
+	if text := download(); !strings.Contains(text, "File downloaded successfully!") {
+		t.Errorf("Expected the existing file to be overwritten, got %q", text)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "downloaded content" {
+		t.Errorf("Expected the existing file to be overwritten, got %q", data)
+	}
+}
+
+// elicitationSession returns a session whose client supports elicitation and
+// answers each elicitation/create with the next of answers, recording the
+// messages it was asked
+func elicitationSession(t *testing.T, server *Server, answers []map[string]interface{}, asked *[]string) *Session {
+	t.Helper()
+
+	sess := server.NewSession()
+	t.Cleanup(sess.Close)
+	sess.SetNotifier(func(message interface{}) error {
+		m := message.(map[string]interface{})
+		if m["method"] != "elicitation/create" {
+			return nil
+		}
+		params := m["params"].(map[string]interface{})
+		*asked = append(*asked, params["message"].(string))
+
+		answer := answers[0]
+		answers = answers[1:]
+		response, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      m["id"],
+			"result":  answer,
+		})
+		go sess.HandleMessage(string(response))
+		return nil
+	})
+
+	sess.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"elicitation":{}}}}`)
+	sess.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	return sess
+}
+
+func TestServer_DownloadConflictElicitation(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("downloaded content"))
+	}))
+	defer mockServer.Close()
+
+	root := t.TempDir()
+	writeFiles(t, root, "a.txt", "b.txt", "c.txt", "d.txt")
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	// The user's choice wins over the configured default
+	server.SetConflictDefault(ConflictOverwrite)
+
+	var asked []string
+	sess := elicitationSession(t, server, []map[string]interface{}{
+		{"action": "accept", "content": map[string]interface{}{"action": "overwrite"}},
+		{"action": "accept", "content": map[string]interface{}{"action": "rename", "newName": "b-copy.txt"}},
+		{"action": "decline"},
+		{"action": "accept", "content": map[string]interface{}{"action": "cancel"}},
+	}, &asked)
+
+	download := func(name string) string {
+		response := sess.HandleMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":"f1","outputPath":%q}}}`, filepath.Join(root, name)))
+		return resultText(t, response)
+	}
+
+	if text := download("a.txt"); !strings.Contains(text, "File downloaded successfully!") {
+		t.Errorf("Expected a.txt to be overwritten, got %q", text)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(data) != "downloaded content" {
+		t.Errorf("Expected a.txt to be overwritten, got %q", data)
+	}
+
+	if text := download("b.txt"); !strings.Contains(text, "b-copy.txt") {
+		t.Errorf("Expected the download to be saved as b-copy.txt, got %q", text)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "b.txt")); string(data) != "b.txt" {
+		t.Errorf("Expected b.txt to be unchanged, got %q", data)
+	}
+
+	if text := download("c.txt"); !strings.Contains(text, "the user declined to replace it") {
+		t.Errorf("Expected the declined download to fail, got %q", text)
+	}
+	if text := download("d.txt"); !strings.Contains(text, "the user chose to keep it") {
+		t.Errorf("Expected the cancelled download to fail, got %q", text)
+	}
+	for _, name := range []string{"c.txt", "d.txt"} {
+		if data, _ := os.ReadFile(filepath.Join(root, name)); string(data) != name {
+			t.Errorf("Expected %s to be unchanged, got %q", name, data)
+		}
+	}
+
+	if len(asked) != 4 || !strings.Contains(asked[0], "a.txt already exists") || !strings.Contains(asked[0], "a (1).txt") {
+		t.Errorf("Expected the user to be asked about each file, got %q", asked)
+	}
+}
+
+func TestServer_UploadConflict(t *testing.T) {
+	var uploaded, listed []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			listed = append(listed, r.URL.Path)
+			if strings.HasSuffix(r.URL.Path, "/broken") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"files": []map[string]interface{}{
+					{"id": "f1", "name": "notes.txt"},
+					{"id": "f2", "name": "notes (1).txt"},
+				}},
+			})
+			return
+		}
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected a multipart upload: %v", err)
+			return
+		}
+		uploaded = append(uploaded, header.Filename)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"file_id": "f3", "name": header.Filename, "size": 5},
+		})
+	}))
+	defer mockServer.Close()
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	uploadTo := func(directoryId, name string, overwrite bool) string {
+		response, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":%q,"content":%q,"directoryId":%q,"overwrite":%t}}}`, name, base64.StdEncoding.EncodeToString([]byte("hello")), directoryId, overwrite))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(t, response)
+	}
+	upload := func(name string, overwrite bool) string {
+		return uploadTo("d1", name, overwrite)
+	}
+
+	tests := []struct {
+		action    ConflictAction
+		name      string
+		overwrite bool
+		uploaded  string
+		want      string
+	}{
+		{ConflictCancel, "other.txt", false, "other.txt", "Content uploaded successfully!"},
+		{ConflictCancel, "notes.txt", false, "", "A file named notes.txt in directory d1 already exists"},
+		{ConflictCancel, "notes.txt", true, "notes.txt", "Content uploaded successfully!"},
+		{ConflictRename, "notes.txt", false, "notes (2).txt", "Content uploaded successfully!"},
+		{ConflictOverwrite, "notes.txt", false, "notes.txt", "Content uploaded successfully!"},
+	}
+
+	for _, tt := range tests {
+		uploaded = nil
+		server.SetConflictDefault(tt.action)
+		text := upload(tt.name, tt.overwrite)
+		if !strings.Contains(text, tt.want) {
+			t.Errorf("%s, %s: expected %q, got %q", tt.action, tt.name, tt.want, text)
+		}
+		if tt.uploaded == "" {
+			if len(uploaded) != 0 {
+				t.Errorf("%s, %s: expected nothing to be uploaded, got %q", tt.action, tt.name, uploaded)
+			}
+			continue
+		}
+		if len(uploaded) != 1 || uploaded[0] != tt.uploaded {
+			t.Errorf("%s, %s: expected %q to be uploaded, got %q", tt.action, tt.name, tt.uploaded, uploaded)
+		}
+	}
+	// Uploads to the root are checked too
+	uploaded, listed = nil, nil
+	server.SetConflictDefault(ConflictCancel)
+	if text := uploadTo("", "notes.txt", false); !strings.Contains(text, "A file named notes.txt in directory root already exists") || len(uploaded) != 0 {
+		t.Errorf("Expected the root upload to be refused, got %q", text)
+	}
+	if len(listed) != 1 || !strings.HasSuffix(listed[0], "/directories/root") {
+		t.Errorf("Expected the root to be listed, got %v", listed)
+	}
+
+	// Nothing is uploaded when the directory cannot be checked
+	if text := uploadTo("broken", "other.txt", false); !strings.Contains(text, "could not check directory broken") || len(uploaded) != 0 {
+		t.Errorf("Expected the upload to fail, got %q", text)
+	}
+}
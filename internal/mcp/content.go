@@ -0,0 +1,318 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// Default and maximum number of bytes returned per read_file window
+	defaultReadLength = 64 << 10
+	maxReadLength     = 1 << 20
+
+	// Images and other binaries are returned whole, so they are capped separately
+	maxInlineBinary = 5 << 20
+
+	sniffLen = 512
+
+	// maxCharWidening is how far past its length a window may reach to hold
+	// a whole character: a partial one skipped at its start and a full one
+	maxCharWidening = 2 * utf8.UTFMax
+)
+
+// fileContent is a downloaded file (or a window of it) ready to be returned inline
+type fileContent struct {
+	MimeType string
+	Charset  string // empty for binary content
+	Text     string
+	Data     []byte
+	Offset   int64 // raw byte range of the window within the file
+	End      int64
+	Next     int64 // offset of the next window, or -1 at end of file
+}
+
+func (c *fileContent) IsText() bool {
+	return c.Charset != ""
+}
+
+func (c *fileContent) IsImage() bool {
+	return strings.HasPrefix(c.MimeType, "image/")
+}
+
+// readContent sniffs the stream and returns text windowed by offset/length,
+// or the whole body (up to maxInlineBinary) for images and other binaries.
+// Callers are responsible for capping length.
+func readContent(r io.Reader, offset, length int64) (*fileContent, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+	if length <= 0 {
+		length = defaultReadLength
+	}
+
+	sniff := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, sniff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	sniff = sniff[:n]
+	stream := io.MultiReader(bytes.NewReader(sniff), r)
+
+	// Anything sniffed as a specific non-text format (images, PDFs, archives...) is binary
+	mimeType := http.DetectContentType(sniff)
+	charset := ""
+	if strings.HasPrefix(mimeType, "text/") || mimeType == "application/octet-stream" {
+		charset = detectCharset(sniff, n == sniffLen)
+	}
+
+	if charset == "" {
+		data, err := io.ReadAll(io.LimitReader(stream, maxInlineBinary+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if len(data) > maxInlineBinary {
+			return nil, fmt.Errorf("binary file exceeds the %d byte inline limit; use download_file instead", maxInlineBinary)
+		}
+		return &fileContent{MimeType: mimeType, Data: data, Next: -1}, nil
+	}
+
+	// UTF-16 windows have to start on a code unit boundary
+	utf16Text := strings.HasPrefix(charset, "utf-16")
+	if utf16Text {
+		offset &^= 1
+		length = (length + 1) &^ 1
+	}
+
+	if _, err := io.CopyN(io.Discard, stream, offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to skip to offset: %w", err)
+	}
+
+	// Read one extra byte to find out whether there is more after this
+	// window, and a few more for the one character of a window too short
+	// to hold it, so that the next window always starts further on
+	extra := int64(1)
+	if charset == "utf-8" || utf16Text {
+		extra += maxCharWidening
+	}
+	window, err := io.ReadAll(io.LimitReader(stream, length+extra))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	start, end := 0, len(window)
+	switch {
+	case charset == "utf-8":
+		// Drop a partial rune at either edge so the window decodes cleanly
+		for start < len(window) && start < utf8.UTFMax && !utf8.RuneStart(window[start]) {
+			start++
+		}
+		if int64(end) > length {
+			end = int(length)
+			for cut := 1; cut < utf8.UTFMax && cut <= end-start; cut++ {
+				if utf8.RuneStart(window[end-cut]) {
+					if !utf8.FullRune(window[end-cut : end]) {
+						end -= cut
+					}
+					break
+				}
+			}
+			if end <= start {
+				_, size := utf8.DecodeRune(window[start:])
+				end = start + size
+			}
+		}
+	case utf16Text:
+		// Leave a surrogate pair split at either edge to the window that
+		// holds all of it
+		if len(window) >= 2 && isLowSurrogate(utf16Unit(window, 0, charset)) {
+			start = 2
+		}
+		if int64(end) > length {
+			end = int(length)
+			if end-2 >= start && isHighSurrogate(utf16Unit(window, end-2, charset)) {
+				end -= 2
+			}
+			if end <= start && start+2 <= len(window) {
+				end = start + 2
+				if isHighSurrogate(utf16Unit(window, start, charset)) && end+2 <= len(window) {
+					end += 2
+				}
+			}
+		}
+	case int64(end) > length:
+		end = int(length)
+	}
+
+	next := int64(-1)
+	if end < len(window) {
+		next = offset + int64(end)
+	}
+	if start > end {
+		start = end
+	}
+	offset += int64(start)
+	window = window[start:end]
+
+	return &fileContent{
+		MimeType: textMimeType(mimeType),
+		Charset:  charset,
+		Text:     decodeText(window, charset),
+		Offset:   offset,
+		End:      offset + int64(len(window)),
+		Next:     next,
+	}, nil
+}
+
+// detectCharset guesses the encoding of sample, returning "" for binary content.
+// truncated reports whether sample was cut from a longer stream.
+func detectCharset(sample []byte, truncated bool) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+
+	if len(sample) == 0 {
+		return "utf-8"
+	}
+
+	// BOM-less UTF-16 shows up as NUL bytes on every other position
+	var evenNUL, oddNUL, nul, control int
+	for i, c := range sample {
+		switch {
+		case c == 0 && i%2 == 0:
+			evenNUL++
+			nul++
+		case c == 0:
+			oddNUL++
+			nul++
+		case c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != '\f' && c != 0x1B:
+			control++
+		}
+	}
+
+	half := len(sample) / 2
+	if half > 0 && oddNUL > half*3/4 && evenNUL == 0 {
+		return "utf-16le"
+	}
+	if half > 0 && evenNUL > half*3/4 && oddNUL == 0 {
+		return "utf-16be"
+	}
+	if nul > 0 || control > len(sample)/10 {
+		return ""
+	}
+
+	valid := sample
+	if truncated {
+		// Ignore a multi-byte rune cut off by the sniff boundary
+		for cut := 1; cut < utf8.UTFMax && cut <= len(valid); cut++ {
+			if utf8.RuneStart(valid[len(valid)-cut]) {
+				if !utf8.FullRune(valid[len(valid)-cut:]) {
+					valid = valid[:len(valid)-cut]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(valid) {
+		return "utf-8"
+	}
+
+	return "iso-8859-1"
+}
+
+// utf16Unit returns the UTF-16 code unit at byte i of data
+func utf16Unit(data []byte, i int, charset string) uint16 {
+	if charset == "utf-16le" {
+		return uint16(data[i]) | uint16(data[i+1])<<8
+	}
+	return uint16(data[i])<<8 | uint16(data[i+1])
+}
+
+func isHighSurrogate(unit uint16) bool {
+	return unit >= 0xD800 && unit < 0xDC00
+}
+
+func isLowSurrogate(unit uint16) bool {
+	return unit >= 0xDC00 && unit < 0xE000
+}
+
+func decodeText(data []byte, charset string) string {
+	switch charset {
+	case "utf-16le", "utf-16be":
+		if charset == "utf-16le" {
+			data = bytes.TrimPrefix(data, []byte{0xFF, 0xFE})
+		} else {
+			data = bytes.TrimPrefix(data, []byte{0xFE, 0xFF})
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if charset == "utf-16le" {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units))
+	case "iso-8859-1":
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	default:
+		return strings.ToValidUTF8(string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})), "�")
+	}
+}
+
+// textMimeType keeps specific text types from sniffing and falls back to text/plain
+func textMimeType(sniffed string) string {
+	mimeType := strings.TrimSpace(strings.Split(sniffed, ";")[0])
+	if strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" || mimeType == "application/xml" {
+		return mimeType
+	}
+	return "text/plain"
+}
+
+// contentItems converts downloaded content into MCP tool result content
+func (c *fileContent) contentItems(uri string) []map[string]interface{} {
+	if c.IsText() {
+		return []map[string]interface{}{
+			{
+				"type": "text",
+				"text": c.Text,
+			},
+		}
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(c.Data)
+	if c.IsImage() {
+		return []map[string]interface{}{
+			{
+				"type":     "image",
+				"data":     encoded,
+				"mimeType": c.MimeType,
+			},
+		}
+	}
+
+	return []map[string]interface{}{
+		{
+			"type": "resource",
+			"resource": map[string]interface{}{
+				"uri":      uri,
+				"mimeType": c.MimeType,
+				"blob":     encoded,
+			},
+		},
+	}
+}
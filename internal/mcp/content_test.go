@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   []byte
+		expected string
+	}{
+		{"ascii", []byte("hello world"), "utf-8"},
+		{"utf-8", []byte("grüße 안녕하세요"), "utf-8"},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFhello"), "utf-8"},
+		{"utf-16le bom", []byte("\xFF\xFEh\x00i\x00"), "utf-16le"},
+		{"utf-16be without bom", []byte("\x00h\x00e\x00l\x00l\x00o"), "utf-16be"},
+		{"latin-1", []byte("caf\xE9 cr\xE8me"), "iso-8859-1"},
+		{"binary", []byte{0x01, 0x02, 0x00, 0xFF, 0x10, 0x00, 0x00, 0x03}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCharset(tt.sample, false); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadContent_Decoding(t *testing.T) {
+	fc, err := readContent(bytes.NewReader([]byte("\xFF\xFEh\x00i\x00")), 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fc.Text != "hi" || fc.Charset != "utf-16le" {
+		t.Errorf("Expected UTF-16LE text 'hi', got %q (%s)", fc.Text, fc.Charset)
+	}
+
+	fc, err = readContent(bytes.NewReader([]byte("caf\xE9")), 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fc.Text != "café" {
+		t.Errorf("Expected Latin-1 text to be converted to UTF-8, got %q", fc.Text)
+	}
+}
+
+func TestReadContent_Windows(t *testing.T) {
+	text := strings.Repeat("é", 100) // 200 bytes of two-byte runes
+
+	// A window ending mid-rune is trimmed back to the rune boundary
+	fc, err := readContent(strings.NewReader(text), 0, 11)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fc.Text != strings.Repeat("é", 5) || fc.Next != 10 {
+		t.Errorf("Expected 5 runes and next offset 10, got %q and %d", fc.Text, fc.Next)
+	}
+
+	// A window starting mid-rune skips forward to the next rune
+	fc, err = readContent(strings.NewReader(text), 195, 100)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fc.Text != "éé" || fc.Offset != 196 || fc.Next != -1 {
+		t.Errorf("Expected final 2 runes from offset 196, got %q from %d (next %d)", fc.Text, fc.Offset, fc.Next)
+	}
+
+	if _, err := readContent(strings.NewReader(text), -1, 10); err == nil {
+		t.Error("Expected error for a negative offset")
+	}
+}
+
+func TestReadContent_WindowsAdvance(t *testing.T) {
+	utf16le := []byte{0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune("a😀b😀😀c")) {
+		utf16le = append(utf16le, byte(unit), byte(unit>>8))
+	}
+	files := map[string]struct {
+		data []byte
+		text string
+	}{
+		"utf-8":    {[]byte("a😀bé😀c"), "a😀bé😀c"},
+		"utf-16le": {utf16le, "a😀b😀😀c"},
+		"latin-1":  {[]byte("caf\xE9 cr\xE8me"), "café crème"},
+	}
+
+	// Following next reads the whole text, whatever the window length
+	for name, file := range files {
+		for length := int64(1); length <= 6; length++ {
+			var text strings.Builder
+			offset := int64(0)
+			for i := 0; offset >= 0; i++ {
+				if i > len(file.data) {
+					t.Fatalf("%s, length %d: next stopped advancing at %d", name, length, offset)
+				}
+				fc, err := readContent(bytes.NewReader(file.data), offset, length)
+				if err != nil {
+					t.Fatalf("%s, length %d: unexpected error: %v", name, length, err)
+				}
+				if fc.Next >= 0 && fc.Next <= offset {
+					t.Fatalf("%s, length %d: next %d does not advance from %d", name, length, fc.Next, offset)
+				}
+				text.WriteString(fc.Text)
+				offset = fc.Next
+			}
+			if text.String() != file.text {
+				t.Errorf("%s, length %d: read %q, want %q", name, length, text.String(), file.text)
+			}
+		}
+	}
+}
+
+func TestReadContent_BinaryLimit(t *testing.T) {
+	data := append([]byte("PK\x03\x04"), make([]byte, maxInlineBinary)...)
+
+	if _, err := readContent(bytes.NewReader(data), 0, 0); err == nil {
+		t.Error("Expected error for a binary file over the inline limit")
+	}
+}
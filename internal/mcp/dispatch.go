@@ -0,0 +1,208 @@
+package mcp
+
+import (
+	"context"
+	"log"
+
+	"github.com/tidwall/gjson"
+)
+
+// call is a request that passed validation and the lifecycle checks and is
+// ready to run. It is tracked as in flight until its response is built, and
+// notifications/cancelled cancels its context.
+type call struct {
+	key    string
+	id     interface{}
+	method string
+	parsed gjson.Result
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// inlineMethods are cheap enough to be answered as soon as they are read,
+// and initialize must complete before the requests that follow it run
+var inlineMethods = map[string]bool{
+	"initialize": true,
+	"ping":       true,
+}
+
+// acceptMessage parses a raw message and does everything that has to happen
+// in the order messages arrive: validation, lifecycle checks, notifications
+// and registering requests as in flight. It returns either an immediate
+// response (nil when nothing needs answering) or a function that runs the
+// accepted requests and returns their response, which may be called from
+// another goroutine. The requests' contexts derive from ctx, which transports
+// use to route request-related notifications.
+func (sess *Session) acceptMessage(ctx context.Context, message string) (interface{}, func() interface{}) {
+	if !gjson.Valid(message) {
+		return ErrorResponse(nil, newRPCError(CodeParseError, "parse error: invalid JSON")), nil
+	}
+
+	parsed := gjson.Parse(message)
+	if parsed.IsArray() {
+		return sess.acceptBatch(ctx, parsed)
+	}
+
+	c, response := sess.accept(ctx, parsed)
+	if c == nil {
+		return response, nil
+	}
+	if inlineMethods[c.method] {
+		return sess.run(c), nil
+	}
+	return nil, func() interface{} {
+		return sess.run(c)
+	}
+}
+
+// acceptBatch accepts every message of a batch. The batch is answered with an
+// array of the responses to its requests, in order; a batch made up only of
+// notifications gets no response at all.
+func (sess *Session) acceptBatch(ctx context.Context, batch gjson.Result) (interface{}, func() interface{}) {
+	messages := batch.Array()
+	if len(messages) == 0 {
+		return ErrorResponse(nil, newRPCError(CodeInvalidRequest, "invalid request: empty batch")), nil
+	}
+
+	type entry struct {
+		call     *call
+		response interface{}
+	}
+	entries := make([]entry, 0, len(messages))
+	pending := false
+	for _, message := range messages {
+		c, response := sess.accept(ctx, message)
+		if c != nil && inlineMethods[c.method] {
+			c, response = nil, sess.run(c)
+		}
+		if c != nil || response != nil {
+			entries = append(entries, entry{c, response})
+		}
+		pending = pending || c != nil
+	}
+
+	collect := func() interface{} {
+		responses := make([]interface{}, 0, len(entries))
+		for _, e := range entries {
+			if e.call != nil {
+				e.response = sess.run(e.call)
+			}
+			if e.response != nil {
+				responses = append(responses, e.response)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return responses
+	}
+
+	if !pending {
+		return collect(), nil
+	}
+	return nil, collect
+}
+
+// accept validates a single message. Notifications are handled straight away;
+// requests are checked against the lifecycle and registered as in flight.
+// Either the call to run or an error response is returned, or neither for a
+// notification or a response.
+func (sess *Session) accept(ctx context.Context, parsed gjson.Result) (*call, interface{}) {
+	// Responses to the server's own requests are never answered either
+	if isResponse(parsed) {
+		sess.handleResponse(parsed)
+		return nil, nil
+	}
+
+	idResult := parsed.Get("id")
+	if err := validateRequest(parsed); err != nil {
+		var id interface{}
+		if parsed.IsObject() && (idResult.Type == gjson.String || idResult.Type == gjson.Number) {
+			id = idResult.Value()
+		}
+		return nil, ErrorResponse(id, err)
+	}
+
+	method := parsed.Get("method").String()
+	id := idResult.Value()
+
+	// Notifications never get a response, not even an error
+	if !idResult.Exists() {
+		sess.handleNotification(method, parsed)
+		return nil, nil
+	}
+
+	if err := sess.beginRequest(method); err != nil {
+		return nil, ErrorResponse(id, err)
+	}
+
+	c := &call{
+		key:    requestKey(idResult),
+		id:     id,
+		method: method,
+		parsed: parsed,
+	}
+	c.ctx, c.cancel = context.WithCancel(withSession(ctx, sess))
+
+	sess.inflightMu.Lock()
+	defer sess.inflightMu.Unlock()
+
+	if _, exists := sess.inflight[c.key]; exists {
+		c.cancel()
+		return nil, ErrorResponse(id, newRPCError(CodeInvalidRequest, "invalid request: id %s is already in use by a request in progress", idResult.Raw))
+	}
+	sess.inflight[c.key] = c
+	return c, nil
+}
+
+// run handles an accepted call and builds its response. A call cancelled by
+// the client gets no response, as the spec asks.
+func (sess *Session) run(c *call) interface{} {
+	defer func() {
+		sess.inflightMu.Lock()
+		delete(sess.inflight, c.key)
+		sess.inflightMu.Unlock()
+		c.cancel()
+	}()
+
+	response, err := sess.server.HandleRequestContext(c.ctx, c.parsed.Raw)
+	if c.ctx.Err() != nil {
+		log.Printf("Request %v (%s) was cancelled", c.id, c.method)
+		return nil
+	}
+	if err != nil {
+		return ErrorResponse(c.id, err)
+	}
+	return response
+}
+
+// cancelRequest cancels the in-flight request with the given ID, if any.
+// initialize cannot be cancelled.
+func (sess *Session) cancelRequest(id gjson.Result) bool {
+	sess.inflightMu.Lock()
+	defer sess.inflightMu.Unlock()
+
+	c, ok := sess.inflight[requestKey(id)]
+	if !ok || c.method == "initialize" {
+		return false
+	}
+	c.cancel()
+	return true
+}
+
+// inflightCount returns the number of requests that have been accepted but not answered yet
+func (sess *Session) inflightCount() int {
+	sess.inflightMu.Lock()
+	defer sess.inflightMu.Unlock()
+
+	return len(sess.inflight)
+}
+
+// requestKey identifies a request by its ID. String and number IDs are kept
+// apart, so "1" and 1 are different requests.
+func requestKey(id gjson.Result) string {
+	if id.Type == gjson.String {
+		return "s:" + id.String()
+	}
+	return "n:" + id.Raw
+}
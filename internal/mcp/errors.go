@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+// JSON-RPC 2.0 error codes, plus the MCP-specific ones
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeResourceNotFound = -32002
+)
+
+// RPCError is a protocol-level error that is sent to the client as a JSON-RPC error object
+type RPCError struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+func newRPCError(code int, format string, args ...interface{}) *RPCError {
+	return &RPCError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func invalidParams(format string, args ...interface{}) *RPCError {
+	return newRPCError(CodeInvalidParams, format, args...)
+}
+
+// errorData extracts structured details, such as the Koneksi API status, from err
+func errorData(err error) map[string]interface{} {
+	var apiErr *koneksi.APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+
+	data := map[string]interface{}{
+		"httpStatus": apiErr.StatusCode,
+	}
+	if apiErr.Code != "" {
+		data["koneksiCode"] = apiErr.Code
+	}
+	if apiErr.Message != "" {
+		data["koneksiMessage"] = apiErr.Message
+	}
+	return data
+}
+
+// ErrorResponse builds the JSON-RPC error response for err. Errors that are
+// not an *RPCError are reported as internal errors.
+func ErrorResponse(id interface{}, err error) map[string]interface{} {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		rpcErr = &RPCError{
+			Code:    CodeInternalError,
+			Message: err.Error(),
+			Data:    errorData(err),
+		}
+	}
+
+	errObj := map[string]interface{}{
+		"code":    rpcErr.Code,
+		"message": rpcErr.Message,
+	}
+	if rpcErr.Data != nil {
+		errObj["data"] = rpcErr.Data
+	}
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   errObj,
+	}
+}
+
+// toolError turns a failed tool execution into a result with isError set, so
+// the model sees what went wrong and can react to it
+func toolError(err error) map[string]interface{} {
+	text := err.Error()
+	if data := errorData(err); data != nil {
+		text += fmt.Sprintf("\n(HTTP status %v", data["httpStatus"])
+		if code, ok := data["koneksiCode"]; ok {
+			text += fmt.Sprintf(", Koneksi error code %v", code)
+		}
+		text += ")"
+	}
+
+	return map[string]interface{}{
+		"content": []map[string]interface{}{
+			{
+				"type": "text",
+				"text": text,
+			},
+		},
+		"isError": true,
+	}
+}
@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func errorObject(t *testing.T, response interface{}) map[string]interface{} {
+	t.Helper()
+
+	respMap, ok := response.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected response to be a map, got %T", response)
+	}
+	errObj, ok := respMap["error"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected an error response, got %v", respMap)
+	}
+	return errObj
+}
+
+func TestServer_HandleMessage_ErrorCodes(t *testing.T) {
+	server := newInitializedServer(t, nil)
+
+	tests := []struct {
+		name       string
+		message    string
+		code       int
+		expectedID interface{}
+	}{
+		{"parse error", `{"jsonrpc":"2.0","id":1,`, CodeParseError, nil},
+		{"not an object", `"hello"`, CodeInvalidRequest, nil},
+		{"missing jsonrpc", `{"id":2,"method":"tools/list"}`, CodeInvalidRequest, float64(2)},
+		{"missing method", `{"jsonrpc":"2.0","id":3}`, CodeInvalidRequest, float64(3)},
+		{"unknown method", `{"jsonrpc":"2.0","id":"abc","method":"nope"}`, CodeMethodNotFound, "abc"},
+		{"unknown tool", `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"nope"}}`, CodeInvalidParams, float64(4)},
+		{"missing tool argument", `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"read_file","arguments":{}}}`, CodeInvalidParams, float64(5)},
+		{"bad resource URI", `{"jsonrpc":"2.0","id":6,"method":"resources/read","params":{"uri":"http://x"}}`, CodeInvalidParams, float64(6)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := server.HandleMessage(tt.message)
+			errObj := errorObject(t, response)
+
+			if errObj["code"] != tt.code {
+				t.Errorf("Expected code %d, got %v", tt.code, errObj["code"])
+			}
+			if id := response.(map[string]interface{})["id"]; id != tt.expectedID {
+				t.Errorf("Expected id %v, got %v", tt.expectedID, id)
+			}
+		})
+	}
+}
+
+func TestServer_HandleMessage_Notification(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	if response := server.HandleMessage(`{"jsonrpc":"2.0","method":"unknown/notification"}`); response != nil {
+		t.Errorf("Expected no response for a notification, got %v", response)
+	}
+}
+
+func TestServer_ToolExecutionError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"status":"error","code":"QUOTA_EXCEEDED","message":"storage quota exceeded"}`))
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := newInitializedServer(t, client)
+
+	response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"create_directory","arguments":{"name":"x"}}}`)
+	result, ok := response.(map[string]interface{})["result"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a tool result rather than a JSON-RPC error, got %v", response)
+	}
+	if result["isError"] != true {
+		t.Error("Expected isError to be true")
+	}
+
+	text := result["content"].([]map[string]interface{})[0]["text"].(string)
+	if !strings.Contains(text, "storage quota exceeded") || !strings.Contains(text, "QUOTA_EXCEEDED") || !strings.Contains(text, "403") {
+		t.Errorf("Expected failure details in the result text, got %s", text)
+	}
+}
+
+func TestServer_ErrorData(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"FILE_NOT_FOUND","message":"no such file"}`))
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := newInitializedServer(t, client)
+
+	response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"koneksi://file/missing"}}`)
+	errObj := errorObject(t, response)
+
+	if errObj["code"] != CodeResourceNotFound {
+		t.Errorf("Expected code %d, got %v", CodeResourceNotFound, errObj["code"])
+	}
+
+	data, ok := errObj["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected structured error data, got %v", errObj["data"])
+	}
+	if data["httpStatus"] != http.StatusNotFound || data["koneksiCode"] != "FILE_NOT_FOUND" || data["uri"] != "koneksi://file/missing" {
+		t.Errorf("Unexpected error data %v", data)
+	}
+}
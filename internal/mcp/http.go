@@ -0,0 +1,693 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// DefaultSessionTimeout is how long an HTTP session may sit idle before it
+// is ended, unless configured otherwise
+const DefaultSessionTimeout = 30 * time.Minute
+
+const (
+	sessionIDHeader       = "Mcp-Session-Id"
+	protocolVersionHeader = "Mcp-Protocol-Version"
+	lastEventIDHeader     = "Last-Event-ID"
+)
+
+// eventHistoryBytes is how much of its recent events an HTTP session keeps,
+// so clients can resume a stream after losing the connection. The newest
+// event is kept even if it is larger.
+var eventHistoryBytes = 8 << 20
+
+// maxSweepInterval is the longest time between two looks for idle HTTP
+// sessions to end
+var maxSweepInterval = time.Minute
+
+// keepAliveInterval is how often an idle event stream gets an SSE comment, so
+// proxies do not close it
+var keepAliveInterval = 30 * time.Second
+
+// HTTPOptions configures the HTTP transport. Zero values select the defaults.
+type HTTPOptions struct {
+	// Workers is how many requests may run at the same time, across all sessions
+	Workers int
+	// MaxMessageSize is the largest request body in bytes. Larger bodies are
+	// answered with 413 and a JSON-RPC error.
+	MaxMessageSize int
+	// SessionTimeout is how long a session may go without requests or open
+	// streams before it is ended
+	SessionTimeout time.Duration
+	// AllowedOrigins lists the browser origins, e.g. https://app.example.com,
+	// that may call the server. Pages served from localhost are always
+	// allowed and "*" allows any origin.
+	AllowedOrigins []string
+	// Auth, when set, requires every request to carry an OAuth bearer token
+	// with the scopes for what it does
+	Auth *Authorizer
+}
+
+// HTTPHandler serves the MCP Streamable HTTP transport on a single endpoint.
+// Clients POST JSON-RPC messages and get the response as JSON, or as an SSE
+// stream that also carries the request's progress notifications. GET opens
+// a stream for notifications the server sends on its own, such as resource
+// updates, and DELETE ends the session. Every client gets its own Session,
+// identified by the Mcp-Session-Id header assigned on initialize.
+type HTTPHandler struct {
+	server *Server
+	opts   HTTPOptions
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHTTPHandler creates the HTTP transport for server
+func NewHTTPHandler(server *Server, opts HTTPOptions) *HTTPHandler {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if opts.SessionTimeout <= 0 {
+		opts.SessionTimeout = DefaultSessionTimeout
+	}
+
+	h := &HTTPHandler{
+		server:   server,
+		opts:     opts,
+		slots:    make(chan struct{}, opts.Workers),
+		sessions: make(map[string]*httpSession),
+		stop:     make(chan struct{}),
+	}
+	go h.expireSessions()
+	return h
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers send Origin; checking it stops other sites from reaching a
+	// server on localhost through DNS rebinding
+	if !allowOrigin(r.Header.Get("Origin"), h.opts.AllowedOrigins) {
+		writeHTTPError(w, http.StatusForbidden, "origin %q is not allowed", r.Header.Get("Origin"))
+		return
+	}
+	if version := r.Header.Get(protocolVersionHeader); version != "" && !isSupportedProtocolVersion(version) {
+		writeHTTPError(w, http.StatusBadRequest, "unsupported protocol version %q", version)
+		return
+	}
+	info, ok := h.opts.Auth.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.handlePost(w, r, info)
+	case http.MethodGet:
+		h.handleGet(w, r, info)
+	case http.MethodDelete:
+		h.handleDelete(w, r, info)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeHTTPError(w, http.StatusMethodNotAllowed, "method %s is not allowed", r.Method)
+	}
+}
+
+// Close ends every session
+func (h *HTTPHandler) Close() {
+	h.closeOnce.Do(func() { close(h.stop) })
+
+	h.mu.Lock()
+	sessions := h.sessions
+	h.sessions = make(map[string]*httpSession)
+	h.mu.Unlock()
+
+	for _, hs := range sessions {
+		hs.close()
+	}
+}
+
+func (h *HTTPHandler) handlePost(w http.ResponseWriter, r *http.Request, info *AuthInfo) {
+	message, ok := readMessage(w, r, h.opts.MaxMessageSize)
+	if !ok || !h.opts.Auth.authorize(w, info, h.server.requiredPermissions(message)) {
+		return
+	}
+
+	// Only initialize may come without a session, and it starts a new one
+	var hs *httpSession
+	if r.Header.Get(sessionIDHeader) == "" {
+		parsed := gjson.Parse(message)
+		if !parsed.IsObject() || parsed.Get("method").String() != "initialize" {
+			writeHTTPError(w, http.StatusBadRequest, "missing %s header, send initialize first", sessionIDHeader)
+			return
+		}
+		hs = h.newSession(info)
+	} else if hs = h.lookupSession(w, r, info); hs == nil {
+		return
+	}
+	hs.touch()
+
+	streaming := acceptsEventStream(r)
+	var stream int
+	ctx := context.Background()
+	if streaming {
+		stream = hs.openStream()
+		ctx = withRequestNotifier(ctx, hs.sender(stream))
+	} else {
+		// Without a stream there is nowhere to send progress to, but requests
+		// to the client, such as elicitations, can still go out on the
+		// standalone stream
+		standalone := hs.sender(0)
+		ctx = withRequestNotifier(ctx, func(message interface{}) error {
+			if m, ok := message.(map[string]interface{}); ok && m["id"] != nil {
+				return standalone(message)
+			}
+			return nil
+		})
+	}
+
+	response, run := hs.session.acceptMessage(ctx, message)
+	if run == nil {
+		if streaming {
+			hs.closeStream(stream)
+		}
+		if r.Header.Get(sessionIDHeader) == "" {
+			if !h.startSession(hs, response) {
+				hs.close()
+			} else {
+				w.Header().Set(sessionIDHeader, hs.id)
+			}
+		}
+		writeResponse(w, response)
+		return
+	}
+
+	if !streaming {
+		h.slots <- struct{}{}
+		response = run()
+		<-h.slots
+		writeResponse(w, response)
+		return
+	}
+
+	// The request keeps running if the client disconnects; the client can
+	// pick the stream up again with GET and Last-Event-ID
+	go func() {
+		h.slots <- struct{}{}
+		response := run()
+		<-h.slots
+
+		if response != nil {
+			hs.sender(stream)(response)
+		}
+		hs.closeStream(stream)
+	}()
+	hs.serveEvents(w, r, stream, 0)
+}
+
+func (h *HTTPHandler) handleGet(w http.ResponseWriter, r *http.Request, info *AuthInfo) {
+	if !acceptsEventStream(r) {
+		writeHTTPError(w, http.StatusNotAcceptable, "GET opens an event stream, accept text/event-stream")
+		return
+	}
+	hs := h.lookupSession(w, r, info)
+	if hs == nil {
+		return
+	}
+
+	// Resume the stream the last event came from, or start following the
+	// notifications sent from now on
+	stream, after, ok := parseEventID(r.Header.Get(lastEventIDHeader))
+	if !ok {
+		stream, after = 0, hs.lastSeq()
+	}
+	hs.serveEvents(w, r, stream, after)
+}
+
+func (h *HTTPHandler) handleDelete(w http.ResponseWriter, r *http.Request, info *AuthInfo) {
+	hs := h.lookupSession(w, r, info)
+	if hs == nil {
+		return
+	}
+
+	h.mu.Lock()
+	delete(h.sessions, hs.id)
+	h.mu.Unlock()
+
+	hs.close()
+	log.Printf("Ended HTTP session %s", hs.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newSession creates a session for an initialize request made by info. It is
+// only registered by startSession once initialize has succeeded.
+func (h *HTTPHandler) newSession(info *AuthInfo) *httpSession {
+	hs := &httpSession{
+		id:       newSessionID(),
+		owner:    info.owner(),
+		session:  h.server.NewSession(),
+		open:     map[int]bool{0: true},
+		writers:  make(map[int]int),
+		changed:  make(chan struct{}),
+		lastSeen: time.Now(),
+	}
+	hs.session.profile = h.server.identityProfile(info)
+	hs.session.remote = true
+	hs.session.SetNotifier(hs.sender(0))
+	return hs
+}
+
+// startSession registers hs if the response to its initialize request was a
+// success
+func (h *HTTPHandler) startSession(hs *httpSession, response interface{}) bool {
+	if m, ok := response.(map[string]interface{}); !ok || m["error"] != nil {
+		return false
+	}
+
+	h.mu.Lock()
+	h.sessions[hs.id] = hs
+	h.mu.Unlock()
+
+	log.Printf("Started HTTP session %s", hs.id)
+	return true
+}
+
+// expireSessions ends the sessions that have been idle for longer than the
+// session timeout, until the handler is closed
+func (h *HTTPHandler) expireSessions() {
+	interval := h.opts.SessionTimeout
+	if interval > maxSweepInterval {
+		interval = maxSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			h.endIdleSessions(now)
+		}
+	}
+}
+
+func (h *HTTPHandler) endIdleSessions(now time.Time) {
+	var expired []*httpSession
+	h.mu.Lock()
+	for id, hs := range h.sessions {
+		if hs.idleSince(now) > h.opts.SessionTimeout {
+			delete(h.sessions, id)
+			expired = append(expired, hs)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, hs := range expired {
+		log.Printf("Ending idle HTTP session %s", hs.id)
+		hs.close()
+	}
+}
+
+// lookupSession returns the session named by the request's Mcp-Session-Id
+// header, or writes an error and returns nil. Sessions can only be used by
+// whoever started them.
+func (h *HTTPHandler) lookupSession(w http.ResponseWriter, r *http.Request, info *AuthInfo) *httpSession {
+	id := r.Header.Get(sessionIDHeader)
+	if id == "" {
+		writeHTTPError(w, http.StatusBadRequest, "missing %s header", sessionIDHeader)
+		return nil
+	}
+
+	h.mu.Lock()
+	hs := h.sessions[id]
+	h.mu.Unlock()
+
+	if hs == nil || hs.owner != info.owner() {
+		// The client has to start over with initialize
+		writeHTTPError(w, http.StatusNotFound, "session %s not found", id)
+		return nil
+	}
+	return hs
+}
+
+// allowOrigin reports whether a browser page from origin may use the server.
+// Requests without an Origin do not come from a browser page.
+func allowOrigin(origin string, allowedOrigins []string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpSession is a Session reached over HTTP, with the SSE streams its
+// messages are sent on. Stream 0 is the one opened with GET; every POST
+// answered with a stream gets its own. Recent events are kept so a client
+// can resume a stream with Last-Event-ID after losing the connection, up to
+// eventHistoryBytes of them; a POST stream's events are dropped once its
+// response has been delivered.
+type httpSession struct {
+	id      string
+	owner   string
+	session *Session
+
+	mu         sync.Mutex
+	seq        int64
+	events     []sseEvent
+	eventBytes int
+	nextStream int
+	// open holds the streams that may still get events
+	open map[int]bool
+	// writers holds the generation of the connection writing each stream;
+	// a client reconnecting to a stream takes it over from the old one
+	writers    map[int]int
+	generation int
+	// changed is closed and replaced whenever something above changes
+	changed  chan struct{}
+	conns    int
+	lastSeen time.Time
+	closed   bool
+}
+
+type sseEvent struct {
+	stream int
+	seq    int64
+	data   []byte
+}
+
+// sender returns the function that sends messages on stream
+func (hs *httpSession) sender(stream int) func(message interface{}) error {
+	return func(message interface{}) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+
+		if hs.closed || !hs.open[stream] {
+			return nil
+		}
+		hs.seq++
+		hs.events = append(hs.events, sseEvent{stream: stream, seq: hs.seq, data: data})
+		hs.eventBytes += len(data)
+		dropped := 0
+		for hs.eventBytes > eventHistoryBytes && dropped < len(hs.events)-1 {
+			hs.eventBytes -= len(hs.events[dropped].data)
+			dropped++
+		}
+		hs.events = hs.events[dropped:]
+		hs.broadcast()
+		return nil
+	}
+}
+
+func (hs *httpSession) openStream() int {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.nextStream++
+	hs.open[hs.nextStream] = true
+	return hs.nextStream
+}
+
+// closeStream marks a POST stream as complete once its response is sent
+func (hs *httpSession) closeStream(stream int) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	delete(hs.open, stream)
+	hs.broadcast()
+}
+
+// delivered drops the events of a complete stream once they have all been
+// written to the client
+func (hs *httpSession) delivered(stream int) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.open[stream] {
+		return
+	}
+	kept := hs.events[:0]
+	for _, event := range hs.events {
+		if event.stream == stream {
+			hs.eventBytes -= len(event.data)
+			continue
+		}
+		kept = append(kept, event)
+	}
+	for i := len(kept); i < len(hs.events); i++ {
+		hs.events[i] = sseEvent{}
+	}
+	hs.events = kept
+}
+
+func (hs *httpSession) lastSeq() int64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	return hs.seq
+}
+
+func (hs *httpSession) touch() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.lastSeen = time.Now()
+}
+
+// idleSince returns how long the session has had no requests and no open
+// connections
+func (hs *httpSession) idleSince(now time.Time) time.Duration {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.conns > 0 || hs.session.inflightCount() > 0 {
+		return 0
+	}
+	return now.Sub(hs.lastSeen)
+}
+
+// close ends the session and the streams being written
+func (hs *httpSession) close() {
+	hs.mu.Lock()
+	hs.closed = true
+	hs.open = make(map[int]bool)
+	hs.broadcast()
+	hs.mu.Unlock()
+
+	hs.session.Close()
+}
+
+func (hs *httpSession) broadcast() {
+	close(hs.changed)
+	hs.changed = make(chan struct{})
+}
+
+// serveEvents writes the events of stream that come after sequence number
+// after, until the stream is complete, the client disconnects or another
+// connection takes the stream over
+func (hs *httpSession) serveEvents(w http.ResponseWriter, r *http.Request, stream int, after int64) {
+	hs.mu.Lock()
+	hs.generation++
+	generation := hs.generation
+	hs.writers[stream] = generation
+	hs.conns++
+	hs.broadcast()
+	hs.mu.Unlock()
+
+	defer func() {
+		hs.mu.Lock()
+		if hs.writers[stream] == generation {
+			delete(hs.writers, stream)
+		}
+		hs.conns--
+		hs.lastSeen = time.Now()
+		hs.mu.Unlock()
+	}()
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(sessionIDHeader, hs.id)
+	w.WriteHeader(http.StatusOK)
+	flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		hs.mu.Lock()
+		current := hs.writers[stream] == generation
+		open := hs.open[stream]
+		changed := hs.changed
+		var pending []sseEvent
+		for _, event := range hs.events {
+			if event.stream == stream && event.seq > after {
+				pending = append(pending, event)
+			}
+		}
+		hs.mu.Unlock()
+
+		if !current {
+			return
+		}
+		for _, event := range pending {
+			if _, err := fmt.Fprintf(w, "id: %d-%d\ndata: %s\n\n", stream, event.seq, event.data); err != nil {
+				return
+			}
+			after = event.seq
+		}
+		flush()
+		if !open {
+			hs.delivered(stream)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// readMessage reads the JSON-RPC message POSTed in r, or writes an error and
+// returns false
+func readMessage(w http.ResponseWriter, r *http.Request, max int) (string, bool) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+			writeHTTPError(w, http.StatusUnsupportedMediaType, "content type must be application/json")
+			return "", false
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, int64(max)+1))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, "reading request body: %v", err)
+		return "", false
+	}
+	if len(body) > max {
+		size := len(body)
+		if r.ContentLength > int64(size) {
+			size = int(r.ContentLength)
+		}
+		log.Printf("Rejecting a message of %d bytes, the limit is %d", size, max)
+		writeJSON(w, http.StatusRequestEntityTooLarge, messageTooLarge(body, size, max))
+		return "", false
+	}
+	return string(body), true
+}
+
+// parseEventID splits an event ID of the form stream-seq
+func parseEventID(id string) (int, int64, bool) {
+	streamPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	stream, err := strconv.Atoi(streamPart)
+	if err != nil || stream < 0 {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, 0, false
+	}
+	return stream, seq, true
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == "text/event-stream" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("generating session ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeResponse answers a POST with the JSON-RPC response, or with 202 when
+// the message only held notifications. Errors that cannot be matched to a
+// request, such as a parse error, also get 400.
+func writeResponse(w http.ResponseWriter, response interface{}) {
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	status := http.StatusOK
+	if m, ok := response.(map[string]interface{}); ok && m["error"] != nil && m["id"] == nil {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, response)
+}
+
+// writeHTTPError answers with a JSON-RPC error for problems with the HTTP
+// request itself
+func writeHTTPError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, ErrorResponse(nil, newRPCError(CodeInvalidRequest, format, args...)))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
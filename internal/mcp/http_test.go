@@ -0,0 +1,444 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+const acceptBoth = "application/json, text/event-stream"
+
+// httpTestServer runs an HTTPHandler for server on a test HTTP server
+func httpTestServer(t *testing.T, server *Server, opts HTTPOptions) string {
+	t.Helper()
+
+	handler := NewHTTPHandler(server, opts)
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		handler.Close()
+		httpServer.Close()
+	})
+	return httpServer.URL
+}
+
+func httpRequest(t *testing.T, method, url, sessionID, accept, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if sessionID != "" {
+		req.Header.Set(sessionIDHeader, sessionID)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	return resp
+}
+
+// postJSON sends a message and decodes the JSON answer, checking the status
+func postJSON(t *testing.T, url, sessionID, body string, wantStatus int) (map[string]interface{}, *http.Response) {
+	t.Helper()
+
+	resp := httpRequest(t, http.MethodPost, url, sessionID, "application/json", body)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected status %d, got %d: %s", wantStatus, resp.StatusCode, data)
+	}
+
+	var message map[string]interface{}
+	if resp.StatusCode != http.StatusAccepted {
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return message, resp
+}
+
+// initializeHTTP starts a session and returns its ID
+func initializeHTTP(t *testing.T, url, version string) string {
+	t.Helper()
+
+	message, resp := postJSON(t, url, "", `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"`+version+`"}}`, http.StatusOK)
+	sessionID := resp.Header.Get(sessionIDHeader)
+	if sessionID == "" {
+		t.Fatalf("Expected a session ID, got response %v", message)
+	}
+	postJSON(t, url, sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`, http.StatusAccepted)
+	return sessionID
+}
+
+type testEvent struct {
+	id      string
+	message map[string]interface{}
+}
+
+// readEvents parses an SSE stream, sending each event on the returned channel
+func readEvents(t *testing.T, body io.Reader) <-chan testEvent {
+	events := make(chan testEvent, 100)
+	go func() {
+		defer close(events)
+
+		var event testEvent
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.message); err != nil {
+					t.Errorf("Failed to parse event data %q: %v", line, err)
+				}
+			case line == "" && event.message != nil:
+				events <- event
+				event = testEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan testEvent) testEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("Expected an event, but the stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return testEvent{}
+}
+
+func TestHTTPHandler_Sessions(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient("http://localhost", "test-id", "test-secret", ""))
+	url := httpTestServer(t, server, HTTPOptions{})
+
+	first := initializeHTTP(t, url, "2024-11-05")
+	second := initializeHTTP(t, url, "2025-06-18")
+	if first == second {
+		t.Fatalf("Expected different session IDs, got %q twice", first)
+	}
+
+	// Requests need a known session
+	postJSON(t, url, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusBadRequest)
+	postJSON(t, url, "unknown", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusNotFound)
+
+	message, _ := postJSON(t, url, first, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, http.StatusOK)
+	if _, ok := message["result"].(map[string]interface{})["tools"]; !ok {
+		t.Errorf("Expected a tools/list result, got %v", message)
+	}
+
+	// Each session has its own lifecycle
+	message, _ = postJSON(t, url, first, `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{}}`, http.StatusOK)
+	if code := errorObject(t, message)["code"]; code != float64(CodeInvalidRequest) {
+		t.Errorf("Expected a second initialize to fail with %d, got %v", CodeInvalidRequest, code)
+	}
+
+	// Ending a session leaves the other one alone
+	resp := httpRequest(t, http.MethodDelete, url, first, "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected DELETE to return 204, got %d", resp.StatusCode)
+	}
+	postJSON(t, url, first, `{"jsonrpc":"2.0","id":3,"method":"ping"}`, http.StatusNotFound)
+	postJSON(t, url, second, `{"jsonrpc":"2.0","id":3,"method":"ping"}`, http.StatusOK)
+
+	// A failed initialize does not start a session
+	message, resp = postJSON(t, url, "", `{"jsonrpc":"1.0","id":4,"method":"initialize","params":{}}`, http.StatusOK)
+	if id := resp.Header.Get(sessionIDHeader); id != "" || message["error"] == nil {
+		t.Errorf("Expected an error and no session for a failed initialize, got %q and %v", id, message)
+	}
+}
+
+func TestHTTPHandler_StreamedResponse(t *testing.T) {
+	const size = 1 << 20
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(make([]byte, size))
+	}))
+	defer mockServer.Close()
+
+	defer func(old time.Duration) { progressInterval = old }(progressInterval)
+	progressInterval = 0
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	url := httpTestServer(t, server, HTTPOptions{})
+	sessionID := initializeHTTP(t, url, "2025-06-18")
+
+	outputPath := filepath.Join(t.TempDir(), "big.bin")
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":"big","outputPath":%q},"_meta":{"progressToken":"dl"}}}`, outputPath)
+	resp := httpRequest(t, http.MethodPost, url, sessionID, acceptBoth, body)
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", contentType)
+	}
+
+	var messages []map[string]interface{}
+	var ids []string
+	for event := range readEvents(t, resp.Body) {
+		messages = append(messages, event.message)
+		ids = append(ids, event.id)
+	}
+
+	if len(messages) < 2 {
+		t.Fatalf("Expected progress and the response, got %v", messages)
+	}
+	for _, message := range messages[:len(messages)-1] {
+		if message["method"] != "notifications/progress" {
+			t.Errorf("Expected progress notifications before the response, got %v", message)
+		}
+	}
+	if response := messages[len(messages)-1]; response["id"] != float64(5) || response["result"] == nil {
+		t.Errorf("Expected the response last, got %v", response)
+	}
+	for i, id := range ids {
+		stream, seq, ok := parseEventID(id)
+		if !ok || stream != 1 || (i > 0 && seq <= mustSeq(ids[i-1])) {
+			t.Errorf("Unexpected event ID %q after %v", id, ids[:i])
+		}
+	}
+
+	// Clients that only accept JSON get a plain response
+	message, resp := postJSON(t, url, sessionID, strings.Replace(body, `"id":5`, `"id":6`, 1), http.StatusOK)
+	if message["id"] != float64(6) || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a JSON response, got %v", message)
+	}
+}
+
+func mustSeq(id string) int64 {
+	_, seq, _ := parseEventID(id)
+	return seq
+}
+
+func TestHTTPHandler_ResumeStream(t *testing.T) {
+	release := make(chan struct{})
+	server := NewServer("test-server", "1.0.0", blockingStorage(t, release, func(int) {}))
+	url := httpTestServer(t, server, HTTPOptions{})
+	sessionID := initializeHTTP(t, url, "2025-06-18")
+
+	// The client disconnects while the request runs
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"create_directory","arguments":{"name":"slow"}}}`))
+	req.Header.Set(sessionIDHeader, sessionID)
+	req.Header.Set("Accept", acceptBoth)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	close(release)
+
+	// The response is still delivered when the client resumes the stream
+	req, _ = http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(sessionIDHeader, sessionID)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(lastEventIDHeader, "1-0")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	event := nextEvent(t, readEvents(t, resp.Body))
+	if event.message["id"] != float64(1) || event.message["result"] == nil {
+		t.Errorf("Expected the create_directory response, got %v", event.message)
+	}
+}
+
+func TestHTTPHandler_NotificationStream(t *testing.T) {
+	var mu sync.Mutex
+	files := []map[string]interface{}{{"id": "file1", "name": "notes.md", "size": 10, "hash": "h1"}}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if strings.HasSuffix(r.URL.Path, "/directories/root") {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"directory": map[string]interface{}{"id": "root", "name": "root"},
+					"files":     files,
+				},
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	srv := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	url := httpTestServer(t, srv, HTTPOptions{})
+	sessionID := initializeHTTP(t, url, "2025-06-18")
+
+	// Only sessions that listed resources are told the listing changed
+	httpRequest(t, http.MethodPost, url, sessionID, "application/json", `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`).Body.Close()
+
+	poll := func(name string) {
+		t.Helper()
+		mu.Lock()
+		files = append(files, map[string]interface{}{"id": name, "name": name, "size": 1, "hash": name})
+		mu.Unlock()
+		if err := srv.pollResources(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	poll("baseline")
+
+	resp := httpRequest(t, http.MethodGet, url, sessionID, "text/event-stream", "")
+	events := readEvents(t, resp.Body)
+
+	poll("added")
+	event := nextEvent(t, events)
+	if event.message["method"] != "notifications/resources/list_changed" {
+		t.Fatalf("Expected list_changed on the GET stream, got %v", event.message)
+	}
+	resp.Body.Close()
+
+	// Notifications sent while disconnected are replayed on resume
+	poll("added-offline")
+	time.Sleep(10 * time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(sessionIDHeader, sessionID)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(lastEventIDHeader, event.id)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	replayed := nextEvent(t, readEvents(t, resp.Body))
+	if replayed.message["method"] != "notifications/resources/list_changed" || replayed.id == event.id {
+		t.Errorf("Expected the missed list_changed to be replayed, got %v (%s)", replayed.message, replayed.id)
+	}
+}
+
+func TestHTTPHandler_RejectedRequests(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient("http://localhost", "test-id", "test-secret", ""))
+	url := httpTestServer(t, server, HTTPOptions{MaxMessageSize: 1024, AllowedOrigins: []string{"https://app.example.com"}})
+	sessionID := initializeHTTP(t, url, "2025-06-18")
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{"foreign origin", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusForbidden},
+		{"allowed origin", http.MethodPost, map[string]string{"Origin": "https://app.example.com"}, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusOK},
+		{"localhost origin", http.MethodPost, map[string]string{"Origin": "http://localhost:3000"}, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusOK},
+		{"unsupported protocol version", http.MethodPost, map[string]string{protocolVersionHeader: "1999-01-01"}, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusBadRequest},
+		{"content type", http.MethodPost, map[string]string{"Content-Type": "text/plain"}, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusUnsupportedMediaType},
+		{"parse error", http.MethodPost, nil, `{not json`, http.StatusBadRequest},
+		{"too large", http.MethodPost, nil, `{"jsonrpc":"2.0","id":9,"method":"ping","params":{"pad":"` + strings.Repeat("x", 2048) + `"}}`, http.StatusRequestEntityTooLarge},
+		{"GET without event stream", http.MethodGet, map[string]string{"Accept": "application/json"}, "", http.StatusNotAcceptable},
+		{"method", http.MethodPut, nil, "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, url, strings.NewReader(tt.body))
+			req.Header.Set(sessionIDHeader, sessionID)
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				data, _ := io.ReadAll(resp.Body)
+				t.Errorf("Expected status %d, got %d: %s", tt.status, resp.StatusCode, data)
+			}
+		})
+	}
+}
+
+func TestHTTPSession_EventHistory(t *testing.T) {
+	defer func(old int) { eventHistoryBytes = old }(eventHistoryBytes)
+	eventHistoryBytes = 100
+
+	handler := NewHTTPHandler(NewServer("test-server", "1.0.0", nil), HTTPOptions{})
+	defer handler.Close()
+	hs := handler.newSession(&AuthInfo{})
+	defer hs.close()
+
+	// Old events make room for new ones, but the newest is kept whatever its size
+	notify := hs.sender(0)
+	for i := 0; i < 10; i++ {
+		notify(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]interface{}{"n": i}})
+	}
+	if hs.eventBytes > eventHistoryBytes || hs.events[len(hs.events)-1].seq != 10 {
+		t.Errorf("Expected at most %d bytes ending with the last event, got %d bytes in %d events", eventHistoryBytes, hs.eventBytes, len(hs.events))
+	}
+	notify(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": map[string]interface{}{"text": strings.Repeat("x", 200)}})
+	if len(hs.events) != 1 || hs.events[0].seq != 11 {
+		t.Errorf("Expected only the large event to be kept, got %d events", len(hs.events))
+	}
+
+	// A response stream is forgotten once it has been written out
+	stream := hs.openStream()
+	hs.sender(stream)(map[string]interface{}{"jsonrpc": "2.0", "id": 2, "result": map[string]interface{}{}})
+	hs.closeStream(stream)
+
+	req := httptest.NewRequest(http.MethodGet, "/mcp", nil)
+	recorder := httptest.NewRecorder()
+	hs.serveEvents(recorder, req, stream, 0)
+	if !strings.Contains(recorder.Body.String(), `"id":2`) {
+		t.Fatalf("Expected the response to be written, got %q", recorder.Body.String())
+	}
+	for _, event := range hs.events {
+		if event.stream == stream {
+			t.Errorf("Expected the delivered response to be dropped, got event %d", event.seq)
+		}
+	}
+}
+
+func TestHTTPHandler_IdleSessions(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+	url := httpTestServer(t, server, HTTPOptions{SessionTimeout: 20 * time.Millisecond})
+	sessionID := initializeHTTP(t, url, "2025-06-18")
+
+	// Sessions are ended without waiting for another one to start
+	time.Sleep(100 * time.Millisecond)
+	postJSON(t, url, sessionID, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.StatusNotFound)
+}
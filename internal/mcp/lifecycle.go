@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"log"
+
+	"github.com/tidwall/gjson"
+)
+
+// lifecycleState tracks how far the client has got through the MCP
+// initialization handshake
+type lifecycleState int
+
+const (
+	// stateNew is the state before the initialize request; only initialize
+	// and ping are accepted
+	stateNew lifecycleState = iota
+	// stateInitializing follows the initialize response, until the client
+	// sends notifications/initialized
+	stateInitializing
+	// stateReady is normal operation
+	stateReady
+)
+
+func (st lifecycleState) String() string {
+	switch st {
+	case stateNew:
+		return "new"
+	case stateInitializing:
+		return "initializing"
+	default:
+		return "ready"
+	}
+}
+
+// Initialized reports whether the client has completed the initialization
+// handshake by sending notifications/initialized
+func (sess *Session) Initialized() bool {
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+
+	return sess.state == stateReady
+}
+
+// Initialized reports whether the client of the default session has
+// completed the initialization handshake
+func (s *Server) Initialized() bool {
+	return s.session.Initialized()
+}
+
+// beginRequest checks that method may be called in the current lifecycle
+// state. Requests sent after the initialize response but before
+// notifications/initialized are let through, as many clients pipeline them.
+func (sess *Session) beginRequest(method string) error {
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+
+	switch {
+	case method == "ping":
+		return nil
+	case method == "initialize":
+		if sess.state != stateNew {
+			return newRPCError(CodeInvalidRequest, "invalid request: server is already initialized")
+		}
+		sess.state = stateInitializing
+		return nil
+	case sess.state == stateNew:
+		return newRPCError(CodeInvalidRequest, "invalid request: server not initialized, send initialize first")
+	default:
+		return nil
+	}
+}
+
+// handleNotification processes a client notification. Unknown notifications
+// are ignored, as JSON-RPC requires.
+func (sess *Session) handleNotification(method string, parsed gjson.Result) {
+	switch method {
+	case "notifications/initialized":
+		sess.stateMu.Lock()
+		defer sess.stateMu.Unlock()
+
+		if sess.state != stateInitializing {
+			log.Printf("Ignoring notifications/initialized in state %s", sess.state)
+			return
+		}
+		sess.state = stateReady
+	case "notifications/cancelled":
+		// The request may well have finished already, which is not an error
+		requestID := parsed.Get("params.requestId")
+		if sess.cancelRequest(requestID) {
+			log.Printf("Cancelling request %s: %s", requestID.Raw, parsed.Get("params.reason").String())
+		}
+	case "notifications/roots/list_changed":
+		sess.forgetRoots()
+	default:
+		log.Printf("Ignoring unknown notification: %s", method)
+	}
+}
+
+func (s *Server) handlePing(id interface{}) (interface{}, error) {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  map[string]interface{}{},
+	}, nil
+}
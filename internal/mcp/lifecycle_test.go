@@ -0,0 +1,111 @@
+package mcp
+
+import (
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+// newInitializedServer returns a server that has completed the initialization handshake
+func newInitializedServer(t *testing.T, client *koneksi.Client) *Server {
+	t.Helper()
+
+	server := NewServer("test-server", "1.0.0", client)
+	if response := server.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{}}`); response == nil {
+		t.Fatal("Expected a response to initialize")
+	}
+	if response := server.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`); response != nil {
+		t.Fatalf("Expected no response to notifications/initialized, got %v", response)
+	}
+	return server
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	// Ping is answered at any time
+	response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if result, ok := response.(map[string]interface{})["result"].(map[string]interface{}); !ok || len(result) != 0 {
+		t.Errorf("Expected an empty ping result, got %v", response)
+	}
+
+	// Anything else is rejected before initialize
+	errObj := errorObject(t, server.HandleMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`))
+	if errObj["code"] != CodeInvalidRequest {
+		t.Errorf("Expected code %d before initialize, got %v", CodeInvalidRequest, errObj["code"])
+	}
+
+	// notifications/initialized is ignored until initialize has been answered
+	server.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if server.Initialized() {
+		t.Error("Expected the server not to be initialized before initialize")
+	}
+
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":3,"method":"initialize","params":{}}`)
+	if _, ok := response.(map[string]interface{})["result"]; !ok {
+		t.Fatalf("Expected an initialize result, got %v", response)
+	}
+	if server.Initialized() {
+		t.Error("Expected the server to wait for notifications/initialized")
+	}
+
+	server.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if !server.Initialized() {
+		t.Error("Expected the server to be initialized")
+	}
+
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":4,"method":"tools/list"}`)
+	if _, ok := response.(map[string]interface{})["result"]; !ok {
+		t.Errorf("Expected tools/list to succeed after initialization, got %v", response)
+	}
+
+	errObj = errorObject(t, server.HandleMessage(`{"jsonrpc":"2.0","id":5,"method":"initialize","params":{}}`))
+	if errObj["code"] != CodeInvalidRequest {
+		t.Errorf("Expected code %d for a second initialize, got %v", CodeInvalidRequest, errObj["code"])
+	}
+}
+
+func TestServer_HandleMessage_Batch(t *testing.T) {
+	server := newInitializedServer(t, nil)
+
+	response := server.HandleMessage(`[
+		{"jsonrpc":"2.0","id":1,"method":"ping"},
+		{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":9}},
+		{"jsonrpc":"2.0","id":2,"method":"nope"},
+		42
+	]`)
+
+	responses, ok := response.([]interface{})
+	if !ok {
+		t.Fatalf("Expected a batch response, got %T", response)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses (the notification gets none), got %d", len(responses))
+	}
+
+	if id := responses[0].(map[string]interface{})["id"]; id != float64(1) {
+		t.Errorf("Expected the ping response first, got id %v", id)
+	}
+	if errObj := errorObject(t, responses[1]); errObj["code"] != CodeMethodNotFound {
+		t.Errorf("Expected code %d, got %v", CodeMethodNotFound, errObj["code"])
+	}
+	if errObj := errorObject(t, responses[2]); errObj["code"] != CodeInvalidRequest {
+		t.Errorf("Expected code %d for a non-object entry, got %v", CodeInvalidRequest, errObj["code"])
+	}
+}
+
+func TestServer_HandleMessage_BatchEdgeCases(t *testing.T) {
+	server := newInitializedServer(t, nil)
+
+	if errObj := errorObject(t, server.HandleMessage(`[]`)); errObj["code"] != CodeInvalidRequest {
+		t.Errorf("Expected code %d for an empty batch, got %v", CodeInvalidRequest, errObj["code"])
+	}
+
+	if response := server.HandleMessage(`[{"jsonrpc":"2.0","method":"notifications/roots/list_changed"}]`); response != nil {
+		t.Errorf("Expected no response for a batch of notifications, got %v", response)
+	}
+
+	if errObj := errorObject(t, server.HandleMessage(`[{"jsonrpc":"2.0","id":1,"method":"ping"`)); errObj["code"] != CodeParseError {
+		t.Errorf("Expected code %d for a truncated batch, got %v", CodeParseError, errObj["code"])
+	}
+}
@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/koneksi/mcp-server/internal/secrets"
+)
+
+// SetReadOnly hides every tool that is not annotated read-only, which are
+// the tools that change Koneksi storage or local files, and refuses calls to
+// them. It is meant to be set before the server starts, for assistants that
+// may only browse.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.toolMu.Lock()
+	defer s.toolMu.Unlock()
+
+	s.readOnly = readOnly
+}
+
+// SetDryRun makes every call to a tool that stores something a dry run, as
+// if it had been called with dryRun set
+func (s *Server) SetDryRun(dryRun bool) {
+	s.toolMu.Lock()
+	defer s.toolMu.Unlock()
+
+	s.dryRun = dryRun
+}
+
+// toolAvailable reports whether a tool can be listed and called in the
+// server's mode
+func (s *Server) toolAvailable(info ToolInfo) bool {
+	s.toolMu.RLock()
+	defer s.toolMu.RUnlock()
+
+	return !s.readOnly || info.Annotations.ReadOnly
+}
+
+// isDryRun reports whether a call is a dry run, because it asked for one or
+// the server runs every call as one
+func (s *Server) isDryRun(requested bool) bool {
+	s.toolMu.RLock()
+	defer s.toolMu.RUnlock()
+
+	return requested || s.dryRun
+}
+
+// dryRunContent is the content of a dry run's result: what the call would
+// have done, one line per detail, then the transformations and secrets found
+func dryRunContent(lines, transformations []string, findings []secrets.Finding) []map[string]interface{} {
+	var b strings.Builder
+	b.WriteString("Dry run, nothing was changed.")
+	for _, line := range lines {
+		b.WriteString("\n")
+		b.WriteString(line)
+	}
+	if len(transformations) > 0 {
+		b.WriteString("\nTransformations:")
+		for _, t := range transformations {
+			fmt.Fprintf(&b, "\n- %s", t)
+		}
+	}
+	if len(findings) > 0 {
+		b.WriteString("\n\nSecrets found:" + formatFindings(findings))
+	}
+	return textContent(b.String())
+}
+
+// uploadTransformations lists what an upload would do to a file on the way:
+// the given ones, then redaction and the resolution of a name conflict
+func uploadTransformations(redacted bool, findings []secrets.Finding, conflict string, transformations ...string) []string {
+	if redacted {
+		transformations = append(transformations, fmt.Sprintf("%d secret(s) would be replaced by %s", len(findings), secrets.Mask))
+	}
+	if conflict != "" {
+		transformations = append(transformations, conflict)
+	}
+	return transformations
+}
+
+// hashReader returns the hex SHA-256 of everything left in r
+func hashReader(ctx context.Context, r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, contextReader{ctx, r}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func TestServer_ReadOnly(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+	server.SetReadOnly(true)
+
+	response, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, tool := range response.(map[string]interface{})["result"].(map[string]interface{})["tools"].([]map[string]interface{}) {
+		names = append(names, tool["name"].(string))
+	}
+	if got := strings.Join(names, ","); got != "read_file,list_directories,search_files" {
+		t.Errorf("Expected only the read-only tools to be listed, got %s", got)
+	}
+
+	for _, name := range []string{"upload_content", "create_directory", "backup_file", "download_file", "restore_backup"} {
+		_, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":%q,"arguments":{}}}`, name))
+		if err == nil || !strings.Contains(err.Error(), "the server is read-only") {
+			t.Errorf("%s: expected the call to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestServer_DryRun(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(source, []byte(strings.Repeat("hello world\n", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"data":{"files":[{"id":"f1","name":"notes.txt"}]}}`))
+			return
+		}
+		t.Errorf("Expected a dry run not to change anything, got %s %s", r.Method, r.URL.Path)
+	}))
+	defer mockServer.Close()
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	server.SetSecretPolicy(SecretsRedact)
+	server.SetConflictDefault(ConflictRename)
+	server.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	call := func(name, arguments string) (string, map[string]interface{}) {
+		response := server.HandleMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, name, arguments))
+		result := response.(map[string]interface{})["result"].(map[string]interface{})
+		if result["isError"] == true {
+			t.Fatalf("%s failed: %v", name, result["content"])
+		}
+
+		// Dry runs match the output schema too
+		tool, _ := server.lookupTool(name)
+		data, _ := json.Marshal(result["structuredContent"])
+		if err := validateArguments(tool.Info().OutputSchema, data); err != nil {
+			t.Errorf("%s: structured content %s does not match its schema: %v", name, data, err)
+		}
+		var structured map[string]interface{}
+		json.Unmarshal(data, &structured)
+		return resultText(t, response), structured
+	}
+
+	// Per call, with redaction and a name conflict
+	content := base64.StdEncoding.EncodeToString([]byte("API_TOKEN=s3cr3t-value-42\n"))
+	text, structured := call("upload_content", fmt.Sprintf(`{"fileName":"notes.txt","content":%q,"directoryId":"d1","dryRun":true}`, content))
+	for _, want := range []string{"Dry run, nothing was changed.", "Would upload: notes (1).txt", "Directory: d1", "Size: 21 bytes", "1 secret(s) would be replaced by [REDACTED]", "the upload would be stored as notes (1).txt"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("upload_content: expected %q in %q", want, text)
+		}
+	}
+	if structured["dryRun"] != true || structured["fileName"] != "notes (1).txt" || structured["fileId"] != nil || len(structured["transformations"].([]interface{})) != 2 {
+		t.Errorf("upload_content: unexpected structured content %v", structured)
+	}
+
+	// Globally, with the size of the compressed backup
+	server.SetDryRun(true)
+	text, structured = call("backup_file", fmt.Sprintf(`{"filePath":%q,"compress":true}`, source))
+	if !strings.Contains(text, "Would back up: "+source) || !strings.Contains(text, "File Name: notes.txt.gz") || !strings.Contains(text, "- compressed with gzip") {
+		t.Errorf("backup_file: unexpected report %q", text)
+	}
+	if size := structured["size"].(float64); size <= 0 || size >= 1200 || structured["originalSize"].(float64) != 1200 {
+		t.Errorf("backup_file: expected the compressed size, got %v", structured)
+	}
+
+	text, structured = call("create_directory", `{"name":"reports"}`)
+	if !strings.Contains(text, "Would create directory: reports") || structured["dryRun"] != true || structured["createdAt"] != nil {
+		t.Errorf("create_directory: unexpected result %q, %v", text, structured)
+	}
+
+	for _, request := range requests {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("Expected only directory listings, got %s", request)
+		}
+	}
+}
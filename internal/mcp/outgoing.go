@@ -0,0 +1,80 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/tidwall/gjson"
+)
+
+// request sends a request to the client and waits for its response. It goes
+// out the same way as the notifications about the request ctx belongs to, so
+// on HTTP it reaches the client on that request's stream. If ctx ends first,
+// the client is told the request was cancelled.
+func (sess *Session) request(ctx context.Context, method string, params map[string]interface{}) (gjson.Result, error) {
+	sess.outgoingMu.Lock()
+	sess.outgoingSeq++
+	id := fmt.Sprintf("koneksi-%d", sess.outgoingSeq)
+	key := "s:" + id
+	responses := make(chan gjson.Result, 1)
+	sess.outgoing[key] = responses
+	sess.outgoingMu.Unlock()
+
+	defer func() {
+		sess.outgoingMu.Lock()
+		delete(sess.outgoing, key)
+		sess.outgoingMu.Unlock()
+	}()
+
+	message := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+	}
+	if params != nil {
+		message["params"] = params
+	}
+	send := sess.requestNotifier(ctx)
+	if err := send(message); err != nil {
+		return gjson.Result{}, fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	select {
+	case response := <-responses:
+		if errObj := response.Get("error"); errObj.Exists() {
+			return gjson.Result{}, fmt.Errorf("%s failed: %s (code %d)", method, errObj.Get("message").String(), errObj.Get("code").Int())
+		}
+		return response.Get("result"), nil
+	case <-ctx.Done():
+		sendNotification(send, "notifications/cancelled", map[string]interface{}{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return gjson.Result{}, ctx.Err()
+	}
+}
+
+// isResponse reports whether a message is the client's response to a
+// request from the server rather than a request or notification
+func isResponse(parsed gjson.Result) bool {
+	return parsed.IsObject() && !parsed.Get("method").Exists() &&
+		(parsed.Get("result").Exists() || parsed.Get("error").Exists())
+}
+
+// handleResponse passes a response from the client to the request waiting
+// for it. Responses nothing waits for any more are dropped.
+func (sess *Session) handleResponse(parsed gjson.Result) {
+	id := parsed.Get("id")
+
+	sess.outgoingMu.Lock()
+	responses, ok := sess.outgoing[requestKey(id)]
+	delete(sess.outgoing, requestKey(id))
+	sess.outgoingMu.Unlock()
+
+	if !ok {
+		log.Printf("Ignoring response to unknown request %s", id.Raw)
+		return
+	}
+	responses <- parsed
+}
@@ -0,0 +1,378 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ToolProfiles are named sets of tools for the different purposes a server
+// is run for. They are read from a JSON file:
+//
+//	{
+//	  "default": "research",
+//	  "profiles": {
+//	    "backup-bot": {
+//	      "tools": ["backup_file"],
+//	      "defaults": {"backup_file": {"compress": true}},
+//	      "pinned": {"backup_file": {"directoryId": "dir-123"}}
+//	    },
+//	    "research": {
+//	      "disable": ["upload_file", "upload_content", "backup_file", "create_directory"],
+//	      "descriptions": {"read_file": "Read a paper from the team library"}
+//	    }
+//	  },
+//	  "subjects": {"alice@example.com": "research"},
+//	  "clients": {"backup-service": "backup-bot"}
+//	}
+type ToolProfiles struct {
+	// Default is the profile of sessions no other profile is selected for.
+	// Without one, they get every tool as it is.
+	Default string `json:"default,omitempty"`
+
+	Profiles map[string]ToolProfile `json:"profiles"`
+
+	// Subjects select the profile of HTTP sessions by the subject of their
+	// access token
+	Subjects map[string]string `json:"subjects,omitempty"`
+
+	// Clients select the profile of HTTP sessions by the client ID of their
+	// access token, for subjects that select none
+	Clients map[string]string `json:"clients,omitempty"`
+}
+
+// ToolProfile decides which tools a session is offered and how
+type ToolProfile struct {
+	// Tools are the tools offered, every tool when empty
+	Tools []string `json:"tools,omitempty"`
+
+	// Disable are tools not offered even if Tools names them
+	Disable []string `json:"disable,omitempty"`
+
+	// Descriptions replace the descriptions of tools, by tool name
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+
+	// Defaults are arguments used when a call leaves them out, by tool name.
+	// Tools list them as the default of the property, which is no longer
+	// required.
+	Defaults map[string]map[string]json.RawMessage `json:"defaults,omitempty"`
+
+	// Pinned are arguments calls cannot change, by tool name. They are
+	// used when a call leaves them out, like defaults, and calls that give
+	// another value are refused.
+	Pinned map[string]map[string]json.RawMessage `json:"pinned,omitempty"`
+}
+
+// toolProfile is a validated ToolProfile
+type toolProfile struct {
+	name         string
+	tools        map[string]bool
+	disabled     map[string]bool
+	descriptions map[string]string
+	defaults     map[string]map[string]json.RawMessage
+	pinned       map[string]map[string]interface{}
+}
+
+// toolProfiles are validated ToolProfiles
+type toolProfiles struct {
+	defaultName string
+	profiles    map[string]*toolProfile
+	subjects    map[string]string
+	clients     map[string]string
+}
+
+// SetToolProfiles validates profiles and makes them the ones sessions are
+// offered tools by. Profiles can only name tools that are registered.
+func (s *Server) SetToolProfiles(profiles ToolProfiles) error {
+	compiled := &toolProfiles{
+		defaultName: profiles.Default,
+		profiles:    make(map[string]*toolProfile),
+		subjects:    profiles.Subjects,
+		clients:     profiles.Clients,
+	}
+	for name, profile := range profiles.Profiles {
+		p, err := s.compileProfile(name, profile)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		compiled.profiles[name] = p
+	}
+
+	if profiles.Default != "" && compiled.profiles[profiles.Default] == nil {
+		return fmt.Errorf("default profile %s is not defined", profiles.Default)
+	}
+	for subject, name := range profiles.Subjects {
+		if compiled.profiles[name] == nil {
+			return fmt.Errorf("profile %s of subject %s is not defined", name, subject)
+		}
+	}
+	for client, name := range profiles.Clients {
+		if compiled.profiles[name] == nil {
+			return fmt.Errorf("profile %s of client %s is not defined", name, client)
+		}
+	}
+
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+
+	s.profiles = compiled
+	return nil
+}
+
+func (s *Server) compileProfile(name string, profile ToolProfile) (*toolProfile, error) {
+	p := &toolProfile{
+		name:         name,
+		disabled:     make(map[string]bool),
+		descriptions: profile.Descriptions,
+		defaults:     make(map[string]map[string]json.RawMessage),
+		pinned:       make(map[string]map[string]interface{}),
+	}
+
+	known := func(tool string) (Tool, error) {
+		t, ok := s.lookupTool(tool)
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %s", tool)
+		}
+		return t, nil
+	}
+	if len(profile.Tools) > 0 {
+		p.tools = make(map[string]bool)
+		for _, tool := range profile.Tools {
+			if _, err := known(tool); err != nil {
+				return nil, err
+			}
+			p.tools[tool] = true
+		}
+	}
+	for _, tool := range profile.Disable {
+		if _, err := known(tool); err != nil {
+			return nil, err
+		}
+		p.disabled[tool] = true
+	}
+	for tool := range profile.Descriptions {
+		if _, err := known(tool); err != nil {
+			return nil, err
+		}
+	}
+
+	// Pinned arguments are also defaults, so they are listed and filled in
+	// the same way
+	for _, arguments := range []struct {
+		kind   string
+		values map[string]map[string]json.RawMessage
+	}{{"default", profile.Defaults}, {"pinned argument", profile.Pinned}} {
+		for tool, values := range arguments.values {
+			t, err := known(tool)
+			if err != nil {
+				return nil, err
+			}
+			properties, _ := t.Info().InputSchema["properties"].(map[string]interface{})
+			for argument, raw := range values {
+				schema, ok := properties[argument].(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("tool %s has no argument %s", tool, argument)
+				}
+				value, err := decodeNumber(raw)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s of tool %s: %w", arguments.kind, argument, tool, err)
+				}
+				if violations := validateValue(schema, value, ""); len(violations) > 0 {
+					return nil, fmt.Errorf("%s %s of tool %s %s", arguments.kind, argument, tool, violations[0].Message)
+				}
+				if _, ok := p.defaults[tool][argument]; ok {
+					return nil, fmt.Errorf("argument %s of tool %s is both a default and pinned", argument, tool)
+				}
+
+				if p.defaults[tool] == nil {
+					p.defaults[tool] = make(map[string]json.RawMessage)
+				}
+				p.defaults[tool][argument] = raw
+				if arguments.kind == "pinned argument" {
+					if p.pinned[tool] == nil {
+						p.pinned[tool] = make(map[string]interface{})
+					}
+					p.pinned[tool][argument] = value
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// decodeNumber decodes a JSON value with numbers as json.Number, the way
+// validateValue expects them
+func decodeNumber(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// LoadToolProfiles reads the tool profiles from a JSON file
+func (s *Server) LoadToolProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read tool profiles: %w", err)
+	}
+
+	var profiles ToolProfiles
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profiles); err != nil {
+		return fmt.Errorf("failed to parse tool profiles %s: %w", path, err)
+	}
+	if err := s.SetToolProfiles(profiles); err != nil {
+		return fmt.Errorf("invalid tool profiles %s: %w", path, err)
+	}
+	return nil
+}
+
+// UseProfile selects the profile of sessions that no identity selects one
+// for, in place of the default one of the tool profiles
+func (s *Server) UseProfile(name string) error {
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+
+	if s.profiles == nil || s.profiles.profiles[name] == nil {
+		return fmt.Errorf("profile %s is not defined", name)
+	}
+	s.profiles.defaultName = name
+	return nil
+}
+
+// identityProfile returns the name of the profile an authenticated identity
+// selects, if any. The subject is looked up before the client ID.
+func (s *Server) identityProfile(info *AuthInfo) string {
+	s.profileMu.RLock()
+	defer s.profileMu.RUnlock()
+
+	if s.profiles == nil || info == nil {
+		return ""
+	}
+	if name, ok := s.profiles.subjects[info.Subject]; info.Subject != "" && ok {
+		return name
+	}
+	if name, ok := s.profiles.clients[info.ClientID]; info.ClientID != "" && ok {
+		return name
+	}
+	return ""
+}
+
+// profileFor returns the profile of a session, or nil when it gets every
+// tool as it is
+func (s *Server) profileFor(sess *Session) *toolProfile {
+	s.profileMu.RLock()
+	defer s.profileMu.RUnlock()
+
+	if s.profiles == nil {
+		return nil
+	}
+	if p := s.profiles.profiles[sess.profile]; p != nil {
+		return p
+	}
+	return s.profiles.profiles[s.profiles.defaultName]
+}
+
+// offers reports whether the profile offers a tool
+func (p *toolProfile) offers(name string) bool {
+	if p == nil {
+		return true
+	}
+	if p.tools != nil && !p.tools[name] {
+		return false
+	}
+	return !p.disabled[name]
+}
+
+// apply returns a tool's info as the profile presents it, with its own
+// description and default arguments
+func (p *toolProfile) apply(info ToolInfo) ToolInfo {
+	if p == nil {
+		return info
+	}
+	if description, ok := p.descriptions[info.Name]; ok {
+		info.Description = description
+	}
+	if defaults := p.defaults[info.Name]; len(defaults) > 0 {
+		info.InputSchema = schemaWithDefaults(info.InputSchema, defaults, p.pinned[info.Name])
+	}
+	return info
+}
+
+// schemaWithDefaults returns a copy of an object schema whose properties
+// have the given defaults and are no longer required. Pinned properties
+// only take their default.
+func schemaWithDefaults(schema map[string]interface{}, defaults map[string]json.RawMessage, pinned map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		copied[key] = value
+	}
+
+	properties := make(map[string]interface{})
+	for name, property := range schema["properties"].(map[string]interface{}) {
+		properties[name] = property
+	}
+	for name, raw := range defaults {
+		property := make(map[string]interface{})
+		for key, value := range properties[name].(map[string]interface{}) {
+			property[key] = value
+		}
+		property["default"] = raw
+		if _, ok := pinned[name]; ok {
+			property["const"] = raw
+		}
+		properties[name] = property
+	}
+	copied["properties"] = properties
+
+	var required []string
+	for _, name := range stringList(schema["required"]) {
+		if _, ok := defaults[name]; !ok {
+			required = append(required, name)
+		}
+	}
+	delete(copied, "required")
+	if len(required) > 0 {
+		copied["required"] = required
+	}
+	return copied
+}
+
+// withDefaults adds the profile's default arguments for a tool that a call
+// left out to its raw arguments. It fails when the call gives a pinned
+// argument another value.
+func (p *toolProfile) withDefaults(name string, arguments []byte) ([]byte, error) {
+	if p == nil || len(p.defaults[name]) == 0 {
+		return arguments, nil
+	}
+
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(arguments, &args); err != nil || args == nil {
+		// Not an object, which validation reports
+		return arguments, nil
+	}
+	for argument, value := range p.defaults[name] {
+		given, ok := args[argument]
+		if !ok {
+			args[argument] = value
+			continue
+		}
+		if pinned, ok := p.pinned[name][argument]; ok {
+			if v, err := decodeNumber(given); err != nil || !sameValue(pinned, v) {
+				return nil, invalidParams("argument %s of tool %s is pinned to %s in the %s profile", argument, name, value, p.name)
+			}
+		}
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return arguments, nil
+	}
+	return data, nil
+}
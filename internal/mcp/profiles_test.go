@@ -0,0 +1,157 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+const testProfiles = `{
+	"default": "research",
+	"profiles": {
+		"backup-bot": {
+			"tools": ["backup_file", "search_files"],
+			"defaults": {"backup_file": {"compress": true}},
+			"pinned": {"backup_file": {"directoryId": "dir-9"}}
+		},
+		"research": {
+			"disable": ["upload_file", "upload_content", "backup_file", "restore_backup", "create_directory", "download_file"],
+			"descriptions": {"read_file": "Read a paper from the team library"},
+			"defaults": {"search_files": {"directoryId": "dir-2"}}
+		}
+	},
+	"subjects": {"alice": "research"},
+	"clients": {"backup-service": "backup-bot"}
+}`
+
+func TestServer_ToolProfiles(t *testing.T) {
+	var paths []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"data":{"files":[]}}`))
+	}))
+	defer mockServer.Close()
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	var profiles ToolProfiles
+	if err := json.Unmarshal([]byte(testProfiles), &profiles); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetToolProfiles(profiles); err != nil {
+		t.Fatalf("Failed to set the tool profiles: %v", err)
+	}
+
+	initialize := func(sess *Session) {
+		sess.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+		sess.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	}
+	listTools := func(sess *Session) map[string]map[string]interface{} {
+		response := sess.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+		tools := map[string]map[string]interface{}{}
+		for _, tool := range response.(map[string]interface{})["result"].(map[string]interface{})["tools"].([]map[string]interface{}) {
+			tools[tool["name"].(string)] = tool
+		}
+		return tools
+	}
+
+	// Sessions without an identity get the default profile
+	initialize(server.session)
+	tools := listTools(server.session)
+	if len(tools) != 3 || tools["read_file"] == nil || tools["list_directories"] == nil || tools["search_files"] == nil {
+		t.Errorf("Expected the research tools, got %v", tools)
+	}
+	if description := tools["read_file"]["description"]; description != "Read a paper from the team library" {
+		t.Errorf("Expected the description to be replaced, got %v", description)
+	}
+	schema := tools["search_files"]["inputSchema"].(map[string]interface{})
+	if data, _ := json.Marshal(schema); !strings.Contains(string(data), `"default":"dir-2"`) || schema["required"] != nil {
+		t.Errorf("Expected directoryId to default to dir-2 and not be required, got %s", data)
+	}
+
+	// Defaults fill in what a call leaves out
+	response := server.HandleMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"search_files","arguments":{}}}`)
+	if text := resultText(t, response); !strings.Contains(text, "dir-2") || len(paths) != 1 || !strings.HasSuffix(paths[0], "/directories/dir-2") {
+		t.Errorf("Expected dir-2 to be listed, got %q from %v", text, paths)
+	}
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"search_files","arguments":{"directoryId":"dir-3"}}}`)
+	if text := resultText(t, response); !strings.Contains(text, "dir-3") {
+		t.Errorf("Expected the given directoryId to win, got %q", text)
+	}
+
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"upload_file","arguments":{"filePath":"a.txt"}}}`)
+	if rpcErr, ok := response.(map[string]interface{})["error"].(map[string]interface{}); !ok || !strings.Contains(rpcErr["message"].(string), "not available in the research profile") {
+		t.Errorf("Expected upload_file to be refused, got %v", response)
+	}
+
+	// An identity selects its own profile
+	sess := server.NewSession()
+	defer sess.Close()
+	sess.profile = server.identityProfile(&AuthInfo{Subject: "someone", ClientID: "backup-service"})
+	initialize(sess)
+	tools = listTools(sess)
+	if len(tools) != 2 || tools["backup_file"] == nil {
+		t.Errorf("Expected the backup-bot tools, got %v", tools)
+	}
+	schema = tools["backup_file"]["inputSchema"].(map[string]interface{})
+	if data, _ := json.Marshal(schema); !strings.Contains(string(data), `"const":"dir-9"`) || schema["required"] == nil {
+		t.Errorf("Expected directoryId to be pinned to dir-9 and filePath to stay required, got %s", data)
+	}
+
+	// The subject is looked up before the client ID
+	if name := server.identityProfile(&AuthInfo{Subject: "alice", ClientID: "backup-service"}); name != "research" {
+		t.Errorf("Expected the subject to select research, got %q", name)
+	}
+
+	// A selected profile replaces the default one
+	if err := server.UseProfile("backup-bot"); err != nil {
+		t.Fatalf("Failed to select the profile: %v", err)
+	}
+	if tools := listTools(server.session); len(tools) != 2 {
+		t.Errorf("Expected the backup-bot tools, got %v", tools)
+	}
+
+	// Pinned arguments cannot be changed by a call
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"backup_file","arguments":{"filePath":"missing.txt","directoryId":"dir-8"}}}`)
+	if rpcErr, ok := response.(map[string]interface{})["error"].(map[string]interface{}); !ok || !strings.Contains(rpcErr["message"].(string), `argument directoryId of tool backup_file is pinned to "dir-9"`) {
+		t.Errorf("Expected another directoryId to be refused, got %v", response)
+	}
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"backup_file","arguments":{"filePath":"missing.txt","directoryId":"dir-9"}}}`)
+	if _, ok := response.(map[string]interface{})["error"]; ok {
+		t.Errorf("Expected the pinned directoryId to be accepted, got %v", response)
+	}
+	if err := server.UseProfile("missing"); err == nil {
+		t.Error("Expected an undefined profile to be refused")
+	}
+}
+
+func TestServer_ToolProfilesInvalid(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	tests := []struct {
+		profiles string
+		want     string
+	}{
+		{`{"profiles": {"p": {"tools": ["delete_file"]}}}`, "unknown tool delete_file"},
+		{`{"profiles": {"p": {"descriptions": {"nope": "x"}}}}`, "unknown tool nope"},
+		{`{"profiles": {"p": {"defaults": {"backup_file": {"folder": "x"}}}}}`, "tool backup_file has no argument folder"},
+		{`{"profiles": {"p": {"defaults": {"backup_file": {"compress": "yes"}}}}}`, "default compress of tool backup_file must be a boolean"},
+		{`{"default": "q", "profiles": {"p": {}}}`, "default profile q is not defined"},
+		{`{"profiles": {"p": {"pinned": {"backup_file": {"directoryId": 3}}}}}`, "pinned argument directoryId of tool backup_file must be a string"},
+		{`{"profiles": {"p": {"defaults": {"backup_file": {"compress": true}}, "pinned": {"backup_file": {"compress": false}}}}}`, "argument compress of tool backup_file is both a default and pinned"},
+		{`{"profiles": {"p": {}}, "subjects": {"alice": "q"}}`, "profile q of subject alice is not defined"},
+		{`{"profiles": {"p": {}}, "clients": {"backup-service": "q"}}`, "profile q of client backup-service is not defined"},
+	}
+	for _, tt := range tests {
+		var profiles ToolProfiles
+		if err := json.Unmarshal([]byte(tt.profiles), &profiles); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.SetToolProfiles(profiles); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.profiles, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+	"github.com/tidwall/gjson"
+)
+
+// progressInterval is the minimum time between two progress notifications for
+// the same request. The final one, when a transfer completes, is always sent.
+var progressInterval = 250 * time.Millisecond
+
+// versionProgressMessage is the protocol version that added the message
+// field to progress notifications
+const versionProgressMessage = "2025-03-26"
+
+// progressReporter turns transfer progress into rate-limited
+// notifications/progress for the request that asked for it
+type progressReporter struct {
+	send        func(message interface{}) error
+	token       interface{}
+	withMessage bool
+
+	mu          sync.Mutex
+	label       string
+	lastSent    time.Time
+	sent        int64
+	transferred int64
+	total       int64
+}
+
+type progressReporterKey struct{}
+
+// withProgress attaches a progress reporter to ctx when the request carries a
+// _meta.progressToken; Koneksi transfers made with the context report to it
+func (s *Server) withProgress(ctx context.Context, parsed gjson.Result) context.Context {
+	token := parsed.Get("params._meta.progressToken")
+	if token.Type != gjson.String && token.Type != gjson.Number {
+		return ctx
+	}
+
+	sess := s.sessionFrom(ctx)
+	reporter := &progressReporter{
+		send:        sess.requestNotifier(ctx),
+		token:       token.Value(),
+		withMessage: sess.protocolAtLeast(versionProgressMessage),
+	}
+	ctx = context.WithValue(ctx, progressReporterKey{}, reporter)
+	return koneksi.WithProgress(ctx, reporter.update)
+}
+
+// describeProgress sets what the request is doing, e.g. "Uploading notes.txt",
+// for the messages of its progress notifications
+func describeProgress(ctx context.Context, label string) {
+	reporter, ok := ctx.Value(progressReporterKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	reporter.label = label
+}
+
+// finishProgress sends the final progress notification of a completed
+// transfer when update held it back, as it does for the last read of a
+// transfer whose size was not known
+func finishProgress(ctx context.Context) {
+	if reporter, ok := ctx.Value(progressReporterKey{}).(*progressReporter); ok {
+		reporter.finish()
+	}
+}
+
+func (p *progressReporter) update(transferred, total int64) {
+	p.mu.Lock()
+	p.transferred, p.total = transferred, total
+	done := total > 0 && transferred >= total
+	if transferred <= p.sent || (!done && time.Since(p.lastSent) < progressInterval) {
+		p.mu.Unlock()
+		return
+	}
+	p.notify(transferred, total)
+}
+
+// finish sends the progress not reported yet. Progress must increase with
+// every notification, so nothing is sent when the last one was already final.
+// Its total is the bytes transferred when the size was not known.
+func (p *progressReporter) finish() {
+	p.mu.Lock()
+	transferred, total := p.transferred, p.total
+	if transferred <= p.sent {
+		p.mu.Unlock()
+		return
+	}
+	if total < transferred {
+		total = transferred
+	}
+	p.notify(transferred, total)
+}
+
+// notify sends a notification for transferred of total bytes. It is called
+// with p.mu held and unlocks it before sending.
+func (p *progressReporter) notify(transferred, total int64) {
+	p.sent = transferred
+	p.lastSent = time.Now()
+	label := p.label
+	p.mu.Unlock()
+
+	params := map[string]interface{}{
+		"progressToken": p.token,
+		"progress":      transferred,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if p.withMessage {
+		message := formatBytes(transferred)
+		if total > 0 {
+			message += " of " + formatBytes(total)
+		}
+		if label != "" {
+			message = label + ": " + message
+		}
+		params["message"] = message
+	}
+
+	sendNotification(p.send, "notifications/progress", params)
+}
+
+// formatBytes renders a byte count for people, e.g. 1.5 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func TestServer_DownloadProgress(t *testing.T) {
+	const size = 3 << 20
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The size of unsized files is not sent, so the transfer has no total
+		if !strings.Contains(r.URL.Path, "unsized") {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+		}
+		chunk := make([]byte, 64<<10)
+		for written := 0; written < size; written += len(chunk) {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer mockServer.Close()
+
+	download := func(t *testing.T, fileId, version string, interval time.Duration, meta string) []map[string]interface{} {
+		defer func(old time.Duration) { progressInterval = old }(progressInterval)
+		progressInterval = interval
+
+		client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+		server := NewServer("test-server", "1.0.0", client)
+		notifications := &recordedNotifications{}
+		server.SetNotifier(notifications.record)
+		resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+version+`"}}`)
+
+		outputPath := filepath.Join(t.TempDir(), "big.bin")
+		resultOf(t, server, fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":%q,"outputPath":%q}%s}}`, fileId, outputPath, meta))
+		return notifications.take()
+	}
+
+	t.Run("every chunk", func(t *testing.T) {
+		messages := download(t, "big", "2025-06-18", 0, `,"_meta":{"progressToken":"dl-1"}`)
+		if len(messages) < 2 {
+			t.Fatalf("Expected several progress notifications, got %d", len(messages))
+		}
+
+		var last float64
+		for _, message := range messages {
+			params := message["params"].(map[string]interface{})
+			if message["method"] != "notifications/progress" || params["progressToken"] != "dl-1" {
+				t.Fatalf("Unexpected notification %v", message)
+			}
+			progress := float64(params["progress"].(int64))
+			if progress <= last {
+				t.Errorf("Expected progress to increase, got %v after %v", progress, last)
+			}
+			last = progress
+		}
+
+		final := messages[len(messages)-1]["params"].(map[string]interface{})
+		if final["progress"] != int64(size) || final["total"] != int64(size) {
+			t.Errorf("Expected the final notification to cover the whole file, got %v", final)
+		}
+		if message, _ := final["message"].(string); !strings.HasPrefix(message, "Downloading big.bin: 3.0 MB of 3.0 MB") {
+			t.Errorf("Unexpected progress message %q", message)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		messages := download(t, "big", "2025-06-18", time.Hour, `,"_meta":{"progressToken":7}`)
+		if len(messages) != 2 {
+			t.Fatalf("Expected only the first and final notifications, got %d", len(messages))
+		}
+		if token := messages[0]["params"].(map[string]interface{})["progressToken"]; token != float64(7) {
+			t.Errorf("Expected the numeric token to be echoed, got %v", token)
+		}
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		messages := download(t, "unsized", "2025-06-18", time.Hour, `,"_meta":{"progressToken":"dl-2"}`)
+		if len(messages) != 2 {
+			t.Fatalf("Expected the first and final notifications, got %d", len(messages))
+		}
+		if _, ok := messages[0]["params"].(map[string]interface{})["total"]; ok {
+			t.Error("Expected no total while the size is unknown")
+		}
+
+		final := messages[1]["params"].(map[string]interface{})
+		if final["progress"] != int64(size) || final["total"] != int64(size) {
+			t.Errorf("Expected the final notification to cover the whole file, got %v", final)
+		}
+		if message, _ := final["message"].(string); message != "Downloading big.bin: 3.0 MB of 3.0 MB" {
+			t.Errorf("Unexpected progress message %q", message)
+		}
+	})
+
+	t.Run("no message before 2025-03-26", func(t *testing.T) {
+		messages := download(t, "big", "2024-11-05", time.Hour, `,"_meta":{"progressToken":"old"}`)
+		if len(messages) == 0 {
+			t.Fatal("Expected progress notifications")
+		}
+		if _, ok := messages[0]["params"].(map[string]interface{})["message"]; ok {
+			t.Error("Expected no message field for a 2024-11-05 client")
+		}
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		if messages := download(t, "big", "2025-06-18", 0, ""); len(messages) != 0 {
+			t.Errorf("Expected no notifications without a progress token, got %d", len(messages))
+		}
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1536:          "1.5 KB",
+		3 << 20:       "3.0 MB",
+		5<<30 + 1<<29: "5.5 GB",
+	}
+	for n, expected := range tests {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", n, got, expected)
+		}
+	}
+}
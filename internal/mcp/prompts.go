@@ -0,0 +1,341 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/tidwall/gjson"
+)
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is a single message of a prompt template. Text and Resource are
+// Go text/template strings rendered with the prompt arguments; a message with a
+// Resource embeds the contents of that koneksi:// URI.
+type PromptMessage struct {
+	Role     string `json:"role"`
+	Text     string `json:"text,omitempty"`
+	Resource string `json:"resource,omitempty"`
+}
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+	Messages    []PromptMessage  `json:"messages"`
+}
+
+var builtinPrompts = []Prompt{
+	{
+		Name:        "backup_project_folder",
+		Title:       "Back up a project folder",
+		Description: "Back up every file of a local project folder to Koneksi Storage",
+		Arguments: []PromptArgument{
+			{Name: "path", Description: "Local path of the project folder", Required: true},
+			{Name: "directoryId", Description: "Koneksi directory to back up into (optional)"},
+		},
+		Messages: []PromptMessage{
+			{
+				Role: "user",
+				Text: `Back up the project folder at {{.path}} to Koneksi Storage.
+
+{{if .directoryId}}Use the Koneksi directory {{.directoryId}}.{{else}}Call list_directories to look for a directory named after the project, and create_directory to make one if there is none.{{end}}
+Then, for each file in the folder, call backup_file with its filePath and the directoryId, setting compress to true.
+Skip dependency and build folders (node_modules, vendor, dist, build, .git) and never back up secrets such as .env files or private keys.
+When you are done, report the file ID of every backup and any files that failed.`,
+			},
+		},
+	},
+	{
+		Name:        "audit_duplicates",
+		Title:       "Audit a directory for duplicates",
+		Description: "Find duplicate or redundant files in a Koneksi directory",
+		Arguments: []PromptArgument{
+			{Name: "directoryId", Description: "Koneksi directory to audit", Required: true},
+		},
+		Messages: []PromptMessage{
+			{Role: "user", Resource: "koneksi://directory/{{.directoryId}}"},
+			{
+				Role: "user",
+				Text: `Audit the Koneksi directory {{.directoryId}} above for duplicates.
+
+Group files that share the same hash (identical content) first, then files whose names differ only by a copy suffix, version number or date.
+If the hashes are missing, call search_files to refresh the listing, and use read_file to compare the contents of suspicious text files.
+Do not delete or overwrite anything. List each group of duplicates with file IDs and sizes, say which copy you would keep and why, and total the space that could be reclaimed.`,
+			},
+		},
+	},
+	{
+		Name:        "restore_latest_backup",
+		Title:       "Restore the latest backup",
+		Description: "Find the most recent backup of a file and download it",
+		Arguments: []PromptArgument{
+			{Name: "name", Description: "Name of the file or project that was backed up", Required: true},
+			{Name: "outputPath", Description: "Local path to restore the file to", Required: true},
+			{Name: "directoryId", Description: "Koneksi directory holding the backups (optional)"},
+		},
+		Messages: []PromptMessage{
+			{
+				Role: "user",
+				Text: `Restore the latest backup of {{.name}} to {{.outputPath}}.
+
+{{if .directoryId}}Call search_files with directoryId {{.directoryId}}{{else}}Call list_directories, then search_files on each directory that could hold backups{{end}} and find files whose names start with {{.name}}. Backups may carry .gz (compressed) or .enc (encrypted) suffixes.
+Pick the most recent one, judging by any date or version in the name. If more than one candidate is plausible, list them and ask me which one to restore before downloading.
+Then call restore_backup with the file ID and outputPath {{.outputPath}}. Set decompress for a .gz backup, and for an .enc backup ask me for the password and pass it as decryptPassword; never guess it.`,
+			},
+		},
+	},
+	{
+		Name:        "summarize_directory_changes",
+		Title:       "Summarise recent changes",
+		Description: "Summarise what changed in a Koneksi directory recently",
+		Arguments: []PromptArgument{
+			{Name: "directoryId", Description: "Koneksi directory to summarise", Required: true},
+			{Name: "since", Description: "Start of the period to summarise (optional, defaults to one week ago)"},
+		},
+		Messages: []PromptMessage{
+			{Role: "user", Resource: "koneksi://directory/{{.directoryId}}"},
+			{
+				Role: "user",
+				Text: `Summarise what changed in the Koneksi directory {{.directoryId}} {{if .since}}since {{.since}}{{else}}over the past week{{end}}.
+
+Use the listing above as the current state. Identify files that were added or updated in that period from their names and from what you know of earlier listings, and use read_file to skim the text files among them.
+Give a short overview first, then one bullet per notable file with its name, file ID and what changed. Mention anything that looks accidental, such as duplicates or temporary files.`,
+			},
+		},
+	},
+}
+
+// LoadPrompts reads prompt templates from every *.json file in dir. A file may
+// hold a single prompt or an array of prompts; prompts with the name of a
+// built-in one replace it.
+func (s *Server) LoadPrompts(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list prompt files: %w", err)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		var prompts []Prompt
+		if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(data, &prompts)
+		} else {
+			var prompt Prompt
+			err = json.Unmarshal(data, &prompt)
+			prompts = append(prompts, prompt)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		for _, prompt := range prompts {
+			if err := s.AddPrompt(prompt); err != nil {
+				return fmt.Errorf("invalid prompt in %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddPrompt registers a prompt template, replacing any prompt with the same name
+func (s *Server) AddPrompt(prompt Prompt) error {
+	if prompt.Name == "" {
+		return fmt.Errorf("prompt name is required")
+	}
+	if len(prompt.Messages) == 0 {
+		return fmt.Errorf("prompt %s has no messages", prompt.Name)
+	}
+
+	for i, msg := range prompt.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return fmt.Errorf("prompt %s message %d: role must be user or assistant", prompt.Name, i)
+		}
+		if (msg.Text == "") == (msg.Resource == "") {
+			return fmt.Errorf("prompt %s message %d: exactly one of text or resource is required", prompt.Name, i)
+		}
+		for _, tmpl := range []string{msg.Text, msg.Resource} {
+			if _, err := template.New(prompt.Name).Parse(tmpl); err != nil {
+				return fmt.Errorf("prompt %s message %d: %w", prompt.Name, i, err)
+			}
+		}
+	}
+
+	s.promptMu.Lock()
+	defer s.promptMu.Unlock()
+
+	if _, exists := s.prompts[prompt.Name]; !exists {
+		s.promptOrder = append(s.promptOrder, prompt.Name)
+	}
+	s.prompts[prompt.Name] = prompt
+	return nil
+}
+
+func (s *Server) handlePromptsList(parsed gjson.Result, id interface{}) (interface{}, error) {
+	offset, err := decodeCursor(parsed.Get("params.cursor").String())
+	if err != nil {
+		return nil, err
+	}
+
+	s.promptMu.RLock()
+	prompts := make([]map[string]interface{}, 0, len(s.promptOrder))
+	for _, name := range s.promptOrder {
+		prompt := s.prompts[name]
+		entry := map[string]interface{}{
+			"name":      prompt.Name,
+			"arguments": prompt.Arguments,
+		}
+		if prompt.Title != "" {
+			entry["title"] = prompt.Title
+		}
+		if prompt.Description != "" {
+			entry["description"] = prompt.Description
+		}
+		if prompt.Arguments == nil {
+			entry["arguments"] = []PromptArgument{}
+		}
+		prompts = append(prompts, entry)
+	}
+	s.promptMu.RUnlock()
+
+	if offset > len(prompts) {
+		offset = len(prompts)
+	}
+	end := offset + resourcesPageSize
+	if end > len(prompts) {
+		end = len(prompts)
+	}
+
+	result := map[string]interface{}{
+		"prompts": prompts[offset:end],
+	}
+	if end < len(prompts) {
+		result["nextCursor"] = encodeCursor(end)
+	}
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	}, nil
+}
+
+func (s *Server) handlePromptsGet(ctx context.Context, parsed gjson.Result, id interface{}) (interface{}, error) {
+	name := parsed.Get("params.name").String()
+
+	s.promptMu.RLock()
+	prompt, ok := s.prompts[name]
+	s.promptMu.RUnlock()
+	if !ok {
+		return nil, invalidParams("unknown prompt: %s", name)
+	}
+
+	args := make(map[string]string)
+	parsed.Get("params.arguments").ForEach(func(key, value gjson.Result) bool {
+		args[key.String()] = value.String()
+		return true
+	})
+
+	for _, arg := range prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, invalidParams("missing required argument: %s", arg.Name)
+		}
+	}
+
+	messages := make([]map[string]interface{}, 0, len(prompt.Messages))
+	for _, msg := range prompt.Messages {
+		content, err := s.renderPromptContent(ctx, prompt.Name, msg, args)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, map[string]interface{}{
+			"role":    msg.Role,
+			"content": content,
+		})
+	}
+
+	result := map[string]interface{}{
+		"messages": messages,
+	}
+	if prompt.Description != "" {
+		result["description"] = prompt.Description
+	}
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	}, nil
+}
+
+func (s *Server) renderPromptContent(ctx context.Context, name string, msg PromptMessage, args map[string]string) (map[string]interface{}, error) {
+	if msg.Text != "" {
+		text, err := renderTemplate(name, msg.Text, args)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"type": "text",
+			"text": text,
+		}, nil
+	}
+
+	uri, err := renderTemplate(name, msg.Resource, args)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, resourceID, err := parseResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents map[string]interface{}
+	if kind == "directory" {
+		contents, err = s.readDirectoryResource(ctx, uri, resourceID)
+	} else {
+		contents, err = s.readFileResource(ctx, uri, resourceID)
+	}
+	if err != nil {
+		// Still point the model at the resource so it can fetch it with a tool
+		return map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("Resource %s could not be loaded (%v).", uri, err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"type":     "resource",
+		"resource": contents,
+	}, nil
+}
+
+func renderTemplate(name, text string, args map[string]string) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template %s: %w", name, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, args); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func TestServer_PromptsList(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"prompts/list","params":{}}`)
+	prompts := result["prompts"].([]map[string]interface{})
+
+	expected := []string{"backup_project_folder", "audit_duplicates", "restore_latest_backup", "summarize_directory_changes"}
+	if len(prompts) != len(expected) {
+		t.Fatalf("Expected %d prompts, got %d", len(expected), len(prompts))
+	}
+	for i, name := range expected {
+		if prompts[i]["name"] != name {
+			t.Errorf("Expected prompt %d to be %s, got %v", i, name, prompts[i]["name"])
+		}
+	}
+}
+
+func TestServer_PromptsGet(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"files": []map[string]interface{}{
+					{"id": "file1", "name": "report.pdf", "size": 100, "hash": "abc"},
+				},
+			},
+		})
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := NewServer("test-server", "1.0.0", client)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"audit_duplicates","arguments":{"directoryId":"dir1"}}}`)
+	messages := result["messages"].([]map[string]interface{})
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+
+	resource := messages[0]["content"].(map[string]interface{})
+	if resource["type"] != "resource" {
+		t.Fatalf("Expected an embedded resource, got %v", resource["type"])
+	}
+	embedded := resource["resource"].(map[string]interface{})
+	if embedded["uri"] != "koneksi://directory/dir1" || !strings.Contains(embedded["text"].(string), "report.pdf") {
+		t.Errorf("Expected the directory listing to be embedded, got %v", embedded)
+	}
+
+	text := messages[1]["content"].(map[string]interface{})["text"].(string)
+	if !strings.Contains(text, "dir1") || !strings.Contains(text, "search_files") {
+		t.Errorf("Expected rendered text with tool guidance, got %s", text)
+	}
+
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":2,"method":"prompts/get","params":{"name":"audit_duplicates","arguments":{}}}`); err == nil {
+		t.Error("Expected error for a missing required argument")
+	}
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"nope"}}`); err == nil {
+		t.Error("Expected error for an unknown prompt")
+	}
+}
+
+func TestServer_PromptsGet_OptionalArguments(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"backup_project_folder","arguments":{"path":"/work/app"}}}`)
+	text := result["messages"].([]map[string]interface{})[0]["content"].(map[string]interface{})["text"].(string)
+
+	if !strings.Contains(text, "/work/app") || !strings.Contains(text, "create_directory") {
+		t.Errorf("Expected the no-directory branch to be rendered, got %s", text)
+	}
+	if strings.Contains(text, "<no value>") {
+		t.Errorf("Expected missing optional arguments to render empty, got %s", text)
+	}
+}
+
+func TestServer_LoadPrompts(t *testing.T) {
+	dir := t.TempDir()
+
+	custom := `{
+		"name": "weekly_report",
+		"description": "Upload the weekly report",
+		"arguments": [{"name": "week", "required": true}],
+		"messages": [{"role": "user", "text": "Upload the report for week {{.week}} with upload_file."}]
+	}`
+	override := `[{"name": "audit_duplicates", "messages": [{"role": "user", "text": "Team-specific audit of {{.directoryId}}"}]}]`
+
+	if err := os.WriteFile(filepath.Join(dir, "weekly.json"), []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "overrides.json"), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer("test-server", "1.0.0", nil)
+	if err := server.LoadPrompts(dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"prompts/list","params":{}}`)
+	if prompts := result["prompts"].([]map[string]interface{}); len(prompts) != 5 {
+		t.Errorf("Expected 4 built-in prompts plus 1 custom, got %d", len(prompts))
+	}
+
+	result = resultOf(t, server, `{"jsonrpc":"2.0","id":2,"method":"prompts/get","params":{"name":"weekly_report","arguments":{"week":"42"}}}`)
+	text := result["messages"].([]map[string]interface{})[0]["content"].(map[string]interface{})["text"].(string)
+	if text != "Upload the report for week 42 with upload_file." {
+		t.Errorf("Unexpected rendered text: %s", text)
+	}
+
+	result = resultOf(t, server, `{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"audit_duplicates","arguments":{"directoryId":"d"}}}`)
+	text = result["messages"].([]map[string]interface{})[0]["content"].(map[string]interface{})["text"].(string)
+	if text != "Team-specific audit of d" {
+		t.Errorf("Expected the built-in prompt to be overridden, got %s", text)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"name":"broken","messages":[{"role":"system","text":"x"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.LoadPrompts(dir); err == nil {
+		t.Error("Expected error for a prompt with an invalid role")
+	}
+}
@@ -0,0 +1,134 @@
+package mcp
+
+import (
+	"github.com/tidwall/gjson"
+)
+
+// LatestProtocolVersion is the newest MCP protocol version the server speaks
+const LatestProtocolVersion = "2025-11-25"
+
+// supportedProtocolVersions lists the published MCP versions the server can
+// negotiate, newest first
+var supportedProtocolVersions = []string{
+	LatestProtocolVersion,
+	"2025-06-18",
+	"2025-03-26",
+	"2024-11-05",
+}
+
+// Protocol versions that introduced the features the server gates on.
+// Versions are dates, so they compare correctly as strings.
+const (
+	versionToolAnnotations  = "2025-03-26"
+	versionToolTitles       = "2025-06-18"
+	versionStructuredOutput = "2025-06-18"
+	versionElicitation      = "2025-06-18"
+	versionResourceLinks    = "2025-06-18"
+)
+
+// ClientInfo is what the client reported about itself in initialize
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Title   string `json:"title,omitempty"`
+	Version string `json:"version"`
+}
+
+// negotiateProtocolVersion picks the version to answer initialize with: the
+// requested one when the server supports it, and the latest otherwise. The
+// spec requires clients to send a version; clients that do not are assumed
+// to be from before negotiation existed.
+func negotiateProtocolVersion(requested string) string {
+	if requested == "" {
+		return supportedProtocolVersions[len(supportedProtocolVersions)-1]
+	}
+	if isSupportedProtocolVersion(requested) {
+		return requested
+	}
+	return LatestProtocolVersion
+}
+
+func isSupportedProtocolVersion(version string) bool {
+	for _, supported := range supportedProtocolVersions {
+		if supported == version {
+			return true
+		}
+	}
+	return false
+}
+
+// setClient records the negotiated version and what the client sent in initialize
+func (sess *Session) setClient(version string, params gjson.Result) {
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+
+	sess.protocolVersion = version
+	sess.clientInfo = ClientInfo{
+		Name:    params.Get("clientInfo.name").String(),
+		Title:   params.Get("clientInfo.title").String(),
+		Version: params.Get("clientInfo.version").String(),
+	}
+	sess.clientCapabilities, _ = params.Get("capabilities").Value().(map[string]interface{})
+}
+
+// ProtocolVersion returns the negotiated protocol version, or "" before initialize
+func (sess *Session) ProtocolVersion() string {
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+
+	return sess.protocolVersion
+}
+
+// ClientInfo returns what the client reported about itself in initialize
+func (sess *Session) ClientInfo() ClientInfo {
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+
+	return sess.clientInfo
+}
+
+// ProtocolVersion returns the protocol version negotiated by the default session
+func (s *Server) ProtocolVersion() string {
+	return s.session.ProtocolVersion()
+}
+
+// ClientInfo returns what the client of the default session reported about itself
+func (s *Server) ClientInfo() ClientInfo {
+	return s.session.ClientInfo()
+}
+
+// protocolAtLeast reports whether the negotiated version is version or newer
+func (sess *Session) protocolAtLeast(version string) bool {
+	current := sess.ProtocolVersion()
+	return current != "" && current >= version
+}
+
+// clientSupports reports whether the client declared capability in initialize
+func (sess *Session) clientSupports(capability string) bool {
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+
+	_, ok := sess.clientCapabilities[capability]
+	return ok
+}
+
+func (sess *Session) supportsToolAnnotations() bool {
+	return sess.protocolAtLeast(versionToolAnnotations)
+}
+
+func (sess *Session) supportsToolTitles() bool {
+	return sess.protocolAtLeast(versionToolTitles)
+}
+
+func (sess *Session) supportsStructuredOutput() bool {
+	return sess.protocolAtLeast(versionStructuredOutput)
+}
+
+func (sess *Session) supportsResourceLinks() bool {
+	return sess.protocolAtLeast(versionResourceLinks)
+}
+
+// supportsElicitation also needs the client to have declared the capability,
+// as elicitation requests are sent from the server to the client
+func (sess *Session) supportsElicitation() bool {
+	return sess.protocolAtLeast(versionElicitation) && sess.clientSupports("elicitation")
+}
@@ -0,0 +1,125 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	tests := []struct {
+		requested string
+		expected  string
+	}{
+		{"2024-11-05", "2024-11-05"},
+		{"2025-03-26", "2025-03-26"},
+		{"2025-06-18", "2025-06-18"},
+		{LatestProtocolVersion, LatestProtocolVersion},
+		{"2099-01-01", LatestProtocolVersion},
+		{"bogus", LatestProtocolVersion},
+		{"", "2024-11-05"},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateProtocolVersion(tt.requested); got != tt.expected {
+			t.Errorf("negotiateProtocolVersion(%q) = %q, expected %q", tt.requested, got, tt.expected)
+		}
+	}
+}
+
+func TestServer_Initialize_StoresClient(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{
+		"protocolVersion":"2025-06-18",
+		"clientInfo":{"name":"test-client","title":"Test Client","version":"2.1.0"},
+		"capabilities":{"elicitation":{},"roots":{"listChanged":true}}
+	}}`)
+
+	if result["protocolVersion"] != "2025-06-18" {
+		t.Errorf("Expected the requested version to be accepted, got %v", result["protocolVersion"])
+	}
+
+	info := server.ClientInfo()
+	if info.Name != "test-client" || info.Title != "Test Client" || info.Version != "2.1.0" {
+		t.Errorf("Unexpected client info: %+v", info)
+	}
+	if !server.session.clientSupports("roots") || server.session.clientSupports("sampling") {
+		t.Error("Expected the client capabilities to be stored")
+	}
+}
+
+func TestServer_VersionGatedFeatures(t *testing.T) {
+	tests := []struct {
+		version      string
+		capabilities string
+		annotations  bool
+		structured   bool
+		links        bool
+		elicitation  bool
+	}{
+		{"2024-11-05", `{"elicitation":{}}`, false, false, false, false},
+		{"2025-03-26", `{"elicitation":{}}`, true, false, false, false},
+		{"2025-06-18", `{}`, true, true, true, false},
+		{"2025-06-18", `{"elicitation":{}}`, true, true, true, true},
+		{LatestProtocolVersion, `{"elicitation":{}}`, true, true, true, true},
+	}
+
+	for _, tt := range tests {
+		server := NewServer("test-server", "1.0.0", nil)
+		resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+tt.version+`","capabilities":`+tt.capabilities+`}}`)
+
+		if got := server.session.supportsToolAnnotations(); got != tt.annotations {
+			t.Errorf("%s: tool annotations = %t, expected %t", tt.version, got, tt.annotations)
+		}
+		if got := server.session.supportsStructuredOutput(); got != tt.structured {
+			t.Errorf("%s: structured output = %t, expected %t", tt.version, got, tt.structured)
+		}
+		if got := server.session.supportsResourceLinks(); got != tt.links {
+			t.Errorf("%s: resource links = %t, expected %t", tt.version, got, tt.links)
+		}
+		if got := server.session.supportsElicitation(); got != tt.elicitation {
+			t.Errorf("%s: elicitation with %s = %t, expected %t", tt.version, tt.capabilities, got, tt.elicitation)
+		}
+	}
+}
+
+func TestServer_UploadResourceLink(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"file_id": "file-1",
+				"name":    "notes.json",
+				"size":    2,
+			},
+		})
+	}))
+	defer mockServer.Close()
+
+	upload := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":"notes.json","content":"e30="}}}`
+
+	for _, version := range []string{"2024-11-05", "2025-06-18"} {
+		client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+		server := NewServer("test-server", "1.0.0", client)
+		resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+version+`"}}`)
+
+		content := resultOf(t, server, upload)["content"].([]map[string]interface{})
+		if version < versionResourceLinks {
+			if len(content) != 1 {
+				t.Errorf("%s: expected only a text item, got %v", version, content)
+			}
+			continue
+		}
+
+		if len(content) != 2 || content[1]["type"] != "resource_link" {
+			t.Fatalf("%s: expected a resource link after the text, got %v", version, content)
+		}
+		if content[1]["uri"] != "koneksi://file/file-1" || content[1]["mimeType"] != "application/json" {
+			t.Errorf("%s: unexpected resource link %v", version, content[1])
+		}
+	}
+}
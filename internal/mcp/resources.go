@@ -0,0 +1,373 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	resourceScheme      = "koneksi://"
+	directoryURIPrefix  = resourceScheme + "directory/"
+	fileURIPrefix       = resourceScheme + "file/"
+	directoryMimeType   = "application/json"
+	resourcesPageSize   = 50
+	defaultFileMimeType = "application/octet-stream"
+)
+
+func directoryURI(id string) string {
+	return directoryURIPrefix + id
+}
+
+func fileURI(id string) string {
+	return fileURIPrefix + id
+}
+
+// parseResourceURI splits a koneksi:// URI into its kind ("file" or "directory") and ID
+func parseResourceURI(uri string) (kind, id string, err error) {
+	switch {
+	case strings.HasPrefix(uri, fileURIPrefix):
+		kind, id = "file", strings.TrimPrefix(uri, fileURIPrefix)
+	case strings.HasPrefix(uri, directoryURIPrefix):
+		kind, id = "directory", strings.TrimPrefix(uri, directoryURIPrefix)
+	default:
+		return "", "", invalidParams("unsupported resource URI: %s", uri)
+	}
+
+	if id == "" || strings.Contains(id, "/") {
+		return "", "", invalidParams("invalid resource URI: %s", uri)
+	}
+	return kind, id, nil
+}
+
+// fileMimeType prefers the content type reported by Koneksi and falls back to the extension
+func fileMimeType(file koneksi.FileInfo) string {
+	if file.ContentType != "" {
+		return file.ContentType
+	}
+	if mt := mime.TypeByExtension(filepath.Ext(file.Name)); mt != "" {
+		return mt
+	}
+	return defaultFileMimeType
+}
+
+// handleResourcesList pages through the API's own listing: every directory
+// followed by its files. The cursor is the position of the next resource, so
+// a page only lists the directories it reaches.
+func (s *Server) handleResourcesList(ctx context.Context, parsed gjson.Result, id interface{}) (interface{}, error) {
+	dirIndex, entryIndex, err := decodeResourceCursor(parsed.Get("params.cursor").String())
+	if err != nil {
+		return nil, err
+	}
+
+	s.subMu.Lock()
+	s.sessionFrom(ctx).listsResources = true
+	s.subMu.Unlock()
+
+	directories, err := s.client.ListDirectoriesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directories: %w", err)
+	}
+
+	// entryIndex counts the resources of the directory already listed: the
+	// directory itself, then its files
+	resources := make([]map[string]interface{}, 0, resourcesPageSize)
+	for ; dirIndex < len(directories); dirIndex, entryIndex = dirIndex+1, 0 {
+		if len(resources) == resourcesPageSize {
+			break
+		}
+		dir := directories[dirIndex]
+		if entryIndex == 0 {
+			resources = append(resources, map[string]interface{}{
+				"uri":         directoryURI(dir.ID),
+				"name":        dir.Name,
+				"description": fmt.Sprintf("Koneksi directory %s", dir.Name),
+				"mimeType":    directoryMimeType,
+			})
+			entryIndex = 1
+			if len(resources) == resourcesPageSize {
+				break
+			}
+		}
+
+		files, err := s.client.GetDirectoryFilesContext(ctx, dir.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get directory files: %w", err)
+		}
+		s.rememberFiles(files)
+		if entryIndex-1 < len(files) {
+			files = files[entryIndex-1:]
+		} else {
+			files = nil
+		}
+
+		room := resourcesPageSize - len(resources)
+		if len(files) > room {
+			files = files[:room]
+		}
+		for _, file := range files {
+			resources = append(resources, map[string]interface{}{
+				"uri":      fileURI(file.ID),
+				"name":     file.Name,
+				"mimeType": fileMimeType(file),
+				"size":     file.Size,
+			})
+		}
+		entryIndex += len(files)
+		if len(files) == room {
+			break
+		}
+	}
+
+	result := map[string]interface{}{
+		"resources": resources,
+	}
+	if dirIndex < len(directories) {
+		result["nextCursor"] = encodeResourceCursor(dirIndex, entryIndex)
+	}
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	}, nil
+}
+
+// rememberFiles keeps what a listing said about files, so that reading one
+// as a resource reports the MIME type it was listed with
+func (s *Server) rememberFiles(files []koneksi.FileInfo) {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+
+	if s.files == nil {
+		s.files = make(map[string]koneksi.FileInfo)
+	}
+	for _, file := range files {
+		s.files[file.ID] = file
+	}
+}
+
+func (s *Server) knownFile(id string) (koneksi.FileInfo, bool) {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+
+	file, ok := s.files[id]
+	return file, ok
+}
+
+// walkStorage calls fn for every directory with the files it contains
+func (s *Server) walkStorage(ctx context.Context, fn func(dir koneksi.DirectoryInfo, files []koneksi.FileInfo)) error {
+	directories, err := s.client.ListDirectoriesContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list directories: %w", err)
+	}
+
+	for _, dir := range directories {
+		files, err := s.client.GetDirectoryFilesContext(ctx, dir.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get directory files: %w", err)
+		}
+		s.rememberFiles(files)
+		fn(dir, files)
+	}
+
+	return nil
+}
+
+func (s *Server) handleResourcesRead(ctx context.Context, parsed gjson.Result, id interface{}) (interface{}, error) {
+	uri := parsed.Get("params.uri").String()
+	if uri == "" {
+		return nil, invalidParams("uri is required")
+	}
+
+	kind, resourceID, err := parseResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents map[string]interface{}
+	if kind == "directory" {
+		contents, err = s.readDirectoryResource(ctx, uri, resourceID)
+	} else {
+		contents, err = s.readFileResource(ctx, uri, resourceID)
+	}
+	if err != nil {
+		var apiErr *koneksi.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			data := errorData(err)
+			data["uri"] = uri
+			return nil, &RPCError{Code: CodeResourceNotFound, Message: "resource not found", Data: data}
+		}
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result": map[string]interface{}{
+			"contents": []map[string]interface{}{contents},
+		},
+	}, nil
+}
+
+func (s *Server) readDirectoryResource(ctx context.Context, uri, directoryID string) (map[string]interface{}, error) {
+	files, err := s.client.GetDirectoryFilesContext(ctx, directoryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get directory files: %w", err)
+	}
+	s.rememberFiles(files)
+
+	type entry struct {
+		URI      string `json:"uri"`
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+		Hash     string `json:"hash,omitempty"`
+	}
+
+	listing := struct {
+		DirectoryID string  `json:"directoryId"`
+		Files       []entry `json:"files"`
+	}{
+		DirectoryID: directoryID,
+		Files:       make([]entry, 0, len(files)),
+	}
+	for _, file := range files {
+		listing.Files = append(listing.Files, entry{
+			URI:      fileURI(file.ID),
+			ID:       file.ID,
+			Name:     file.Name,
+			Size:     file.Size,
+			MimeType: fileMimeType(file),
+			Hash:     file.Hash,
+		})
+	}
+
+	data, err := json.MarshalIndent(listing, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal directory listing: %w", err)
+	}
+
+	return map[string]interface{}{
+		"uri":      uri,
+		"mimeType": directoryMimeType,
+		"text":     string(data),
+	}, nil
+}
+
+func (s *Server) readFileResource(ctx context.Context, uri, fileID string) (map[string]interface{}, error) {
+	reader, err := s.client.DownloadFileContext(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer reader.Close()
+
+	// Resources are returned whole, so text gets the same cap as binaries
+	fc, err := readContent(reader, 0, maxInlineBinary)
+	if err != nil {
+		return nil, err
+	}
+	if fc.Next >= 0 {
+		return nil, fmt.Errorf("file exceeds the %d byte resource limit; use download_file instead", maxInlineBinary)
+	}
+
+	// Files not listed yet are typed by their content
+	mimeType := fc.MimeType
+	if file, ok := s.knownFile(fileID); ok {
+		mimeType = fileMimeType(file)
+	}
+	contents := map[string]interface{}{
+		"uri":      uri,
+		"mimeType": mimeType,
+	}
+	if fc.IsText() {
+		contents["text"] = fc.Text
+	} else {
+		contents["blob"] = base64.StdEncoding.EncodeToString(fc.Data)
+	}
+
+	return contents, nil
+}
+
+func (s *Server) handleResourceTemplatesList(id interface{}) (interface{}, error) {
+	templates := []map[string]interface{}{
+		{
+			"uriTemplate": fileURIPrefix + "{fileId}",
+			"name":        "Koneksi file",
+			"description": "A file stored in Koneksi Storage, returned as text or a base64 blob",
+		},
+		{
+			"uriTemplate": directoryURIPrefix + "{directoryId}",
+			"name":        "Koneksi directory",
+			"description": "A JSON listing of the files in a Koneksi directory",
+			"mimeType":    directoryMimeType,
+		},
+	}
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result": map[string]interface{}{
+			"resourceTemplates": templates,
+		},
+	}, nil
+}
+
+// Resource cursors are the index of a directory and of a resource in it
+func encodeResourceCursor(dirIndex, entryIndex int) string {
+	return encodeCursor(dirIndex) + "." + encodeCursor(entryIndex)
+}
+
+func decodeResourceCursor(cursor string) (int, int, error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+
+	dir, entry, ok := strings.Cut(cursor, ".")
+	if !ok || dir == "" || entry == "" {
+		return 0, 0, invalidParams("invalid cursor")
+	}
+	dirIndex, err := decodeCursor(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	entryIndex, err := decodeCursor(entry)
+	if err != nil {
+		return 0, 0, err
+	}
+	return dirIndex, entryIndex, nil
+}
+
+// Cursors are opaque to clients; internally they are a base64-encoded offset
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalidParams("invalid cursor")
+	}
+
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, invalidParams("invalid cursor")
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,143 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func newResourceTestServer(t *testing.T, fileCount int) *Server {
+	files := make([]map[string]interface{}, 0, fileCount)
+	for i := 0; i < fileCount; i++ {
+		files = append(files, map[string]interface{}{
+			"id":   fmt.Sprintf("file%d", i),
+			"name": fmt.Sprintf("file%d.json", i),
+			"size": 10,
+		})
+	}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/directories/root"):
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"directory":      map[string]interface{}{"id": "root", "name": "root"},
+					"subdirectories": []map[string]interface{}{{"id": "docs", "name": "Docs"}},
+				},
+			})
+		case strings.HasSuffix(r.URL.Path, "/directories/docs"):
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"files": files},
+			})
+		case strings.HasSuffix(r.URL.Path, "/files/file0/download"):
+			w.Write([]byte("# Notes\n"))
+		case strings.HasSuffix(r.URL.Path, "/files/image/download"):
+			w.Write([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(mockServer.Close)
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	return NewServer("test-server", "1.0.0", client)
+}
+
+func resultOf(t *testing.T, server *Server, request string) map[string]interface{} {
+	t.Helper()
+
+	response, err := server.HandleRequest(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, ok := response.(map[string]interface{})["result"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected result to be a map")
+	}
+	return result
+}
+
+func TestServer_ResourcesList_Pagination(t *testing.T) {
+	server := newResourceTestServer(t, 60)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"resources/list","params":{}}`)
+	first := result["resources"].([]map[string]interface{})
+	if len(first) != resourcesPageSize {
+		t.Fatalf("Expected a full first page of %d, got %d", resourcesPageSize, len(first))
+	}
+	if first[0]["uri"] != "koneksi://directory/root" || first[1]["uri"] != "koneksi://directory/docs" {
+		t.Errorf("Expected directories first, got %v and %v", first[0]["uri"], first[1]["uri"])
+	}
+	if first[2]["mimeType"] != "application/json" {
+		t.Errorf("Expected MIME type from the file extension, got %v", first[2]["mimeType"])
+	}
+
+	cursor, ok := result["nextCursor"].(string)
+	if !ok {
+		t.Fatal("Expected a nextCursor on the first page")
+	}
+
+	result = resultOf(t, server, fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"resources/list","params":{"cursor":%q}}`, cursor))
+	second := result["resources"].([]map[string]interface{})
+	if len(second) != 12 {
+		t.Errorf("Expected the remaining 12 resources, got %d", len(second))
+	}
+	if _, ok := result["nextCursor"]; ok {
+		t.Error("Expected no nextCursor on the last page")
+	}
+
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":3,"method":"resources/list","params":{"cursor":"!!"}}`); err == nil {
+		t.Error("Expected error for an invalid cursor")
+	}
+}
+
+func TestServer_ResourcesRead(t *testing.T) {
+	server := newResourceTestServer(t, 1)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"koneksi://file/file0"}}`)
+	contents := result["contents"].([]map[string]interface{})
+	if contents[0]["text"] != "# Notes\n" || contents[0]["uri"] != "koneksi://file/file0" {
+		t.Errorf("Expected text contents, got %v", contents[0])
+	}
+
+	result = resultOf(t, server, `{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"koneksi://file/image"}}`)
+	contents = result["contents"].([]map[string]interface{})
+	if contents[0]["mimeType"] != "image/gif" || contents[0]["blob"] == nil {
+		t.Errorf("Expected a GIF blob, got %v", contents[0])
+	}
+
+	result = resultOf(t, server, `{"jsonrpc":"2.0","id":3,"method":"resources/read","params":{"uri":"koneksi://directory/docs"}}`)
+	contents = result["contents"].([]map[string]interface{})
+	if !strings.Contains(contents[0]["text"].(string), `"uri": "koneksi://file/file0"`) {
+		t.Errorf("Expected directory listing to reference file URIs, got %v", contents[0]["text"])
+	}
+
+	// Once listed, a file is read with the MIME type it was listed with
+	result = resultOf(t, server, `{"jsonrpc":"2.0","id":4,"method":"resources/read","params":{"uri":"koneksi://file/file0"}}`)
+	contents = result["contents"].([]map[string]interface{})
+	if contents[0]["mimeType"] != "application/json" || contents[0]["text"] != "# Notes\n" {
+		t.Errorf("Expected the listed MIME type, got %v", contents[0])
+	}
+
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":5,"method":"resources/read","params":{"uri":"https://example.com"}}`); err == nil {
+		t.Error("Expected error for a foreign URI")
+	}
+}
+
+func TestServer_ResourceTemplatesList(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	result := resultOf(t, server, `{"jsonrpc":"2.0","id":1,"method":"resources/templates/list","params":{}}`)
+	templates := result["resourceTemplates"].([]map[string]interface{})
+	if len(templates) != 2 {
+		t.Fatalf("Expected 2 templates, got %d", len(templates))
+	}
+	if templates[0]["uriTemplate"] != "koneksi://file/{fileId}" {
+		t.Errorf("Unexpected template %v", templates[0]["uriTemplate"])
+	}
+}
@@ -0,0 +1,319 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultDenyPatterns are the local files tools refuse to touch unless the
+// sandbox is configured otherwise: dotfiles and dot directories, which is
+// where .ssh, .aws, .gnupg, .env and most other credentials live, and
+// common private key and keystore files.
+var DefaultDenyPatterns = []string{
+	".*",
+	"*.pem", "*.key", "*.p12", "*.pfx", "*.jks", "*.keystore", "*.kdbx",
+	"id_rsa*", "id_dsa*", "id_ecdsa*", "id_ed25519*",
+}
+
+// rootsTimeout is how long the server waits for the client to answer roots/list
+const rootsTimeout = 10 * time.Second
+
+// Sandbox limits the local files that upload_file, backup_file,
+// download_file and restore_backup may read and write
+type Sandbox struct {
+	// Roots are the directories tools may use files in. Clients that
+	// support MCP roots narrow them down to their workspace roots. With no
+	// roots here and none from the client, any directory may be used.
+	Roots []string
+
+	// Deny are filepath.Match patterns matched against every element of a
+	// path below its root; a path with a matching element is refused
+	Deny []string
+}
+
+// SetSandbox sets which local files tools may use. The roots must be
+// existing directories; they are compared by their real paths, so a
+// symbolic link cannot lead out of them.
+func (s *Server) SetSandbox(sandbox Sandbox) error {
+	var roots []string
+	for _, root := range sandbox.Roots {
+		resolved, err := resolveRoot(root)
+		if err != nil {
+			return fmt.Errorf("invalid sandbox root %s: %w", root, err)
+		}
+		roots = append(roots, resolved)
+	}
+	for _, pattern := range sandbox.Deny {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+	}
+
+	s.sandboxMu.Lock()
+	defer s.sandboxMu.Unlock()
+
+	s.sandbox = Sandbox{Roots: roots, Deny: append([]string(nil), sandbox.Deny...)}
+	return nil
+}
+
+// resolveRoot returns the real path of a directory
+func resolveRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("not a directory")
+	}
+	return resolved, nil
+}
+
+// sandboxRead checks that a tool may read the file at path and returns its
+// real path, which the tool should open instead
+func (s *Server) sandboxRead(ctx context.Context, path string) (string, error) {
+	roots, restricted, deny, err := s.sandboxFor(ctx)
+	if err != nil {
+		return "", err
+	}
+	abs, err := absPath(path, roots)
+	if err != nil {
+		return "", err
+	}
+	if err := checkDenied(path, filepath.Base(abs), deny); err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	if err := checkPath(path, resolved, roots, restricted, deny); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// sandboxWrite checks that a tool may write the file at path and returns
+// its real path, and whether a file is there already. The file's directory
+// must already exist.
+func (s *Server) sandboxWrite(ctx context.Context, path string) (string, bool, error) {
+	roots, restricted, deny, err := s.sandboxFor(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	abs, err := absPath(path, roots)
+	if err != nil {
+		return "", false, err
+	}
+	if err := checkDenied(path, filepath.Base(abs), deny); err != nil {
+		return "", false, err
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if os.IsNotExist(err) {
+		return "", false, fmt.Errorf("directory %s does not exist", filepath.Dir(abs))
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	resolved := filepath.Join(dir, filepath.Base(abs))
+	if err := checkPath(path, resolved, roots, restricted, deny); err != nil {
+		return "", false, err
+	}
+
+	// A symbolic link in the file's place is replaced, not followed
+	info, err := os.Lstat(resolved)
+	if err == nil && info.IsDir() {
+		return "", false, fmt.Errorf("%s is a directory", path)
+	}
+	return resolved, err == nil, nil
+}
+
+// sandboxFor returns the roots that apply to the request ctx belongs to,
+// whether the request is restricted to them at all, and the deny patterns.
+// It fails when the client's roots cannot be listed, so that no file is used
+// that the client may have left out.
+func (s *Server) sandboxFor(ctx context.Context) ([]string, bool, []string, error) {
+	s.sandboxMu.RLock()
+	configured, deny := s.sandbox.Roots, s.sandbox.Deny
+	s.sandboxMu.RUnlock()
+
+	workspace, ok, err := s.sessionFrom(ctx).workspaceRoots(ctx)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if !ok {
+		return configured, len(configured) > 0, deny, nil
+	}
+	if len(configured) == 0 {
+		return workspace, true, deny, nil
+	}
+
+	// The client can only narrow the configured roots down
+	var roots []string
+	for _, w := range workspace {
+		for _, c := range configured {
+			switch {
+			case within(c, w):
+				roots = append(roots, w)
+			case within(w, c):
+				roots = append(roots, c)
+			}
+		}
+	}
+	return roots, true, deny, nil
+}
+
+// absPath makes path absolute. Relative paths are taken to be relative to
+// the first root, or to the working directory without roots.
+func absPath(path string, roots []string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	if len(roots) > 0 {
+		return filepath.Join(roots[0], path), nil
+	}
+	return filepath.Abs(path)
+}
+
+// checkPath checks the real path of a file against the roots and the deny
+// patterns. path is the path the tool was given, for error messages.
+func checkPath(path, resolved string, roots []string, restricted bool, deny []string) error {
+	rel := resolved
+	if restricted {
+		root := ""
+		for _, r := range roots {
+			if within(r, resolved) {
+				root = r
+				break
+			}
+		}
+		if root == "" {
+			if len(roots) == 0 {
+				return fmt.Errorf("%s is outside the allowed directories: none of the client's roots are allowed", path)
+			}
+			return fmt.Errorf("%s is outside the allowed directories %s", path, strings.Join(roots, ", "))
+		}
+		rel, _ = filepath.Rel(root, resolved)
+	}
+
+	for _, element := range strings.Split(filepath.ToSlash(rel), "/") {
+		if err := checkDenied(path, element, deny); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDenied refuses path if element, one of its elements, matches a deny pattern
+func checkDenied(path, element string, deny []string) error {
+	if element == "" || element == "." || element == ".." {
+		return nil
+	}
+	for _, pattern := range deny {
+		if matched, _ := filepath.Match(pattern, element); matched {
+			return fmt.Errorf("%s is not allowed: %s matches the deny pattern %q", path, element, pattern)
+		}
+	}
+	return nil
+}
+
+// within reports whether path is root or inside it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// clientRoots is the client's answer to roots/list, kept until it sends
+// notifications/roots/list_changed
+type clientRoots struct {
+	paths []string
+	ok    bool
+}
+
+// workspaceRoots returns the real paths of the local directories among the
+// client's roots. It reports false when the client does not support roots
+// or has none, and for remote sessions, whose roots are not on this machine.
+// A client whose roots are all unusable has an empty set of roots. It fails
+// when the client did not answer. Only answers are kept; the lock is not
+// held while waiting for one.
+func (sess *Session) workspaceRoots(ctx context.Context) ([]string, bool, error) {
+	if sess.remote || !sess.clientSupports("roots") {
+		return nil, false, nil
+	}
+
+	sess.rootsMu.Lock()
+	roots, generation := sess.roots, sess.rootsGeneration
+	sess.rootsMu.Unlock()
+	if roots != nil {
+		return roots.paths, roots.ok, nil
+	}
+
+	roots, err := sess.listRoots(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("the client's roots could not be listed, so no local file can be used: %w", err)
+	}
+
+	// Roots that changed while they were listed are listed again next time
+	sess.rootsMu.Lock()
+	if sess.rootsGeneration == generation {
+		sess.roots = roots
+	}
+	sess.rootsMu.Unlock()
+	return roots.paths, roots.ok, nil
+}
+
+// listRoots asks the client for its roots. Only file:// roots can be used;
+// others, and directories that do not exist, are skipped, which can leave
+// none.
+func (sess *Session) listRoots(ctx context.Context) (*clientRoots, error) {
+	ctx, cancel := context.WithTimeout(ctx, rootsTimeout)
+	defer cancel()
+
+	result, err := sess.request(ctx, "roots/list", nil)
+	if err != nil {
+		log.Printf("Failed to list the client's roots: %v", err)
+		return nil, err
+	}
+
+	listed := result.Get("roots").Array()
+	roots := &clientRoots{ok: len(listed) > 0}
+	for _, root := range listed {
+		uri := root.Get("uri").String()
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "file" {
+			log.Printf("Ignoring root %s: not a file:// URI", uri)
+			continue
+		}
+		path, err := resolveRoot(filepath.FromSlash(u.Path))
+		if err != nil {
+			log.Printf("Ignoring root %s: %v", uri, err)
+			continue
+		}
+		roots.paths = append(roots.paths, path)
+	}
+	return roots, nil
+}
+
+// forgetRoots drops the cached roots, so they are listed again when next needed
+func (sess *Session) forgetRoots() {
+	sess.rootsMu.Lock()
+	defer sess.rootsMu.Unlock()
+
+	sess.roots = nil
+	sess.rootsGeneration++
+}
@@ -0,0 +1,338 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+// writeFiles creates files with some content below dir
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServer_SandboxRead(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeFiles(t, root, "notes.txt", "docs/report.txt", ".env", ".ssh/config", "server.pem")
+	writeFiles(t, outside, "secret.txt")
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "innocent.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, ".env"), filepath.Join(root, "env.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer("test-server", "1.0.0", nil)
+	if err := server.SetSandbox(Sandbox{Roots: []string{root}, Deny: DefaultDenyPatterns}); err != nil {
+		t.Fatalf("Failed to set the sandbox: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(root, "notes.txt"), ""},
+		{"docs/report.txt", ""},
+		{filepath.Join(root, "docs", "..", "notes.txt"), ""},
+		{filepath.Join(outside, "secret.txt"), "outside the allowed directories"},
+		{filepath.Join(root, "..", filepath.Base(outside), "secret.txt"), "outside the allowed directories"},
+		{filepath.Join(root, "innocent.txt"), "outside the allowed directories"},
+		{filepath.Join(root, ".env"), `matches the deny pattern ".*"`},
+		{filepath.Join(root, ".ssh", "config"), `.ssh matches the deny pattern ".*"`},
+		{filepath.Join(root, "server.pem"), `matches the deny pattern "*.pem"`},
+		{filepath.Join(root, "env.txt"), `.env matches the deny pattern ".*"`},
+		{filepath.Join(root, "missing.txt"), "failed to open file"},
+	}
+
+	for _, tt := range tests {
+		resolved, err := server.sandboxRead(context.Background(), tt.path)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.path, err)
+			} else if filepath.Base(resolved) != filepath.Base(tt.path) {
+				t.Errorf("%s: unexpected real path %s", tt.path, resolved)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.path, tt.want, err)
+		}
+	}
+
+	// Without roots any directory may be used, but the deny patterns still apply
+	server.SetSandbox(Sandbox{Deny: DefaultDenyPatterns})
+	if _, err := server.sandboxRead(context.Background(), filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("Unexpected error without roots: %v", err)
+	}
+	if _, err := server.sandboxRead(context.Background(), filepath.Join(root, ".ssh", "config")); err == nil {
+		t.Error("Expected a dot directory to be refused without roots")
+	}
+
+	if err := server.SetSandbox(Sandbox{Roots: []string{filepath.Join(root, "notes.txt")}}); err == nil {
+		t.Error("Expected a file to be refused as a root")
+	}
+	if err := server.SetSandbox(Sandbox{Deny: []string{"["}}); err == nil {
+		t.Error("Expected an invalid deny pattern to be refused")
+	}
+}
+
+func TestServer_SandboxWrite(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "existing.txt")
+	if err := os.Symlink(t.TempDir(), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer("test-server", "1.0.0", nil)
+	if err := server.SetSandbox(Sandbox{Roots: []string{root}, Deny: DefaultDenyPatterns}); err != nil {
+		t.Fatalf("Failed to set the sandbox: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		exists bool
+		want   string
+	}{
+		{filepath.Join(root, "new.txt"), false, ""},
+		{filepath.Join(root, "existing.txt"), true, ""},
+		{filepath.Join(root, "missing", "new.txt"), false, "does not exist"},
+		{filepath.Join(root, "escape", "new.txt"), false, "outside the allowed directories"},
+		{filepath.Join(root, ".bashrc"), false, "deny pattern"},
+		{filepath.Join(root, "id_ed25519"), false, "deny pattern"},
+		{root, false, "is a directory"},
+	}
+
+	for _, tt := range tests {
+		_, exists, err := server.sandboxWrite(context.Background(), tt.path)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.path, err)
+			} else if exists != tt.exists {
+				t.Errorf("%s: expected exists to be %t", tt.path, tt.exists)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.path, tt.want, err)
+		}
+	}
+}
+
+func TestServer_DownloadFileSandbox(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("downloaded content"))
+	}))
+	defer mockServer.Close()
+
+	root := t.TempDir()
+	writeFiles(t, root, "existing.txt")
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := NewServer("test-server", "1.0.0", client)
+	if err := server.SetSandbox(Sandbox{Roots: []string{root}, Deny: DefaultDenyPatterns}); err != nil {
+		t.Fatalf("Failed to set the sandbox: %v", err)
+	}
+
+	download := func(outputPath string, overwrite bool) string {
+		response, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":"f1","outputPath":%q,"overwrite":%t}}}`, outputPath, overwrite))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(t, response)
+	}
+
+	existing := filepath.Join(root, "existing.txt")
+	if text := download(existing, false); !strings.Contains(text, "already exists") {
+		t.Errorf("Expected the existing file to be kept, got %q", text)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "existing.txt" {
+		t.Errorf("Expected the existing file to be unchanged, got %q", data)
+	}
+
+	if text := download(existing, true); !strings.Contains(text, "File downloaded successfully!") {
+		t.Errorf("Expected the existing file to be overwritten, got %q", text)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "downloaded content" {
+		t.Errorf("Expected the downloaded content, got %q", data)
+	}
+
+	// Missing directories are not created
+	if text := download(filepath.Join(root, "a", "b", "c.txt"), false); !strings.Contains(text, "does not exist") {
+		t.Errorf("Expected the missing directory to be refused, got %q", text)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a")); !os.IsNotExist(err) {
+		t.Errorf("Expected no directory to be created, got %v", err)
+	}
+}
+
+// rootsSession returns a session whose client declares roots and answers
+// roots/list with them, counting how often it was asked
+func rootsSession(t *testing.T, server *Server, roots *[]string, asked *int32) *Session {
+	t.Helper()
+
+	sess := server.NewSession()
+	t.Cleanup(sess.Close)
+	sess.SetNotifier(func(message interface{}) error {
+		m := message.(map[string]interface{})
+		if m["method"] != "roots/list" {
+			return nil
+		}
+		atomic.AddInt32(asked, 1)
+
+		var list []map[string]interface{}
+		for _, root := range *roots {
+			list = append(list, map[string]interface{}{"uri": (&url.URL{Scheme: "file", Path: filepath.ToSlash(root)}).String()})
+		}
+		list = append(list, map[string]interface{}{"uri": "https://example.com/repo"})
+		response, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      m["id"],
+			"result":  map[string]interface{}{"roots": list},
+		})
+		go sess.HandleMessage(string(response))
+		return nil
+	})
+
+	sess.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"roots":{"listChanged":true}}}}`)
+	sess.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	return sess
+}
+
+func TestServer_SandboxClientRoots(t *testing.T) {
+	configured := t.TempDir()
+	workspace := filepath.Join(configured, "project")
+	other := t.TempDir()
+	writeFiles(t, configured, "top.txt", "project/main.go")
+	writeFiles(t, other, "other.txt")
+
+	server := NewServer("test-server", "1.0.0", nil)
+	roots := []string{workspace}
+	var asked int32
+	sess := rootsSession(t, server, &roots, &asked)
+	ctx := withSession(context.Background(), sess)
+
+	// The client's roots become the sandbox
+	if _, err := server.sandboxRead(ctx, filepath.Join(workspace, "main.go")); err != nil {
+		t.Errorf("Unexpected error inside the client's root: %v", err)
+	}
+	if _, err := server.sandboxRead(ctx, filepath.Join(other, "other.txt")); err == nil {
+		t.Error("Expected a file outside the client's roots to be refused")
+	}
+	if _, err := server.sandboxRead(ctx, "main.go"); err != nil {
+		t.Errorf("Expected a relative path to be found in the client's root: %v", err)
+	}
+	if n := atomic.LoadInt32(&asked); n != 1 {
+		t.Errorf("Expected the roots to be listed once, got %d", n)
+	}
+
+	// After a change, the roots are listed again; roots outside the
+	// configured ones are not allowed
+	server.SetSandbox(Sandbox{Roots: []string{configured}})
+	roots = []string{workspace, other}
+	sess.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/roots/list_changed"}`)
+	if _, err := server.sandboxRead(ctx, filepath.Join(other, "other.txt")); err == nil {
+		t.Error("Expected a client root outside the configured roots to be refused")
+	}
+	if _, err := server.sandboxRead(ctx, filepath.Join(configured, "top.txt")); err == nil {
+		t.Error("Expected the configured root to be narrowed down to the client's roots")
+	}
+	if n := atomic.LoadInt32(&asked); n != 2 {
+		t.Errorf("Expected the roots to be listed again, got %d", n)
+	}
+
+	// Requests outside a session keep the configured sandbox
+	if _, err := server.sandboxRead(context.Background(), filepath.Join(configured, "top.txt")); err != nil {
+		t.Errorf("Unexpected error in the default session: %v", err)
+	}
+
+	// Roots that cannot be used leave nothing, not the configured roots
+	roots = []string{filepath.Join(configured, "missing")}
+	sess.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/roots/list_changed"}`)
+	if _, err := server.sandboxRead(ctx, filepath.Join(configured, "top.txt")); err == nil || !strings.Contains(err.Error(), "none of the client's roots are allowed") {
+		t.Errorf("Expected every file to be refused without a usable root, got %v", err)
+	}
+}
+
+func TestServer_SandboxRemoteSession(t *testing.T) {
+	configured := t.TempDir()
+	writeFiles(t, configured, "top.txt", "project/main.go")
+
+	server := NewServer("test-server", "1.0.0", nil)
+	server.SetSandbox(Sandbox{Roots: []string{configured}})
+	roots := []string{filepath.Join(configured, "project")}
+	var asked int32
+	sess := rootsSession(t, server, &roots, &asked)
+	sess.remote = true
+	ctx := withSession(context.Background(), sess)
+
+	// The roots of a remote client are paths on its own machine, so only
+	// the configured roots apply
+	if _, err := server.sandboxRead(ctx, filepath.Join(configured, "top.txt")); err != nil {
+		t.Errorf("Unexpected error inside the configured root: %v", err)
+	}
+	if n := atomic.LoadInt32(&asked); n != 0 {
+		t.Errorf("Expected a remote client not to be asked for its roots, got %d", n)
+	}
+}
+
+func TestServer_SandboxClientRootsUnavailable(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "notes.txt")
+
+	server := NewServer("test-server", "1.0.0", nil)
+	server.SetSandbox(Sandbox{Roots: []string{root}})
+
+	// The client declares roots but fails to list them
+	var asked int32
+	sess := server.NewSession()
+	t.Cleanup(sess.Close)
+	sess.SetNotifier(func(message interface{}) error {
+		m := message.(map[string]interface{})
+		if m["method"] != "roots/list" {
+			return nil
+		}
+		atomic.AddInt32(&asked, 1)
+		response, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      m["id"],
+			"error":   map[string]interface{}{"code": CodeInternalError, "message": "no workspace open"},
+		})
+		go sess.HandleMessage(string(response))
+		return nil
+	})
+	sess.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"roots":{}}}}`)
+	sess.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	ctx := withSession(context.Background(), sess)
+
+	// Files are refused rather than checked against the configured roots,
+	// and the failure is not kept
+	for i := 0; i < 2; i++ {
+		if _, err := server.sandboxRead(ctx, filepath.Join(root, "notes.txt")); err == nil || !strings.Contains(err.Error(), "roots could not be listed") {
+			t.Errorf("Expected the file to be refused, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&asked); n != 2 {
+		t.Errorf("Expected the roots to be asked for again after a failure, got %d", n)
+	}
+}
@@ -0,0 +1,228 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Argument structs describe their JSON schema with struct tags:
+//
+//	json        the property name; properties without omitempty are required
+//	description the property description
+//	enum        comma-separated allowed values
+//	pattern     a regular expression strings must match
+//	minimum     the least allowed number
+//	maximum     the greatest allowed number
+//	minLength   the least allowed string length
+//	maxLength   the greatest allowed string length
+//	default     the value used when the property is left out
+//
+// Fields without a json tag name are named as encoding/json would name them,
+// and fields tagged json:"-" are not part of the schema.
+
+// schemaField is an exported struct field as it appears in a schema
+type schemaField struct {
+	index    int
+	name     string
+	required bool
+	tag      reflect.StructTag
+}
+
+// schemaFields returns the fields of struct type t that are schema properties
+func schemaFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, schemaField{
+			index:    i,
+			name:     name,
+			required: !strings.Contains(","+options+",", ",omitempty,"),
+			tag:      field.Tag,
+		})
+	}
+	return fields
+}
+
+// schemaFor generates the JSON schema of values of type t. Structs become
+// objects that allow no other properties.
+func schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, field := range schemaFields(t) {
+			properties[field.name] = propertySchema(t.Field(field.index).Type, field.tag)
+			if field.required {
+				required = append(required, field.name)
+			}
+		}
+
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// Anything goes, as for interface{}
+		return map[string]interface{}{}
+	}
+}
+
+// propertySchema is the schema of a struct field, with the constraints of its tags
+func propertySchema(t reflect.Type, tag reflect.StructTag) map[string]interface{} {
+	schema := schemaFor(t)
+	kind := schema["type"]
+
+	if description := tag.Get("description"); description != "" {
+		schema["description"] = description
+	}
+	if enum, ok := tag.Lookup("enum"); ok {
+		var values []interface{}
+		for _, value := range strings.Split(enum, ",") {
+			values = append(values, tagValue(kind, value))
+		}
+		schema["enum"] = values
+	}
+	if pattern, ok := tag.Lookup("pattern"); ok {
+		schema["pattern"] = pattern
+	}
+	for _, key := range []string{"minimum", "maximum"} {
+		if value, ok := tag.Lookup(key); ok {
+			schema[key] = tagValue("number", value)
+		}
+	}
+	for _, key := range []string{"minLength", "maxLength"} {
+		if value, ok := tag.Lookup(key); ok {
+			schema[key] = tagValue("integer", value)
+		}
+	}
+	if value, ok := tag.Lookup("default"); ok {
+		schema["default"] = tagValue(kind, value)
+	}
+	return schema
+}
+
+// tagValue converts a tag value to the JSON type of the property it constrains
+func tagValue(kind interface{}, value string) interface{} {
+	switch kind {
+	case "integer":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// setDefaults sets the fields of the struct v points to that have a default tag
+func setDefaults(v reflect.Value) {
+	v = v.Elem()
+	for _, field := range schemaFields(v.Type()) {
+		value, ok := field.tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal([]byte(defaultJSON(v.Field(field.index).Kind(), value)), v.Field(field.index).Addr().Interface()); err != nil {
+			panic(fmt.Sprintf("invalid default %q for %s: %v", value, field.name, err))
+		}
+	}
+}
+
+// defaultJSON returns a default tag value as JSON for a field of the given kind
+func defaultJSON(kind reflect.Kind, value string) string {
+	if kind == reflect.String {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	return value
+}
+
+// decodeArguments decodes the JSON object of tool arguments into the struct
+// args points to, after setting its defaults. Missing required properties and
+// values of the wrong type are invalid params.
+func decodeArguments(raw []byte, args interface{}) error {
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &properties); err != nil || properties == nil {
+		return invalidParams("arguments must be an object")
+	}
+
+	v := reflect.ValueOf(args)
+	for _, field := range schemaFields(v.Elem().Type()) {
+		if value, ok := properties[field.name]; field.required && (!ok || string(value) == "null") {
+			return invalidParams("%s is required", field.name)
+		}
+	}
+
+	setDefaults(v)
+	if err := json.Unmarshal(raw, args); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return invalidParams("%s must be %s", typeErr.Field, jsonTypeName(typeErr.Type))
+		}
+		return invalidParams("failed to parse arguments: %v", err)
+	}
+	return nil
+}
+
+// jsonTypeName names the JSON type Go values of type t are decoded from
+func jsonTypeName(t reflect.Type) string {
+	kind, _ := schemaFor(t)["type"].(string)
+	if kind == "" {
+		return "a value"
+	}
+	return withArticle(kind)
+}
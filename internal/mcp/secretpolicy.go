@@ -0,0 +1,178 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/koneksi/mcp-server/internal/secrets"
+)
+
+// SecretPolicy is what upload_file, upload_content and backup_file do with
+// content that contains secrets. Whatever the policy, the secrets found are
+// reported back to the model.
+type SecretPolicy int
+
+const (
+	// SecretsBlock refuses to upload content with secrets
+	SecretsBlock SecretPolicy = iota
+
+	// SecretsWarn uploads content with secrets as it is
+	SecretsWarn
+
+	// SecretsRedact uploads content with its secrets masked
+	SecretsRedact
+)
+
+// ParseSecretPolicy parses the name of a policy: block, warn or redact
+func ParseSecretPolicy(name string) (SecretPolicy, error) {
+	switch name {
+	case "", "block":
+		return SecretsBlock, nil
+	case "warn":
+		return SecretsWarn, nil
+	case "redact":
+		return SecretsRedact, nil
+	default:
+		return SecretsBlock, fmt.Errorf("unknown secret policy %q, expected block, warn or redact", name)
+	}
+}
+
+func (p SecretPolicy) String() string {
+	switch p {
+	case SecretsWarn:
+		return "warn"
+	case SecretsRedact:
+		return "redact"
+	default:
+		return "block"
+	}
+}
+
+// SetSecretPolicy sets what uploads do with content that contains secrets.
+// The default is SecretsBlock.
+func (s *Server) SetSecretPolicy(policy SecretPolicy) {
+	s.toolMu.Lock()
+	defer s.toolMu.Unlock()
+
+	s.secretPolicy = policy
+}
+
+func (s *Server) getSecretPolicy() SecretPolicy {
+	s.toolMu.RLock()
+	defer s.toolMu.RUnlock()
+
+	return s.secretPolicy
+}
+
+// screenFile scans a local file for secrets before it is uploaded as name.
+// It returns the path to upload: the file itself, or under the redact
+// policy a redacted copy that remove deletes.
+func (s *Server) screenFile(ctx context.Context, name, path string) (string, []secrets.Finding, func(), error) {
+	noop := func() {}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, noop, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	describeProgress(ctx, "Scanning "+name+" for secrets")
+	findings, err := secrets.Scan(contextReader{ctx, file})
+	if err != nil {
+		return "", nil, noop, fmt.Errorf("failed to scan file for secrets: %w", err)
+	}
+
+	policy := s.getSecretPolicy()
+	if len(findings) == 0 || policy == SecretsWarn {
+		return path, findings, noop, nil
+	}
+	if policy == SecretsBlock {
+		return "", findings, noop, secretsBlocked(name, findings)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", nil, noop, fmt.Errorf("failed to redact secrets: %w", err)
+	}
+	tmp, err := os.CreateTemp("", "koneksi-redacted-*")
+	if err != nil {
+		return "", nil, noop, fmt.Errorf("failed to redact secrets: %w", err)
+	}
+	remove := func() { os.Remove(tmp.Name()) }
+
+	err = secrets.Redact(tmp, contextReader{ctx, file}, findings)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		return "", nil, noop, fmt.Errorf("failed to redact secrets: %w", err)
+	}
+	return tmp.Name(), findings, remove, nil
+}
+
+// screenContent scans content for secrets before it is uploaded as name,
+// and returns the content to upload
+func (s *Server) screenContent(name string, content []byte) ([]byte, []secrets.Finding, error) {
+	findings, err := secrets.Scan(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan content for secrets: %w", err)
+	}
+
+	policy := s.getSecretPolicy()
+	if len(findings) == 0 || policy == SecretsWarn {
+		return content, findings, nil
+	}
+	if policy == SecretsBlock {
+		return nil, findings, secretsBlocked(name, findings)
+	}
+
+	var redacted bytes.Buffer
+	if err := secrets.Redact(&redacted, bytes.NewReader(content), findings); err != nil {
+		return nil, nil, fmt.Errorf("failed to redact secrets: %w", err)
+	}
+	return redacted.Bytes(), findings, nil
+}
+
+func secretsBlocked(name string, findings []secrets.Finding) error {
+	return fmt.Errorf("%s was not uploaded because it appears to contain secrets:%s\nRemove them before uploading, or ask the user whether the file is safe to store.", name, formatFindings(findings))
+}
+
+// secretsReport is the part of an upload's result that tells the model about
+// the secrets found, if any
+func (s *Server) secretsReport(findings []secrets.Finding) string {
+	if len(findings) == 0 {
+		return ""
+	}
+	if s.getSecretPolicy() == SecretsRedact {
+		return "\n\nSecrets were redacted before upload:" + formatFindings(findings)
+	}
+	return "\n\nWarning: uploaded with what appear to be secrets:" + formatFindings(findings)
+}
+
+func formatFindings(findings []secrets.Finding) string {
+	var b strings.Builder
+	for _, f := range findings {
+		b.WriteString("\n- ")
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+// secretOutputs converts findings for structured output
+func secretOutputs(findings []secrets.Finding) []secretOutput {
+	var outputs []secretOutput
+	for _, f := range findings {
+		outputs = append(outputs, secretOutput{
+			Rule:        f.Rule,
+			Description: f.Description,
+			Line:        f.Line,
+			Column:      f.Column,
+			Preview:     f.Preview,
+		})
+	}
+	return outputs
+}
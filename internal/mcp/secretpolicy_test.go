@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+func TestServer_SecretPolicy(t *testing.T) {
+	const original = "APP_NAME=demo\nKONEKSI_API_CLIENT_SECRET=s3cr3t-value-42\n"
+	source := filepath.Join(t.TempDir(), "settings.txt")
+	if err := os.WriteFile(source, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var uploaded []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// The directory listing uploads check for existing files
+			w.Write([]byte(`{"data":{"files":[]}}`))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected a multipart upload: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		uploaded = append(uploaded, string(data))
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"file_id": "f1", "name": "settings.txt", "size": len(data)},
+		})
+	}))
+	defer mockServer.Close()
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	calls := map[string]string{
+		"upload_file":    fmt.Sprintf(`{"filePath":%q}`, source),
+		"backup_file":    fmt.Sprintf(`{"filePath":%q}`, source),
+		"upload_content": fmt.Sprintf(`{"fileName":"settings.txt","content":%q}`, base64.StdEncoding.EncodeToString([]byte(original))),
+	}
+
+	tests := []struct {
+		policy   SecretPolicy
+		uploaded string
+		report   string
+	}{
+		{SecretsBlock, "", "was not uploaded because it appears to contain secrets"},
+		{SecretsWarn, original, "Warning: uploaded with what appear to be secrets"},
+		{SecretsRedact, "APP_NAME=demo\nKONEKSI_API_CLIENT_SECRET=[REDACTED]\n", "Secrets were redacted before upload"},
+	}
+
+	for _, tt := range tests {
+		server.SetSecretPolicy(tt.policy)
+		for name, arguments := range calls {
+			uploaded = nil
+			response, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, name, arguments))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			text := resultText(t, response)
+			if !strings.Contains(text, tt.report) || !strings.Contains(text, "line 2, column 27: Secret assigned to a variable (s3cr***********)") {
+				t.Errorf("%s, %s: expected a report of the secret, got %q", tt.policy, name, text)
+			}
+			if strings.Contains(text, "s3cr3t-value-42") {
+				t.Errorf("%s, %s: the report must not reveal the secret, got %q", tt.policy, name, text)
+			}
+
+			if tt.uploaded == "" {
+				if len(uploaded) != 0 {
+					t.Errorf("%s, %s: expected nothing to be uploaded, got %q", tt.policy, name, uploaded)
+				}
+				continue
+			}
+			if len(uploaded) != 1 || uploaded[0] != tt.uploaded {
+				t.Errorf("%s, %s: expected %q to be uploaded, got %q", tt.policy, name, tt.uploaded, uploaded)
+			}
+		}
+	}
+
+	// The local file itself is never changed
+	if data, _ := os.ReadFile(source); string(data) != original {
+		t.Errorf("Expected the local file to be unchanged, got %q", data)
+	}
+}
@@ -1,13 +1,20 @@
 package mcp
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/koneksi/mcp-server/internal/backup"
+	"github.com/koneksi/mcp-server/internal/index"
 	"github.com/koneksi/mcp-server/internal/koneksi"
 	"github.com/tidwall/gjson"
 )
@@ -16,41 +23,164 @@ type Server struct {
 	name    string
 	version string
 	client  *koneksi.Client
+	indexer *index.Indexer
+
+	// session is the default session, used by the stdio transport and by
+	// the Server methods that stand in for it
+	session *Session
+
+	subMu    sync.Mutex
+	sessions map[*Session]struct{}
+	snapshot map[string]string
+	listing  string
+
+	// files are the files seen in directory listings, by ID
+	fileMu sync.Mutex
+	files  map[string]koneksi.FileInfo
+
+	promptMu    sync.RWMutex
+	prompts     map[string]Prompt
+	promptOrder []string
+
+	toolMu          sync.RWMutex
+	tools           map[string]Tool
+	toolOrder       []string
+	approval        ApprovalPolicy
+	secretPolicy    SecretPolicy
+	conflictDefault ConflictAction
+	readOnly        bool
+	dryRun          bool
+
+	sandboxMu sync.RWMutex
+	sandbox   Sandbox
+
+	uploadMu     sync.RWMutex
+	uploadPolicy *uploadPolicy
+
+	profileMu sync.RWMutex
+	profiles  *toolProfiles
 }
 
 func NewServer(name, version string, client *koneksi.Client) *Server {
-	return &Server{
+	s := &Server{
 		name:    name,
 		version: version,
 		client:  client,
+
+		sessions: make(map[*Session]struct{}),
+		prompts:  make(map[string]Prompt),
+		tools:    make(map[string]Tool),
+		sandbox:  Sandbox{Deny: DefaultDenyPatterns},
+	}
+	s.session = s.NewSession()
+
+	for _, prompt := range builtinPrompts {
+		s.AddPrompt(prompt)
 	}
+	s.addBuiltinTools()
+
+	return s
+}
+
+// SetIndexer enables the search_content tool and keeps the index updated on uploads
+func (s *Server) SetIndexer(indexer *index.Indexer) {
+	s.indexer = indexer
+	s.AddTool(s.searchContentTool())
+}
+
+// HandleMessage handles one raw JSON-RPC message in the default session, see
+// Session.HandleMessage
+func (s *Server) HandleMessage(message string) interface{} {
+	return s.session.HandleMessage(message)
 }
 
+// HandleRequest dispatches a single JSON-RPC request. Protocol errors are
+// returned as *RPCError; failures of a tool itself are reported in its result.
 func (s *Server) HandleRequest(requestStr string) (interface{}, error) {
+	return s.HandleRequestContext(context.Background(), requestStr)
+}
+
+// HandleRequestContext is HandleRequest with a context that is passed on to
+// tool handlers and Koneksi API calls, so cancelling it aborts the request.
+// The request belongs to the session carried by ctx, if any, and to the
+// default session otherwise.
+func (s *Server) HandleRequestContext(ctx context.Context, requestStr string) (interface{}, error) {
+	if !gjson.Valid(requestStr) {
+		return nil, newRPCError(CodeParseError, "parse error: invalid JSON")
+	}
+
 	// Parse JSON-RPC request
 	parsed := gjson.Parse(requestStr)
+	if err := validateRequest(parsed); err != nil {
+		return nil, err
+	}
 	method := parsed.Get("method").String()
 	id := parsed.Get("id").Value()
 
 	switch method {
 	case "initialize":
-		return s.handleInitialize(id)
+		return s.handleInitialize(s.sessionFrom(ctx), parsed, id)
+	case "ping":
+		return s.handlePing(id)
 	case "tools/list":
-		return s.handleToolsList(id)
+		return s.handleToolsList(ctx, id)
 	case "tools/call":
-		return s.handleToolCall(parsed, id)
+		return s.handleToolCall(ctx, parsed, id)
+	case "resources/list":
+		return s.handleResourcesList(ctx, parsed, id)
+	case "resources/read":
+		return s.handleResourcesRead(ctx, parsed, id)
+	case "resources/templates/list":
+		return s.handleResourceTemplatesList(id)
+	case "prompts/list":
+		return s.handlePromptsList(parsed, id)
+	case "prompts/get":
+		return s.handlePromptsGet(ctx, parsed, id)
+	case "resources/subscribe":
+		return s.handleResourcesSubscribe(s.sessionFrom(ctx), parsed, id)
+	case "resources/unsubscribe":
+		return s.handleResourcesUnsubscribe(s.sessionFrom(ctx), parsed, id)
 	default:
-		return nil, fmt.Errorf("unknown method: %s", method)
+		return nil, newRPCError(CodeMethodNotFound, "unknown method: %s", method)
+	}
+}
+
+// validateRequest checks the JSON-RPC 2.0 envelope of a request or notification
+func validateRequest(parsed gjson.Result) error {
+	if !parsed.IsObject() {
+		return newRPCError(CodeInvalidRequest, "invalid request: expected a JSON object")
+	}
+	if parsed.Get("jsonrpc").String() != "2.0" {
+		return newRPCError(CodeInvalidRequest, "invalid request: jsonrpc must be \"2.0\"")
+	}
+	if method := parsed.Get("method"); method.Type != gjson.String || method.String() == "" {
+		return newRPCError(CodeInvalidRequest, "invalid request: method must be a non-empty string")
+	}
+	if id := parsed.Get("id"); id.Exists() && id.Type != gjson.String && id.Type != gjson.Number && id.Type != gjson.Null {
+		return newRPCError(CodeInvalidRequest, "invalid request: id must be a string or number")
 	}
+	if params := parsed.Get("params"); params.Exists() && !params.IsObject() && !params.IsArray() {
+		return newRPCError(CodeInvalidRequest, "invalid request: params must be an object or array")
+	}
+	return nil
 }
 
-func (s *Server) handleInitialize(id interface{}) (interface{}, error) {
+func (s *Server) handleInitialize(sess *Session, parsed gjson.Result, id interface{}) (interface{}, error) {
+	params := parsed.Get("params")
+	version := negotiateProtocolVersion(params.Get("protocolVersion").String())
+	sess.setClient(version, params)
+
 	response := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"result": map[string]interface{}{
-			"protocolVersion": "2024-11-05",
+			"protocolVersion": version,
 			"capabilities": map[string]interface{}{
-				"tools": map[string]interface{}{},
+				"tools":     map[string]interface{}{},
+				"resources": map[string]interface{}{
+					"subscribe":   true,
+					"listChanged": true,
+				},
+				"prompts": map[string]interface{}{},
 			},
 			"serverInfo": map[string]interface{}{
 				"name":    s.name,
@@ -67,136 +197,33 @@ func (s *Server) handleInitialize(id interface{}) (interface{}, error) {
 	return response, nil
 }
 
-func (s *Server) handleToolsList(id interface{}) (interface{}, error) {
-	tools := []map[string]interface{}{
-		{
-			"name":        "upload_file",
-			"description": "Upload a file to Koneksi Storage",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"filePath": map[string]interface{}{
-						"type":        "string",
-						"description": "Path to the file to upload",
-					},
-					"directoryId": map[string]interface{}{
-						"type":        "string",
-						"description": "Directory ID to upload to (optional)",
-					},
-				},
-				"required": []string{"filePath"},
-			},
-		},
-		{
-			"name":        "download_file",
-			"description": "Download a file from Koneksi Storage",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"fileId": map[string]interface{}{
-						"type":        "string",
-						"description": "ID of the file to download",
-					},
-					"outputPath": map[string]interface{}{
-						"type":        "string",
-						"description": "Path where to save the downloaded file",
-					},
-				},
-				"required": []string{"fileId", "outputPath"},
-			},
-		},
-		{
-			"name":        "list_directories",
-			"description": "List all directories in Koneksi Storage",
-			"inputSchema": map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
-			},
-		},
-		{
-			"name":        "create_directory",
-			"description": "Create a new directory in Koneksi Storage",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"name": map[string]interface{}{
-						"type":        "string",
-						"description": "Name of the directory",
-					},
-					"description": map[string]interface{}{
-						"type":        "string",
-						"description": "Description of the directory",
-					},
-				},
-				"required": []string{"name"},
-			},
-		},
-		{
-			"name":        "search_files",
-			"description": "List files in a directory",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"directoryId": map[string]interface{}{
-						"type":        "string",
-						"description": "Directory ID to search in",
-					},
-				},
-				"required": []string{"directoryId"},
-			},
-		},
-		{
-			"name":        "upload_content",
-			"description": "Upload content directly to Koneksi Storage (for attached files)",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"fileName": map[string]interface{}{
-						"type":        "string",
-						"description": "Name for the file",
-					},
-					"content": map[string]interface{}{
-						"type":        "string",
-						"description": "Base64 encoded file content",
-					},
-					"directoryId": map[string]interface{}{
-						"type":        "string",
-						"description": "Directory ID to upload to (optional)",
-					},
-				},
-				"required": []string{"fileName", "content"},
-			},
-		},
-		{
-			"name":        "backup_file",
-			"description": "Backup a file with optional compression and encryption",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"filePath": map[string]interface{}{
-						"type":        "string",
-						"description": "Path to the file to backup",
-					},
-					"directoryId": map[string]interface{}{
-						"type":        "string",
-						"description": "Directory ID to backup to (optional)",
-					},
-					"compress": map[string]interface{}{
-						"type":        "boolean",
-						"description": "Compress the file before backup",
-					},
-					"encrypt": map[string]interface{}{
-						"type":        "boolean",
-						"description": "Encrypt the file before backup",
-					},
-					"encryptPassword": map[string]interface{}{
-						"type":        "string",
-						"description": "Password for encryption (optional)",
-					},
-				},
-				"required": []string{"filePath"},
-			},
-		},
+func (s *Server) handleToolsList(ctx context.Context, id interface{}) (interface{}, error) {
+	sess := s.sessionFrom(ctx)
+	structured := sess.supportsStructuredOutput()
+
+	tools := []map[string]interface{}{}
+	profile := s.profileFor(sess)
+	for _, tool := range s.listTools() {
+		info := tool.Info()
+		if !s.toolAvailable(info) || !profile.offers(info.Name) {
+			continue
+		}
+		info = profile.apply(info)
+		entry := map[string]interface{}{
+			"name":        info.Name,
+			"description": info.Description,
+			"inputSchema": info.InputSchema,
+		}
+		if structured && info.OutputSchema != nil {
+			entry["outputSchema"] = info.OutputSchema
+		}
+		if sess.supportsToolAnnotations() {
+			entry["annotations"] = annotationsResult(info)
+		}
+		if sess.supportsToolTitles() && info.Title != "" {
+			entry["title"] = info.Title
+		}
+		tools = append(tools, entry)
 	}
 
 	response := map[string]interface{}{
@@ -214,40 +241,65 @@ func (s *Server) handleToolsList(id interface{}) (interface{}, error) {
 	return response, nil
 }
 
-func (s *Server) handleToolCall(parsed gjson.Result, id interface{}) (interface{}, error) {
+func (s *Server) handleToolCall(ctx context.Context, parsed gjson.Result, id interface{}) (interface{}, error) {
 	toolName := parsed.Get("params.name").String()
-	args := parsed.Get("params.arguments").String()
-
-	var arguments map[string]interface{}
-	if err := json.Unmarshal([]byte(args), &arguments); err != nil {
-		return nil, fmt.Errorf("failed to parse arguments: %w", err)
+	if toolName == "" {
+		return nil, invalidParams("tool name is required")
 	}
 
-	var result interface{}
-	var err error
-
-	switch toolName {
-	case "upload_file":
-		result, err = s.uploadFile(arguments)
-	case "upload_content":
-		result, err = s.uploadContent(arguments)
-	case "download_file":
-		result, err = s.downloadFile(arguments)
-	case "list_directories":
-		result, err = s.listDirectories()
-	case "create_directory":
-		result, err = s.createDirectory(arguments)
-	case "search_files":
-		result, err = s.searchFiles(arguments)
-	case "backup_file":
-		result, err = s.backupFile(arguments)
-	default:
-		return nil, fmt.Errorf("unknown tool: %s", toolName)
+	tool, ok := s.lookupTool(toolName)
+	if !ok {
+		return nil, invalidParams("unknown tool: %s", toolName)
+	}
+	if !s.toolAvailable(tool.Info()) {
+		return nil, invalidParams("tool %s is not available: the server is read-only", toolName)
+	}
+	profile := s.profileFor(s.sessionFrom(ctx))
+	if !profile.offers(toolName) {
+		return nil, invalidParams("tool %s is not available in the %s profile", toolName, profile.name)
 	}
 
+	// Arguments are normally an object, but older clients send them as a JSON string
+	argsResult := parsed.Get("params.arguments")
+	args := argsResult.Raw
+	if argsResult.Type == gjson.String {
+		args = argsResult.String()
+	}
+	if !argsResult.Exists() {
+		args = "{}"
+	}
+	if !gjson.Valid(args) {
+		return nil, invalidParams("failed to parse arguments: invalid JSON")
+	}
+	withDefaults, err := profile.withDefaults(toolName, []byte(args))
 	if err != nil {
 		return nil, err
 	}
+	args = string(withDefaults)
+	info := tool.Info()
+	if err := validateArguments(info.InputSchema, []byte(args)); err != nil {
+		return nil, err
+	}
+
+	ctx = s.withProgress(ctx, parsed)
+
+	var result interface{}
+	err = s.checkApproval(ctx, info, args)
+	if err == nil {
+		result, err = tool.Call(ctx, []byte(args))
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) {
+			return nil, err
+		}
+		result = toolError(err)
+	}
+
+	// Clients that predate structured output only get the content
+	if m, ok := result.(map[string]interface{}); ok && !s.sessionFrom(ctx).supportsStructuredOutput() {
+		delete(m, "structuredContent")
+	}
 
 	return map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -256,16 +308,23 @@ func (s *Server) handleToolCall(parsed gjson.Result, id interface{}) (interface{
 	}, nil
 }
 
-func (s *Server) uploadFile(args map[string]interface{}) (interface{}, error) {
-	filePath, ok := args["filePath"].(string)
-	if !ok {
-		return nil, fmt.Errorf("filePath is required")
+func (s *Server) uploadFile(ctx context.Context, args *uploadFileArgs) (*ToolResult[uploadOutput], error) {
+	// Files go to the root directory unless one is given
+	directoryId := args.DirectoryID
+
+	filePath, err := s.sandboxRead(ctx, args.FilePath)
+	if err != nil {
+		return nil, err
 	}
 
-	directoryId, _ := args["directoryId"].(string)
+	uploadPath, findings, remove, err := s.screenFile(ctx, filepath.Base(args.FilePath), filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
 
 	// Read file
-	file, err := os.Open(filePath)
+	file, err := os.Open(uploadPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
@@ -276,151 +335,373 @@ func (s *Server) uploadFile(args map[string]interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	// Set directory ID if provided
-	if directoryId != "" {
-		s.client.DirectoryID = directoryId
-	} else {
-		// Clear any default directory ID if not specified
-		s.client.DirectoryID = ""
+	head, body, err := peekHead(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	dryRun := s.isDryRun(args.DryRun)
+	name, conflict, err := s.admitUpload(ctx, directoryId, filepath.Base(args.FilePath), args.Overwrite, dryRun, stat.Size(), head)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		sum, err := hashReader(ctx, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		output := uploadOutput{
+			FileName:        name,
+			Size:            stat.Size(),
+			SHA256:          sum,
+			DirectoryID:     directoryId,
+			Secrets:         secretOutputs(findings),
+			Redacted:        uploadPath != filePath,
+			DryRun:          true,
+			Transformations: uploadTransformations(uploadPath != filePath, findings, conflict),
+		}
+		lines := []string{
+			"Would upload: " + filePath,
+			"File Name: " + name,
+			"Directory: " + s.policyDirectory(directoryId),
+			fmt.Sprintf("Size: %d bytes", stat.Size()),
+			"SHA-256: " + sum,
+		}
+		return &ToolResult[uploadOutput]{
+			Content:    dryRunContent(lines, output.Transformations, findings),
+			Structured: output,
+		}, nil
 	}
 
 	// Upload file
-	resp, err := s.client.UploadFile(filepath.Base(filePath), file, stat.Size(), "")
+	describeProgress(ctx, "Uploading "+name)
+	hash := sha256.New()
+	resp, err := s.client.UploadFileToDirectoryContext(ctx, directoryId, name, io.TeeReader(body, hash), stat.Size(), "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file: %w", err)
 	}
+	finishProgress(ctx)
+
+	s.indexFile(resp, directoryId, uploadPath)
 
 	content := fmt.Sprintf("File uploaded successfully!\nFile ID: %s\nFile Name: %s\nSize: %d bytes", 
 		resp.FileID, resp.FileName, resp.Size)
+	content += s.secretsReport(findings)
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
-		},
+	output := newUploadOutput(resp, directoryId, hash.Sum(nil))
+	output.Secrets, output.Redacted = secretOutputs(findings), uploadPath != filePath
+
+	return &ToolResult[uploadOutput]{
+		Content:    s.uploadContentItems(ctx, content, resp),
+		Structured: output,
 	}, nil
 }
 
-func (s *Server) uploadContent(args map[string]interface{}) (interface{}, error) {
-	fileName, ok := args["fileName"].(string)
-	if !ok {
-		return nil, fmt.Errorf("fileName is required")
-	}
+func (s *Server) uploadContent(ctx context.Context, args *uploadContentArgs) (*ToolResult[uploadOutput], error) {
+	fileName := args.FileName
+	contentBase64 := args.Content
 
-	contentBase64, ok := args["content"].(string)
-	if !ok {
-		return nil, fmt.Errorf("content is required")
+	// Content goes to the configured directory unless one is given
+	directoryId := args.DirectoryID
+	if directoryId == "" {
+		directoryId = s.client.DirectoryID
 	}
 
-	directoryId, _ := args["directoryId"].(string)
-
 	// Decode base64 content
 	fileContent, err := base64.StdEncoding.DecodeString(contentBase64)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode base64 content: %w", err)
 	}
 
+	fileContent, findings, err := s.screenContent(fileName, fileContent)
+	if err != nil {
+		return nil, err
+	}
+	dryRun := s.isDryRun(args.DryRun)
+	fileName, conflict, err := s.admitUpload(ctx, directoryId, fileName, args.Overwrite, dryRun, int64(len(fileContent)), fileContent)
+	if err != nil {
+		return nil, err
+	}
+	redacted := len(findings) > 0 && s.getSecretPolicy() == SecretsRedact
+
+	if dryRun {
+		hash := sha256.Sum256(fileContent)
+		output := uploadOutput{
+			FileName:        fileName,
+			Size:            int64(len(fileContent)),
+			SHA256:          hex.EncodeToString(hash[:]),
+			DirectoryID:     directoryId,
+			Secrets:         secretOutputs(findings),
+			Redacted:        redacted,
+			DryRun:          true,
+			Transformations: uploadTransformations(redacted, findings, conflict),
+		}
+		lines := []string{
+			"Would upload: " + fileName,
+			"Directory: " + s.policyDirectory(directoryId),
+			fmt.Sprintf("Size: %d bytes", output.Size),
+			"SHA-256: " + output.SHA256,
+		}
+		return &ToolResult[uploadOutput]{
+			Content:    dryRunContent(lines, output.Transformations, findings),
+			Structured: output,
+		}, nil
+	}
+
 	// Upload using the new method
-	resp, err := s.client.UploadFileFromBytes(fileName, fileContent, directoryId)
+	describeProgress(ctx, "Uploading "+fileName)
+	resp, err := s.client.UploadFileFromBytesContext(ctx, fileName, fileContent, directoryId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload content: %w", err)
 	}
+	finishProgress(ctx)
+
+	if s.indexer != nil {
+		s.indexer.IndexContent(resp.FileID, fileName, directoryId, "", fileContent)
+	}
 
 	content := fmt.Sprintf("Content uploaded successfully!\nFile ID: %s\nFile Name: %s\nSize: %d bytes", 
 		resp.FileID, resp.FileName, resp.Size)
+	content += s.secretsReport(findings)
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
+	hash := sha256.Sum256(fileContent)
+	output := newUploadOutput(resp, directoryId, hash[:])
+	output.Secrets = secretOutputs(findings)
+	output.Redacted = redacted
+
+	return &ToolResult[uploadOutput]{
+		Content:    s.uploadContentItems(ctx, content, resp),
+		Structured: output,
+	}, nil
+}
+
+func (s *Server) downloadFile(ctx context.Context, args *downloadFileArgs) (*ToolResult[downloadOutput], error) {
+	output, err := s.saveFile(ctx, args.FileID, args.OutputPath, args.Overwrite, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	content := fmt.Sprintf("File downloaded successfully!\nSaved to: %s\nSize: %d bytes", output.Path, output.Size)
+
+	return &ToolResult[downloadOutput]{
+		Content:    textContent(content),
+		Structured: output,
+	}, nil
+}
+
+func (s *Server) restoreBackup(ctx context.Context, args *restoreBackupArgs) (*ToolResult[restoreOutput], error) {
+	opts := backup.Options{Compress: args.Decompress, Password: args.DecryptPassword}
+	restore := func(r io.Reader) (io.Reader, error) {
+		return backup.NewReader(r, opts)
+	}
+
+	saved, err := s.saveFile(ctx, args.FileID, args.OutputPath, args.Overwrite, restore)
+	if err != nil {
+		return nil, err
+	}
+
+	content := fmt.Sprintf("Backup restored successfully!\nSaved to: %s\nSize: %d bytes\nDecompressed: %t\nDecrypted: %t", 
+		saved.Path, saved.Size, opts.Compress, opts.Password != "")
+
+	return &ToolResult[restoreOutput]{
+		Content: textContent(content),
+		Structured: restoreOutput{
+			FileID:       saved.FileID,
+			Path:         saved.Path,
+			Size:         saved.Size,
+			SHA256:       saved.SHA256,
+			Decompressed: opts.Compress,
+			Decrypted:    opts.Password != "",
 		},
 	}, nil
 }
 
-func (s *Server) downloadFile(args map[string]interface{}) (interface{}, error) {
-	fileId, ok := args["fileId"].(string)
-	if !ok {
-		return nil, fmt.Errorf("fileId is required")
+// saveFile downloads a stored file to a local path, passing it through
+// restore first unless that is nil. Existing files are only replaced if the
+// user or the call says so, and a failed download leaves nothing behind.
+func (s *Server) saveFile(ctx context.Context, fileId, outputPath string, overwriteArg bool, restore func(io.Reader) (io.Reader, error)) (downloadOutput, error) {
+	target, exists, err := s.sandboxWrite(ctx, outputPath)
+	if err != nil {
+		return downloadOutput{}, err
 	}
 
-	outputPath, ok := args["outputPath"].(string)
-	if !ok {
-		return nil, fmt.Errorf("outputPath is required")
+	// Existing files are only replaced if the user, the call or the
+	// configured default says so
+	overwrite := false
+	if exists {
+		action, name, err := s.resolveConflict(ctx, outputPath, overwriteArg, freeLocalName(target))
+		if err != nil {
+			return downloadOutput{}, err
+		}
+		overwrite = action == ConflictOverwrite
+		if action == ConflictRename {
+			outputPath = filepath.Join(filepath.Dir(outputPath), name)
+			if target, exists, err = s.sandboxWrite(ctx, outputPath); err != nil {
+				return downloadOutput{}, err
+			}
+			if exists {
+				return downloadOutput{}, fmt.Errorf("%s already exists too", outputPath)
+			}
+		}
 	}
 
 	// Download file
-	reader, err := s.client.DownloadFile(fileId)
+	describeProgress(ctx, "Downloading "+filepath.Base(outputPath))
+	reader, err := s.client.DownloadFileContext(ctx, fileId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download file: %w", err)
+		return downloadOutput{}, fmt.Errorf("failed to download file: %w", err)
 	}
 	defer reader.Close()
 
-	// Create output directory if needed
-	dir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+	var content io.Reader = reader
+	if restore != nil {
+		if content, err = restore(reader); err != nil {
+			return downloadOutput{}, fmt.Errorf("failed to restore backup: %w", err)
+		}
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	// Download into a temporary file next to the output, so a failed or
+	// cancelled download never leaves a partial file behind
+	outFile, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.part")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %w", err)
+		return downloadOutput{}, fmt.Errorf("failed to create output file: %w", err)
+	}
+	tmpPath := outFile.Name()
+	defer os.Remove(tmpPath)
+
+	// Temporary files are private; give the download the usual permissions
+	if err := outFile.Chmod(0644); err != nil {
+		outFile.Close()
+		return downloadOutput{}, fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer outFile.Close()
 
-	// Copy data
-	written, err := io.Copy(outFile, reader)
+	// Copy data, hashing it on the way
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(outFile, hash), content)
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to write file: %w", err)
+		return downloadOutput{}, fmt.Errorf("failed to write file: %w", err)
 	}
+	finishProgress(ctx)
 
-	content := fmt.Sprintf("File downloaded successfully!\nSaved to: %s\nSize: %d bytes", outputPath, written)
+	// Without overwrite, linking fails if a file appeared at the target
+	// during the download
+	if overwrite {
+		err = os.Rename(tmpPath, target)
+	} else {
+		err = os.Link(tmpPath, target)
+	}
+	if os.IsExist(err) {
+		return downloadOutput{}, fmt.Errorf("%s already exists, set overwrite to replace it", outputPath)
+	}
+	if err != nil {
+		return downloadOutput{}, fmt.Errorf("failed to write file: %w", err)
+	}
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
-		},
+	return downloadOutput{
+		FileID: fileId,
+		Path:   outputPath,
+		Size:   written,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
 	}, nil
 }
 
-func (s *Server) listDirectories() (interface{}, error) {
-	directories, err := s.client.ListDirectories()
+func (s *Server) readFile(ctx context.Context, args *readFileArgs) (*ToolResult[readFileOutput], error) {
+	fileId := args.FileID
+	offset, length := args.Offset, args.Length
+	if length > maxReadLength {
+		length = maxReadLength
+	}
+
+	reader, err := s.client.DownloadFileContext(ctx, fileId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer reader.Close()
+
+	fc, err := readContent(reader, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	output := readFileOutput{
+		FileID:   fileId,
+		MimeType: fc.MimeType,
+		Charset:  fc.Charset,
+		Text:     fc.Text,
+		Offset:   fc.Offset,
+		End:      fc.End,
+	}
+
+	content := fc.contentItems(fileURI(fileId))
+	if fc.IsText() && (fc.Offset > 0 || fc.Next >= 0) {
+		note := fmt.Sprintf("[Showing bytes %d-%d of file %s (%s, %s)", fc.Offset, fc.End, fileId, fc.MimeType, fc.Charset)
+		if fc.Next >= 0 {
+			note += fmt.Sprintf("; more content available, call read_file with offset=%d", fc.Next)
+			output.Next = &fc.Next
+		}
+		content = append(content, map[string]interface{}{
+			"type": "text",
+			"text": note + "]",
+		})
+	}
+
+	return &ToolResult[readFileOutput]{
+		Content:    content,
+		Structured: output,
+	}, nil
+}
+
+func (s *Server) listDirectories(ctx context.Context, _ *listDirectoriesArgs) (*ToolResult[listDirectoriesOutput], error) {
+	directories, err := s.client.ListDirectoriesContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list directories: %w", err)
 	}
 
 	content := "Directories:\n"
+	output := listDirectoriesOutput{Directories: []directoryOutput{}}
 	for _, dir := range directories {
 		content += fmt.Sprintf("- %s (ID: %s)\n  Files: %d, Size: %d bytes\n  Created: %s\n", 
 			dir.Name, dir.ID, dir.FileCount, dir.TotalSize, dir.CreatedAt.Format("2006-01-02 15:04:05"))
+		output.Directories = append(output.Directories, directoryOutput{
+			ID:          dir.ID,
+			Name:        dir.Name,
+			Description: dir.Description,
+			FileCount:   dir.FileCount,
+			TotalSize:   dir.TotalSize,
+			CreatedAt:   dir.CreatedAt,
+			URI:         directoryURI(dir.ID),
+		})
 	}
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
-		},
+	return &ToolResult[listDirectoriesOutput]{
+		Content:    textContent(content),
+		Structured: output,
 	}, nil
 }
 
-func (s *Server) createDirectory(args map[string]interface{}) (interface{}, error) {
-	name, ok := args["name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("name is required")
+func (s *Server) createDirectory(ctx context.Context, args *createDirectoryArgs) (*ToolResult[createDirectoryOutput], error) {
+	name := args.Name
+	description := args.Description
+
+	if err := s.checkCreateDirectory(); err != nil {
+		return nil, err
 	}
 
-	description, _ := args["description"].(string)
+	if s.isDryRun(args.DryRun) {
+		return &ToolResult[createDirectoryOutput]{
+			Content: textContent(fmt.Sprintf("Dry run, nothing was changed.\nWould create directory: %s\nDescription: %s", name, description)),
+			Structured: createDirectoryOutput{
+				Name:        name,
+				Description: description,
+				DryRun:      true,
+			},
+		}, nil
+	}
 
-	resp, err := s.client.CreateDirectory(name, description)
+	resp, err := s.client.CreateDirectoryContext(ctx, name, description)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
@@ -428,58 +709,73 @@ func (s *Server) createDirectory(args map[string]interface{}) (interface{}, erro
 	content := fmt.Sprintf("Directory created!\nID: %s\nName: %s\nDescription: %s", 
 		resp.DirectoryID, resp.Name, resp.Description)
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
+	return &ToolResult[createDirectoryOutput]{
+		Content: textContent(content),
+		Structured: createDirectoryOutput{
+			DirectoryID: resp.DirectoryID,
+			Name:        resp.Name,
+			Description: resp.Description,
+			CreatedAt:   &resp.CreatedAt,
+			URI:         directoryURI(resp.DirectoryID),
 		},
 	}, nil
 }
 
-func (s *Server) searchFiles(args map[string]interface{}) (interface{}, error) {
-	directoryId, ok := args["directoryId"].(string)
-	if !ok {
-		return nil, fmt.Errorf("directoryId is required")
-	}
+func (s *Server) searchFiles(ctx context.Context, args *searchFilesArgs) (*ToolResult[searchFilesOutput], error) {
+	directoryId := args.DirectoryID
 
-	files, err := s.client.GetDirectoryFiles(directoryId)
+	files, err := s.client.GetDirectoryFilesContext(ctx, directoryId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get directory files: %w", err)
 	}
 
 	content := fmt.Sprintf("Files in directory %s:\n", directoryId)
+	output := searchFilesOutput{DirectoryID: directoryId, Files: []fileOutput{}}
 	for _, file := range files {
 		content += fmt.Sprintf("- %s (ID: %s, Size: %d bytes)\n", file.Name, file.ID, file.Size)
+		output.Files = append(output.Files, fileOutput{
+			ID:          file.ID,
+			Name:        file.Name,
+			Size:        file.Size,
+			ContentType: file.ContentType,
+			Hash:        file.Hash,
+			URI:         fileURI(file.ID),
+		})
 	}
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
-		},
+	return &ToolResult[searchFilesOutput]{
+		Content:    textContent(content),
+		Structured: output,
 	}, nil
 }
 
-func (s *Server) backupFile(args map[string]interface{}) (interface{}, error) {
-	filePath, ok := args["filePath"].(string)
-	if !ok {
-		return nil, fmt.Errorf("filePath is required")
+func (s *Server) backupFile(ctx context.Context, args *backupFileArgs) (*ToolResult[backupOutput], error) {
+	if args.Encrypt && args.EncryptPassword == "" {
+		return nil, invalidParams("encryptPassword is required to encrypt")
 	}
 
-	directoryId, _ := args["directoryId"].(string)
-	compress, _ := args["compress"].(bool)
-	encrypt, _ := args["encrypt"].(bool)
-	encryptPassword, _ := args["encryptPassword"].(string)
+	opts := backup.Options{Compress: args.Compress}
+	if args.Encrypt {
+		opts.Password = args.EncryptPassword
+	}
 
-	// For now, this is a simplified backup that just uploads the file
-	// In a full implementation, you would integrate with the compression
-	// and encryption packages from the main project
+	directoryId := args.DirectoryID
+	if directoryId == "" {
+		directoryId = s.client.DirectoryID
+	}
 
-	file, err := os.Open(filePath)
+	filePath, err := s.sandboxRead(ctx, args.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	backupPath, findings, remove, err := s.screenFile(ctx, filepath.Base(args.FilePath), filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	file, err := os.Open(backupPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
@@ -490,36 +786,244 @@ func (s *Server) backupFile(args map[string]interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	if directoryId != "" {
-		s.client.DirectoryID = directoryId
+	fileName := filepath.Base(args.FilePath) + opts.Extension()
+	describeProgress(ctx, "Backing up "+filepath.Base(args.FilePath))
+
+	// The upload policy checks the type of the file itself, not of its
+	// compressed or encrypted backup
+	head, content, err := peekHead(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Plain backups are uploaded straight from the file; others are
+	// transformed into a temporary file first, as uploads need their size
+	size := stat.Size()
+	if opts.Compress || opts.Password != "" {
+		tmp, err := os.CreateTemp("", "koneksi-backup-*"+opts.Extension())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if err := backup.Write(tmp, contextReader{ctx, content}, opts); err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
+		if size, err = tmp.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
+		content = tmp
 	}
 
-	fileName := filepath.Base(filePath)
-	if compress {
-		fileName += ".gz"
+	dryRun := s.isDryRun(args.DryRun)
+	fileName, conflict, err := s.admitUpload(ctx, directoryId, fileName, args.Overwrite, dryRun, size, head)
+	if err != nil {
+		return nil, err
 	}
-	if encrypt {
-		fileName += ".enc"
+
+	if dryRun {
+		sum, err := hashReader(ctx, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		var steps []string
+		if opts.Compress {
+			steps = append(steps, "compressed with gzip")
+		}
+		if opts.Password != "" {
+			steps = append(steps, "encrypted with AES-256-GCM")
+		}
+		output := backupOutput{
+			FileName:        fileName,
+			Size:            size,
+			OriginalSize:    stat.Size(),
+			SHA256:          sum,
+			DirectoryID:     directoryId,
+			Compressed:      opts.Compress,
+			Encrypted:       opts.Password != "",
+			Secrets:         secretOutputs(findings),
+			Redacted:        backupPath != filePath,
+			DryRun:          true,
+			Transformations: uploadTransformations(backupPath != filePath, findings, conflict, steps...),
+		}
+		lines := []string{
+			"Would back up: " + filePath,
+			"File Name: " + fileName,
+			"Directory: " + s.policyDirectory(directoryId),
+			fmt.Sprintf("Size: %d bytes (%d bytes before backup)", size, stat.Size()),
+			"SHA-256: " + sum,
+		}
+		return &ToolResult[backupOutput]{
+			Content:    dryRunContent(lines, output.Transformations, findings),
+			Structured: output,
+		}, nil
 	}
 
-	resp, err := s.client.UploadFile(fileName, file, stat.Size(), "")
+	hash := sha256.New()
+	resp, err := s.client.UploadFileToDirectoryContext(ctx, directoryId, fileName, io.TeeReader(content, hash), size, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to backup file: %w", err)
 	}
+	finishProgress(ctx)
 
-	content := fmt.Sprintf("File backed up successfully!\nFile ID: %s\nFile Name: %s\nSize: %d bytes\nCompression: %t\nEncryption: %t", 
-		resp.FileID, resp.FileName, resp.Size, compress, encrypt)
-
-	if encrypt && encryptPassword != "" {
-		content += "\nEncryption password was provided"
+	// Compressed or encrypted backups are not plain text anymore
+	if !opts.Compress && opts.Password == "" {
+		s.indexFile(resp, directoryId, backupPath)
 	}
 
-	return map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": content,
-			},
+	text := fmt.Sprintf("File backed up successfully!\nFile ID: %s\nFile Name: %s\nSize: %d bytes\nCompression: %t\nEncryption: %t", 
+		resp.FileID, resp.FileName, resp.Size, opts.Compress, opts.Password != "")
+	text += s.secretsReport(findings)
+
+	return &ToolResult[backupOutput]{
+		Content: s.uploadContentItems(ctx, text, resp),
+		Structured: backupOutput{
+			FileID:       resp.FileID,
+			FileName:     resp.FileName,
+			Size:         resp.Size,
+			OriginalSize: stat.Size(),
+			SHA256:       hex.EncodeToString(hash.Sum(nil)),
+			DirectoryID:  directoryId,
+			Compressed:   opts.Compress,
+			Encrypted:    opts.Password != "",
+			URI:          fileURI(resp.FileID),
+			Secrets:      secretOutputs(findings),
+			Redacted:     backupPath != filePath,
 		},
 	}, nil
-}
\ No newline at end of file
+}
+
+// contextReader stops reading once its context is done, so that long
+// transformations of a file end when the request is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func (s *Server) searchContent(_ context.Context, args *searchContentArgs) (*ToolResult[searchContentOutput], error) {
+	query := args.Query
+	if strings.TrimSpace(query) == "" {
+		return nil, invalidParams("query is required")
+	}
+
+	results := s.indexer.Search(query, args.DirectoryID, args.Limit)
+	indexing := s.indexer.LastSync().IsZero()
+
+	var content string
+	if len(results) == 0 {
+		content = fmt.Sprintf("No stored files match %q", query)
+		if indexing {
+			content += "\n(The index is still being built; try again shortly)"
+		}
+	} else {
+		content = fmt.Sprintf("Files matching %q:\n", query)
+		for _, r := range results {
+			content += fmt.Sprintf("- %s (ID: %s, Directory: %s, Score: %.2f)\n  %s\n",
+				r.Name, r.ID, r.DirectoryID, r.Score, r.Snippet)
+		}
+	}
+
+	output := searchContentOutput{Query: query, Results: []searchMatchOutput{}, Indexing: indexing}
+	for _, r := range results {
+		output.Results = append(output.Results, searchMatchOutput{
+			ID:          r.ID,
+			Name:        r.Name,
+			DirectoryID: r.DirectoryID,
+			Score:       r.Score,
+			Snippet:     r.Snippet,
+			URI:         fileURI(r.ID),
+		})
+	}
+
+	return &ToolResult[searchContentOutput]{
+		Content:    textContent(content),
+		Structured: output,
+	}, nil
+}
+
+// textContent is the content of a result that is just text
+func textContent(text string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type": "text",
+			"text": text,
+		},
+	}
+}
+
+// uploadContentItems builds the content of a tool that uploaded a file.
+// Clients on a protocol version with resource links also get a link to the
+// new file.
+func (s *Server) uploadContentItems(ctx context.Context, text string, resp *koneksi.FileUploadResponse) []map[string]interface{} {
+	content := textContent(text)
+
+	if s.sessionFrom(ctx).supportsResourceLinks() && resp.FileID != "" {
+		name := resp.FileName
+		if name == "" {
+			name = resp.FileID
+		}
+		link := map[string]interface{}{
+			"type":     "resource_link",
+			"uri":      fileURI(resp.FileID),
+			"name":     name,
+			"mimeType": fileMimeType(koneksi.FileInfo{Name: resp.FileName}),
+		}
+		if resp.Size > 0 {
+			link["size"] = resp.Size
+		}
+		content = append(content, link)
+	}
+
+	return content
+}
+
+// newUploadOutput is the structured result of an upload
+func newUploadOutput(resp *koneksi.FileUploadResponse, directoryId string, hash []byte) uploadOutput {
+	return uploadOutput{
+		FileID:      resp.FileID,
+		FileName:    resp.FileName,
+		Size:        resp.Size,
+		SHA256:      hex.EncodeToString(hash),
+		DirectoryID: directoryId,
+		URI:         fileURI(resp.FileID),
+	}
+}
+
+// indexFile adds a just-uploaded local file to the content index if it is text
+func (s *Server) indexFile(resp *koneksi.FileUploadResponse, directoryId, filePath string) {
+	if s.indexer == nil {
+		return
+	}
+
+	name := resp.FileName
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+	if !index.IsText(name, "") {
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, s.indexer.MaxFileSize+1))
+	if err != nil {
+		return
+	}
+
+	s.indexer.IndexContent(resp.FileID, name, directoryId, "", content)
+}
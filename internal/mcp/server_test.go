@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/koneksi/mcp-server/internal/index"
 	"github.com/koneksi/mcp-server/internal/koneksi"
 )
 
@@ -93,6 +94,7 @@ func TestServer_HandleToolsList(t *testing.T) {
 	expectedTools := []string{
 		"upload_file", "download_file", "list_directories", 
 		"create_directory", "search_files", "upload_content", "backup_file",
+		"restore_backup", "read_file",
 	}
 	
 	if len(tools) != len(expectedTools) {
@@ -479,7 +481,7 @@ func TestServer_ErrorHandling(t *testing.T) {
 		{
 			name:    "invalid JSON",
 			request: `{invalid json}`,
-			errMsg:  "unknown method",
+			errMsg:  "parse error",
 		},
 		{
 			name:    "unknown tool",
@@ -569,4 +571,102 @@ func TestServer_HandleToolCall_RequiredParameters(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestServer_HandleToolCall_SearchContent(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"file_id": "notes-id",
+				"name":    "notes.md",
+				"size":    38,
+			},
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := NewServer("test-server", "1.0.0", client)
+	server.SetIndexer(index.NewIndexer(client, index.New()))
+
+	// Uploaded text content is indexed straight away
+	upload := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":"notes.md","content":"QWN0aW9uIGl0ZW1zOiByZW5ldyB0aGUgVExTIGNlcnRpZmljYXRl"}}}`
+	if _, err := server.HandleRequest(upload); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"search_content","arguments":{"query":"certificate"}}}`
+	response, err := server.HandleRequest(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := response.(map[string]interface{})["result"].(map[string]interface{})
+	text := result["content"].([]map[string]interface{})[0]["text"].(string)
+
+	if !strings.Contains(text, "notes-id") {
+		t.Errorf("Expected result to contain the file ID, got %s", text)
+	}
+	if !strings.Contains(text, "**certificate**") {
+		t.Errorf("Expected result to contain a highlighted snippet, got %s", text)
+	}
+}
+
+func TestServer_HandleToolCall_ReadFile(t *testing.T) {
+	pngHeader := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n', 0x00, 0x00, 0x00, 0x0D}
+	files := map[string][]byte{
+		"text-id":  []byte("line one\nline two\n"),
+		"image-id": pngHeader,
+		"zip-id":   append([]byte("PK\x03\x04"), make([]byte, 16)...),
+	}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/clients/v1/files/"), "/download")
+		w.WriteHeader(http.StatusOK)
+		w.Write(files[id])
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := NewServer("test-server", "1.0.0", client)
+
+	call := func(args string) []map[string]interface{} {
+		request := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file","arguments":%s}}`, args)
+		response, err := server.HandleRequest(request)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		result := response.(map[string]interface{})["result"].(map[string]interface{})
+		return result["content"].([]map[string]interface{})
+	}
+
+	content := call(`{"fileId":"text-id"}`)
+	if len(content) != 1 || content[0]["text"] != "line one\nline two\n" {
+		t.Errorf("Expected the whole text file inline, got %v", content)
+	}
+
+	content = call(`{"fileId":"text-id","offset":5,"length":3}`)
+	if content[0]["text"] != "one" {
+		t.Errorf("Expected window 'one', got %v", content[0]["text"])
+	}
+	if len(content) != 2 || !strings.Contains(content[1]["text"].(string), "offset=8") {
+		t.Errorf("Expected a continuation hint with offset=8, got %v", content)
+	}
+
+	content = call(`{"fileId":"image-id"}`)
+	if content[0]["type"] != "image" || content[0]["mimeType"] != "image/png" {
+		t.Errorf("Expected PNG image content, got %v", content[0])
+	}
+
+	content = call(`{"fileId":"zip-id"}`)
+	resource, ok := content[0]["resource"].(map[string]interface{})
+	if content[0]["type"] != "resource" || !ok {
+		t.Fatalf("Expected embedded resource content, got %v", content[0])
+	}
+	if resource["uri"] != "koneksi://file/zip-id" || resource["mimeType"] != "application/zip" {
+		t.Errorf("Unexpected resource %v", resource)
+	}
+}
@@ -0,0 +1,119 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// Session is one client connection. Each session has its own
+// initialization lifecycle, negotiated protocol version, requests in flight,
+// resource subscriptions, workspace roots and notifier, while the Koneksi client, index and
+// prompts are shared by the whole server. The stdio transport uses the
+// server's default session; the HTTP transport creates one per client.
+type Session struct {
+	server *Server
+
+	stateMu            sync.Mutex
+	state              lifecycleState
+	protocolVersion    string
+	clientInfo         ClientInfo
+	clientCapabilities map[string]interface{}
+
+	inflightMu sync.Mutex
+	inflight   map[string]*call
+
+	notifyMu sync.Mutex
+	notifier func(message interface{}) error
+
+	// outgoing are the requests sent to the client that wait for a response
+	outgoingMu  sync.Mutex
+	outgoingSeq int
+	outgoing    map[string]chan gjson.Result
+
+	// remote is set for sessions of the HTTP transports, whose clients'
+	// roots are paths on another machine
+	remote bool
+
+	// roots are the client's roots once listed; rootsGeneration counts the
+	// times they changed
+	rootsMu         sync.Mutex
+	roots           *clientRoots
+	rootsGeneration int
+
+	// profile is the name of the tool profile the session's identity
+	// selects, set before it handles any message
+	profile string
+
+	// subscriptions is guarded by server.subMu, as polling compares them
+	// against the shared snapshot of every session at once
+	subscriptions map[string]subscription
+
+	// listsResources is set, under server.subMu, once the session lists
+	// resources; it is then told when the listing changes until it ends
+	listsResources bool
+}
+
+// NewSession starts a new client connection to the server. It receives
+// resource notifications until it is closed.
+func (s *Server) NewSession() *Session {
+	sess := &Session{
+		server:        s,
+		inflight:      make(map[string]*call),
+		outgoing:      make(map[string]chan gjson.Result),
+		subscriptions: make(map[string]subscription),
+	}
+
+	s.subMu.Lock()
+	s.sessions[sess] = struct{}{}
+	s.subMu.Unlock()
+
+	return sess
+}
+
+// Close ends the session: requests still running are cancelled and it no
+// longer receives notifications. Closing the default session is not allowed.
+func (sess *Session) Close() {
+	s := sess.server
+	if sess == s.session {
+		return
+	}
+
+	s.subMu.Lock()
+	delete(s.sessions, sess)
+	s.subMu.Unlock()
+
+	sess.inflightMu.Lock()
+	for _, c := range sess.inflight {
+		c.cancel()
+	}
+	sess.inflightMu.Unlock()
+
+	sess.SetNotifier(nil)
+}
+
+// HandleMessage handles one raw JSON-RPC message, which may be a batch, and
+// returns the response to write back, or nil when nothing needs answering.
+func (sess *Session) HandleMessage(message string) interface{} {
+	response, run := sess.acceptMessage(context.Background(), message)
+	if run != nil {
+		return run()
+	}
+	return response
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sess)
+}
+
+// sessionFrom returns the session a request belongs to. Requests handled
+// without one, e.g. through HandleRequest, use the default session.
+func (s *Server) sessionFrom(ctx context.Context) *Session {
+	if sess, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		return sess
+	}
+	return s.session
+}
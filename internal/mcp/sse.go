@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// errStreamClosed is returned when sending to an SSE session whose event
+// stream has been closed
+var errStreamClosed = errors.New("event stream closed")
+
+// SSEHandler serves the HTTP+SSE transport of MCP 2024-11-05, for clients
+// that predate Streamable HTTP. A GET opens an event stream whose first
+// "endpoint" event gives the URL to POST messages to. POSTs are accepted with
+// 202 and everything the server sends, responses included, goes out on the
+// stream as "message" events. Each stream is its own Session and ends with it.
+type SSEHandler struct {
+	server       *Server
+	messagesPath string
+	opts         HTTPOptions
+	slots        chan struct{}
+
+	mu       sync.Mutex
+	sessions map[string]*sseSession
+}
+
+// NewSSEHandler creates the HTTP+SSE transport for server. It answers GET
+// with an event stream and POST with message handling, and tells clients to
+// POST to messagesPath, so it should be mounted on both the stream path and
+// messagesPath. opts.SessionTimeout is not used, as sessions last as long
+// as their stream.
+func NewSSEHandler(server *Server, messagesPath string, opts HTTPOptions) *SSEHandler {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+
+	return &SSEHandler{
+		server:       server,
+		messagesPath: messagesPath,
+		opts:         opts,
+		slots:        make(chan struct{}, opts.Workers),
+		sessions:     make(map[string]*sseSession),
+	}
+}
+
+func (h *SSEHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowOrigin(r.Header.Get("Origin"), h.opts.AllowedOrigins) {
+		writeHTTPError(w, http.StatusForbidden, "origin %q is not allowed", r.Header.Get("Origin"))
+		return
+	}
+	info, ok := h.opts.Auth.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleStream(w, r, info)
+	case http.MethodPost:
+		h.handleMessage(w, r, info)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeHTTPError(w, http.StatusMethodNotAllowed, "method %s is not allowed", r.Method)
+	}
+}
+
+// sseSession is a Session whose messages are written to one event stream
+type sseSession struct {
+	id      string
+	owner   string
+	session *Session
+	out     chan interface{}
+	done    chan struct{}
+}
+
+// send queues a message for the event stream, waiting while the stream is
+// busy writing earlier ones
+func (ss *sseSession) send(message interface{}) error {
+	select {
+	case ss.out <- message:
+		return nil
+	case <-ss.done:
+		return errStreamClosed
+	}
+}
+
+func (h *SSEHandler) handleStream(w http.ResponseWriter, r *http.Request, info *AuthInfo) {
+	ss := &sseSession{
+		id:      newSessionID(),
+		owner:   info.owner(),
+		session: h.server.NewSession(),
+		out:     make(chan interface{}, 16),
+		done:    make(chan struct{}),
+	}
+	ss.session.profile = h.server.identityProfile(info)
+	ss.session.remote = true
+	ss.session.SetNotifier(ss.send)
+
+	h.mu.Lock()
+	h.sessions[ss.id] = ss
+	h.mu.Unlock()
+	log.Printf("Started SSE session %s", ss.id)
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.sessions, ss.id)
+		h.mu.Unlock()
+
+		close(ss.done)
+		ss.session.Close()
+		log.Printf("Ended SSE session %s", ss.id)
+	}()
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	endpoint := h.messagesPath + "?sessionId=" + url.QueryEscape(ss.id)
+	if _, err := fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", endpoint); err != nil {
+		return
+	}
+	flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case message := <-ss.out:
+			data, err := json.Marshal(message)
+			if err != nil {
+				log.Printf("Error encoding message: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flush()
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *SSEHandler) handleMessage(w http.ResponseWriter, r *http.Request, info *AuthInfo) {
+	id := r.URL.Query().Get("sessionId")
+	if id == "" {
+		writeHTTPError(w, http.StatusBadRequest, "missing sessionId, open the event stream first")
+		return
+	}
+
+	h.mu.Lock()
+	ss := h.sessions[id]
+	h.mu.Unlock()
+
+	if ss == nil || ss.owner != info.owner() {
+		writeHTTPError(w, http.StatusNotFound, "session %s not found", id)
+		return
+	}
+
+	message, ok := readMessage(w, r, h.opts.MaxMessageSize)
+	if !ok || !h.opts.Auth.authorize(w, info, h.server.requiredPermissions(message)) {
+		return
+	}
+
+	// The answer goes out on the event stream, not in the POST response
+	w.WriteHeader(http.StatusAccepted)
+
+	response, run := ss.session.acceptMessage(context.Background(), message)
+	if run == nil {
+		if response != nil {
+			ss.send(response)
+		}
+		return
+	}
+
+	go func() {
+		h.slots <- struct{}{}
+		response := run()
+		<-h.slots
+
+		if response != nil {
+			ss.send(response)
+		}
+	}()
+}
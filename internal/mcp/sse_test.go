@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+type namedEvent struct {
+	name string
+	data string
+}
+
+// sseClient follows a legacy SSE stream and posts messages to its endpoint
+type sseClient struct {
+	t        *testing.T
+	base     string
+	endpoint string
+	events   chan namedEvent
+	body     io.Closer
+}
+
+func startSSE(t *testing.T, client *koneksi.Client) *sseClient {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	handler := NewSSEHandler(NewServer("test-server", "1.0.0", client), "/message", HTTPOptions{})
+	mux.Handle("/sse", handler)
+	mux.Handle("/message", handler)
+	httpServer := httptest.NewServer(mux)
+	t.Cleanup(httpServer.Close)
+
+	resp, err := http.Get(httpServer.URL + "/sse")
+	if err != nil {
+		t.Fatalf("GET /sse failed: %v", err)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", contentType)
+	}
+
+	c := &sseClient{
+		t:      t,
+		base:   httpServer.URL,
+		events: make(chan namedEvent, 100),
+		body:   resp.Body,
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	go func() {
+		defer close(c.events)
+
+		var event namedEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && event.name != "":
+				c.events <- event
+				event = namedEvent{}
+			}
+		}
+	}()
+
+	endpoint := c.next()
+	if endpoint.name != "endpoint" || !strings.HasPrefix(endpoint.data, "/message?sessionId=") {
+		t.Fatalf("Expected the endpoint event first, got %v", endpoint)
+	}
+	c.endpoint = endpoint.data
+	return c
+}
+
+func (c *sseClient) next() namedEvent {
+	c.t.Helper()
+
+	select {
+	case event, ok := <-c.events:
+		if !ok {
+			c.t.Fatal("Expected an event, but the stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("Timed out waiting for an event")
+	}
+	return namedEvent{}
+}
+
+func (c *sseClient) post(endpoint, message string) int {
+	c.t.Helper()
+
+	resp, err := http.Post(c.base+endpoint, "application/json", strings.NewReader(message))
+	if err != nil {
+		c.t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// call posts a request and returns the message that answers it on the stream
+func (c *sseClient) call(message string) map[string]interface{} {
+	c.t.Helper()
+
+	if status := c.post(c.endpoint, message); status != http.StatusAccepted {
+		c.t.Fatalf("Expected 202, got %d", status)
+	}
+
+	event := c.next()
+	if event.name != "message" {
+		c.t.Fatalf("Expected a message event, got %v", event)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(event.data), &response); err != nil {
+		c.t.Fatalf("Failed to parse %q: %v", event.data, err)
+	}
+	return response
+}
+
+func TestSSEHandler(t *testing.T) {
+	c := startSSE(t, koneksi.NewClient("http://localhost", "test-id", "test-secret", ""))
+
+	// The lifecycle applies as on any other transport
+	if response := c.call(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); errorObject(t, response)["code"] != float64(CodeInvalidRequest) {
+		t.Errorf("Expected tools/list before initialize to fail, got %v", response)
+	}
+
+	response := c.call(`{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	if version := response["result"].(map[string]interface{})["protocolVersion"]; version != "2024-11-05" {
+		t.Errorf("Expected protocol version 2024-11-05, got %v", version)
+	}
+	if status := c.post(c.endpoint, `{"jsonrpc":"2.0","method":"notifications/initialized"}`); status != http.StatusAccepted {
+		t.Errorf("Expected 202 for a notification, got %d", status)
+	}
+
+	response = c.call(`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`)
+	if response["id"] != float64(3) || response["result"] == nil {
+		t.Errorf("Expected the tools/list result, got %v", response)
+	}
+
+	// Messages for unknown sessions are refused
+	if status := c.post("/message?sessionId=unknown", `{"jsonrpc":"2.0","id":4,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", status)
+	}
+	if status := c.post("/message", `{"jsonrpc":"2.0","id":4,"method":"ping"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a session, got %d", status)
+	}
+
+	// Closing the stream ends the session
+	c.body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.post(c.endpoint, `{"jsonrpc":"2.0","id":5,"method":"ping"}`) != http.StatusNotFound {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the session to end with its stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,225 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// DefaultWorkers is the number of requests the stdio transport runs at once
+// unless configured otherwise
+const DefaultWorkers = 8
+
+// DefaultMaxMessageSize is the largest message the stdio transport accepts
+// unless configured otherwise. It leaves room for upload_content calls with
+// several megabytes of base64 content.
+const DefaultMaxMessageSize = 32 << 20
+
+// StdioOptions configures ServeStdio. Zero values select the defaults.
+type StdioOptions struct {
+	// Workers is how many requests may run at the same time
+	Workers int
+	// MaxMessageSize is the largest message in bytes, not counting the
+	// newline. Larger messages are answered with an error and skipped.
+	MaxMessageSize int
+}
+
+// ServeStdio reads newline-delimited JSON-RPC messages from r and writes
+// responses and notifications to w until r is exhausted. Up to opts.Workers
+// requests run at the same time, so responses can be written in a different
+// order than the requests arrived in; notifications, ping and initialize are
+// handled as soon as they are read. It returns once every request has been
+// answered.
+func (s *Server) ServeStdio(r io.Reader, w io.Writer, opts StdioOptions) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	// Responses and notifications are written from several goroutines
+	encoder := json.NewEncoder(w)
+	var writeMu sync.Mutex
+	send := func(message interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return encoder.Encode(message)
+	}
+	s.SetNotifier(send)
+
+	reply := func(response interface{}) {
+		if response == nil {
+			return
+		}
+		if err := send(response); err != nil {
+			log.Printf("Error encoding response: %v", err)
+		}
+	}
+
+	// A request starts a worker when fewer than workers are busy and waits
+	// in the queue otherwise, for the next worker that finishes. The reader
+	// never waits for a free worker, so notifications such as cancellations
+	// and responses to the server's own requests are still seen while every
+	// worker is busy.
+	var queueMu sync.Mutex
+	var queue []func() interface{}
+	busy := 0
+	var wg sync.WaitGroup
+
+	work := func(run func() interface{}) {
+		defer wg.Done()
+
+		for run != nil {
+			reply(run())
+
+			queueMu.Lock()
+			run = nil
+			if len(queue) > 0 {
+				run, queue = queue[0], queue[1:]
+			} else {
+				busy--
+			}
+			queueMu.Unlock()
+		}
+	}
+
+	reader := newMessageReader(r, opts.MaxMessageSize)
+	var readErr error
+	for {
+		message, size, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+
+		if size > reader.max {
+			log.Printf("Rejecting a message of %d bytes, the limit is %d", size, reader.max)
+			reply(messageTooLarge(message, size, reader.max))
+			continue
+		}
+		if len(bytes.TrimSpace(message)) == 0 {
+			continue
+		}
+
+		response, run := s.session.acceptMessage(context.Background(), string(message))
+		if run == nil {
+			reply(response)
+			continue
+		}
+
+		queueMu.Lock()
+		if busy == workers {
+			queue = append(queue, run)
+			queueMu.Unlock()
+			continue
+		}
+		busy++
+		queueMu.Unlock()
+
+		wg.Add(1)
+		go work(run)
+	}
+
+	if n := s.session.inflightCount(); n > 0 {
+		log.Printf("Input closed, waiting for %d requests in progress", n)
+	}
+	wg.Wait()
+
+	// The default session outlives the client, so stop polling storage for it
+	s.unwatch(s.session)
+
+	return readErr
+}
+
+// messageTooLarge builds the error response for an oversized message. The
+// request ID is recovered from the start of the message when it can be, so
+// the client can match the error to its request.
+func messageTooLarge(prefix []byte, size, max int) interface{} {
+	var id interface{}
+	if idResult := gjson.GetBytes(prefix, "id"); idResult.Type == gjson.String || idResult.Type == gjson.Number {
+		id = idResult.Value()
+	}
+
+	return ErrorResponse(id, &RPCError{
+		Code:    CodeInvalidRequest,
+		Message: fmt.Sprintf("invalid request: message of %d bytes exceeds the limit of %d bytes", size, max),
+		Data: map[string]interface{}{
+			"size":           size,
+			"maxMessageSize": max,
+		},
+	})
+}
+
+// messageReader reads newline-delimited messages of any length. Only the
+// first max bytes of a message are kept in memory; the rest of an oversized
+// message is read and dropped.
+type messageReader struct {
+	r   *bufio.Reader
+	max int
+}
+
+func newMessageReader(r io.Reader, max int) *messageReader {
+	if max <= 0 {
+		max = DefaultMaxMessageSize
+	}
+	return &messageReader{
+		r:   bufio.NewReaderSize(r, 64<<10),
+		max: max,
+	}
+}
+
+// next returns the next message without its line ending, and its full size,
+// which is larger than len(message) when the message was cut off at max. It
+// returns io.EOF once the input is exhausted.
+func (m *messageReader) next() ([]byte, int, error) {
+	var message []byte
+	size := 0
+	lineEnd := 0
+
+	for {
+		chunk, err := m.r.ReadSlice('\n')
+		size += len(chunk)
+		if room := m.max + 2 - len(message); room > 0 {
+			if len(chunk) > room {
+				chunk = chunk[:room]
+			}
+			message = append(message, chunk...)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && size > 0 {
+			// The last message does not need a trailing newline
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// A CR before the newline is only visible if the message was kept whole
+		lineEnd = 1
+		if len(message) == size && bytes.HasSuffix(message, []byte("\r\n")) {
+			lineEnd = 2
+		}
+		break
+	}
+
+	size -= lineEnd
+	if len(message) > size {
+		message = message[:size]
+	}
+	if len(message) > m.max {
+		message = message[:m.max]
+	}
+	return message, size, nil
+}
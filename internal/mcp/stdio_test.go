@@ -0,0 +1,363 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+// stdioSession runs ServeStdio over pipes and collects its output line by line
+type stdioSession struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    chan []byte
+	done   chan error
+	server *Server
+}
+
+func startStdio(t *testing.T, client *koneksi.Client, opts StdioOptions) *stdioSession {
+	t.Helper()
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	session := &stdioSession{
+		t:      t,
+		in:     inWriter,
+		out:    make(chan []byte, 100),
+		done:   make(chan error, 1),
+		server: NewServer("test-server", "1.0.0", client),
+	}
+	go func() {
+		session.done <- session.server.ServeStdio(inReader, outWriter, opts)
+		outWriter.Close()
+	}()
+
+	// Read output as it is written, so the server never blocks on stdout
+	go func() {
+		defer close(session.out)
+
+		scanner := bufio.NewScanner(outReader)
+		for scanner.Scan() {
+			session.out <- append([]byte(nil), scanner.Bytes()...)
+		}
+	}()
+
+	session.send(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	if id := session.receive()["id"]; id != float64(0) {
+		t.Fatalf("Expected the initialize response first, got id %v", id)
+	}
+	session.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	return session
+}
+
+func (s *stdioSession) send(message string) {
+	s.t.Helper()
+
+	if _, err := io.WriteString(s.in, message+"\n"); err != nil {
+		s.t.Fatalf("Failed to write message: %v", err)
+	}
+}
+
+func (s *stdioSession) receive() map[string]interface{} {
+	s.t.Helper()
+
+	var line []byte
+	select {
+	case l, ok := <-s.out:
+		if !ok {
+			s.t.Fatal("Expected a message, but the output was closed")
+		}
+		line = l
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("Timed out waiting for a message")
+	}
+
+	var message map[string]interface{}
+	if err := json.Unmarshal(line, &message); err != nil {
+		s.t.Fatalf("Failed to parse output %q: %v", line, err)
+	}
+	return message
+}
+
+func (s *stdioSession) close() {
+	s.t.Helper()
+
+	s.in.Close()
+	select {
+	case err := <-s.done:
+		if err != nil {
+			s.t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("ServeStdio did not return after its input was closed")
+	}
+}
+
+// blockingStorage answers create-directory requests only once released
+func blockingStorage(t *testing.T, release <-chan struct{}, active func(delta int)) *koneksi.Client {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active(1)
+		defer active(-1)
+
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"id": "dir-1", "name": "slow"},
+		})
+	}))
+	t.Cleanup(mockServer.Close)
+
+	return koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+}
+
+func TestServer_ServeStdio_OutOfOrder(t *testing.T) {
+	release := make(chan struct{})
+	client := blockingStorage(t, release, func(int) {})
+	session := startStdio(t, client, StdioOptions{Workers: 4})
+
+	session.send(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"create_directory","arguments":{"name":"slow"}}}`)
+	session.send(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	session.send(`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`)
+
+	// Both quick requests are answered while the tool call is still running
+	seen := map[interface{}]bool{}
+	for i := 0; i < 2; i++ {
+		seen[session.receive()["id"]] = true
+	}
+	if !seen[float64(2)] || !seen[float64(3)] {
+		t.Fatalf("Expected ping and tools/list to be answered first, got %v", seen)
+	}
+
+	close(release)
+	if id := session.receive()["id"]; id != float64(1) {
+		t.Errorf("Expected the tool call response last, got id %v", id)
+	}
+
+	session.close()
+}
+
+func TestServer_ServeStdio_WorkerLimit(t *testing.T) {
+	var mu sync.Mutex
+	current, peak := 0, 0
+	active := func(delta int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		current += delta
+		if current > peak {
+			peak = current
+		}
+	}
+
+	release := make(chan struct{})
+	client := blockingStorage(t, release, active)
+	session := startStdio(t, client, StdioOptions{Workers: 2})
+
+	for i := 1; i <= 5; i++ {
+		session.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"create_directory","arguments":{"name":"slow"}}}`, i))
+	}
+
+	// Give the dispatcher time to start as many calls as it is allowed to
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 5; i++ {
+		session.receive()
+	}
+	session.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != 2 {
+		t.Errorf("Expected at most 2 concurrent calls, got %d", peak)
+	}
+}
+
+func TestServer_AcceptMessage_DuplicateID(t *testing.T) {
+	server := newInitializedServer(t, nil)
+
+	request := `{"jsonrpc":"2.0","id":7,"method":"tools/list"}`
+	if _, run := server.session.acceptMessage(context.Background(), request); run == nil {
+		t.Fatal("Expected tools/list to be queued to run")
+	}
+
+	response, run := server.session.acceptMessage(context.Background(), request)
+	if run != nil {
+		t.Fatal("Expected a request reusing an in-flight ID to be rejected")
+	}
+	if errObj := errorObject(t, response); errObj["code"] != CodeInvalidRequest {
+		t.Errorf("Expected code %d, got %v", CodeInvalidRequest, errObj["code"])
+	}
+
+	// A string ID with the same text is a different request
+	if _, run := server.session.acceptMessage(context.Background(), `{"jsonrpc":"2.0","id":"7","method":"tools/list"}`); run == nil {
+		t.Error("Expected the string ID \"7\" to be accepted")
+	}
+}
+
+func TestServer_ServeStdio_Cancellation(t *testing.T) {
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Send part of the file, then stall until the client goes away
+		w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		close(started)
+
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	session := startStdio(t, client, StdioOptions{Workers: 4})
+
+	outputDir := t.TempDir()
+	outputPath := filepath.Join(outputDir, "big.bin")
+	session.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"download_file","arguments":{"fileId":"big","outputPath":%q}}}`, outputPath))
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Download never started")
+	}
+
+	session.send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1,"reason":"user pressed stop"}}`)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the HTTP request to Koneksi to be aborted")
+	}
+
+	// The cancelled request gets no response, so the ping answer comes next
+	session.send(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	if id := session.receive()["id"]; id != float64(2) {
+		t.Errorf("Expected only the ping response, got id %v", id)
+	}
+	session.close()
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the partial download to be removed, found %v", entries)
+	}
+
+	if n := session.server.session.inflightCount(); n != 0 {
+		t.Errorf("Expected no requests in flight, got %d", n)
+	}
+}
+
+func TestMessageReader(t *testing.T) {
+	long := strings.Repeat("x", 200<<10)
+	input := "a\nbb\r\n\n" + long + "\n" + strings.Repeat("y", 300<<10) + "\ntail"
+
+	reader := newMessageReader(strings.NewReader(input), 250<<10)
+	expected := []struct {
+		message string
+		size    int
+	}{
+		{"a", 1},
+		{"bb", 2},
+		{"", 0},
+		{long, len(long)},
+		{strings.Repeat("y", 250<<10), 300 << 10},
+		{"tail", 4},
+	}
+
+	for i, want := range expected {
+		message, size, err := reader.next()
+		if err != nil {
+			t.Fatalf("Message %d: unexpected error: %v", i, err)
+		}
+		if string(message) != want.message || size != want.size {
+			t.Errorf("Message %d: got %d bytes (size %d), expected %d bytes (size %d)", i, len(message), size, len(want.message), want.size)
+		}
+	}
+
+	if _, _, err := reader.next(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end, got %v", err)
+	}
+}
+
+func TestServer_ServeStdio_LargeMessages(t *testing.T) {
+	var received int64
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// The directory listing uploads check for existing files
+			w.Write([]byte(`{"data":{"files":[]}}`))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n, _ := io.Copy(io.Discard, file)
+		atomic.StoreInt64(&received, n)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"file_id": "big", "name": "big.bin", "size": n},
+		})
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	session := startStdio(t, client, StdioOptions{MaxMessageSize: 8 << 20})
+
+	// About 6.7 MB of base64, far past bufio.Scanner's 64 KB default
+	content := make([]byte, 5<<20)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	session.send(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":"big.bin","content":"` + encoded + `"}}}`)
+
+	response := session.receive()
+	if result, ok := response["result"].(map[string]interface{}); !ok || result["isError"] == true {
+		t.Fatalf("Expected the upload to succeed, got %v", response)
+	}
+	if n := atomic.LoadInt64(&received); n != int64(len(content)) {
+		t.Errorf("Expected Koneksi to receive %d bytes, got %d", len(content), n)
+	}
+
+	// A message over the limit is answered with an error for its ID...
+	oversized := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"upload_content","arguments":{"fileName":"huge.bin","content":"` + strings.Repeat("A", 9<<20) + `"}}}`
+	session.send(oversized)
+
+	response = session.receive()
+	if response["id"] != float64(2) {
+		t.Errorf("Expected the error to carry id 2, got %v", response["id"])
+	}
+	errObj, ok := response["error"].(map[string]interface{})
+	if !ok || errObj["code"] != float64(CodeInvalidRequest) {
+		t.Fatalf("Expected an invalid request error, got %v", response)
+	}
+	if data := errObj["data"].(map[string]interface{}); data["size"] != float64(len(oversized)) || data["maxMessageSize"] != float64(8<<20) {
+		t.Errorf("Unexpected error data %v", data)
+	}
+
+	// ...and the server keeps going
+	session.send(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	if id := session.receive()["id"]; id != float64(3) {
+		t.Errorf("Expected the ping response, got id %v", id)
+	}
+
+	session.close()
+}
@@ -0,0 +1,260 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+	"github.com/tidwall/gjson"
+)
+
+// SetNotifier sets the function used to send server-initiated messages to the client
+func (sess *Session) SetNotifier(notify func(message interface{}) error) {
+	sess.notifyMu.Lock()
+	defer sess.notifyMu.Unlock()
+
+	sess.notifier = notify
+}
+
+// SetNotifier sets the notifier of the default session
+func (s *Server) SetNotifier(notify func(message interface{}) error) {
+	s.session.SetNotifier(notify)
+}
+
+// send passes a server-initiated message to the session's notifier, if any
+func (sess *Session) send(message interface{}) error {
+	sess.notifyMu.Lock()
+	notifier := sess.notifier
+	sess.notifyMu.Unlock()
+
+	if notifier == nil {
+		return nil
+	}
+	return notifier(message)
+}
+
+func (sess *Session) notify(method string, params map[string]interface{}) {
+	sendNotification(sess.send, method, params)
+}
+
+type requestNotifierKey struct{}
+
+// withRequestNotifier makes notifications about the requests run with ctx,
+// such as their progress, go to send instead of the session's notifier
+func withRequestNotifier(ctx context.Context, send func(message interface{}) error) context.Context {
+	return context.WithValue(ctx, requestNotifierKey{}, send)
+}
+
+// requestNotifier returns where notifications about the request ctx belongs
+// to are sent
+func (sess *Session) requestNotifier(ctx context.Context) func(message interface{}) error {
+	if send, ok := ctx.Value(requestNotifierKey{}).(func(message interface{}) error); ok {
+		return send
+	}
+	return sess.send
+}
+
+func sendNotification(send func(message interface{}) error, method string, params map[string]interface{}) {
+	message := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+	}
+	if params != nil {
+		message["params"] = params
+	}
+
+	if err := send(message); err != nil {
+		log.Printf("Error sending %s: %v", method, err)
+	}
+}
+
+func (s *Server) handleResourcesSubscribe(sess *Session, parsed gjson.Result, id interface{}) (interface{}, error) {
+	uri := parsed.Get("params.uri").String()
+	if _, _, err := parseResourceURI(uri); err != nil {
+		return nil, err
+	}
+
+	s.subMu.Lock()
+	// Start from the last known state so the next poll only reports real changes
+	var sub subscription
+	if s.snapshot != nil {
+		sub.known = true
+		if sub.fingerprint = s.snapshot[uri]; sub.fingerprint == "" {
+			sub.fingerprint = resourceGone
+		}
+	}
+	sess.subscriptions[uri] = sub
+	s.subMu.Unlock()
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  map[string]interface{}{},
+	}, nil
+}
+
+func (s *Server) handleResourcesUnsubscribe(sess *Session, parsed gjson.Result, id interface{}) (interface{}, error) {
+	uri := parsed.Get("params.uri").String()
+	if _, _, err := parseResourceURI(uri); err != nil {
+		return nil, err
+	}
+
+	s.subMu.Lock()
+	delete(sess.subscriptions, uri)
+	s.subMu.Unlock()
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  map[string]interface{}{},
+	}, nil
+}
+
+// unwatch drops every subscription of sess and stops telling it about
+// listing changes, so polling stops once no other session watches
+func (s *Server) unwatch(sess *Session) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	sess.subscriptions = make(map[string]subscription)
+	sess.listsResources = false
+}
+
+// Fingerprint recorded for subscribed resources that no longer exist remotely
+const resourceGone = "gone"
+
+type subscription struct {
+	fingerprint string
+	known       bool
+}
+
+// WatchResources polls Koneksi every interval until stop is closed, sending
+// notifications/resources/updated for changed subscriptions and
+// notifications/resources/list_changed when files or directories come and go
+// to the sessions that listed resources. Storage is only walked while some
+// session subscribes to a resource or has listed them.
+func (s *Server) WatchResources(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.pollResources(); err != nil {
+			log.Printf("Error polling resources: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) pollResources() error {
+	if !s.watched() {
+		return nil
+	}
+
+	current, listing, err := s.snapshotResources()
+	if err != nil {
+		return err
+	}
+
+	s.subMu.Lock()
+	listChanged := s.snapshot != nil && listing != s.listing
+	s.snapshot = current
+	s.listing = listing
+
+	updated := make(map[*Session][]string)
+	var subscribers, listeners []*Session
+	for sess := range s.sessions {
+		if sess.listsResources {
+			listeners = append(listeners, sess)
+		}
+		if len(sess.subscriptions) > 0 {
+			subscribers = append(subscribers, sess)
+		}
+		for uri, sub := range sess.subscriptions {
+			fingerprint, ok := current[uri]
+			if !ok {
+				fingerprint = resourceGone
+			}
+			if sub.known && sub.fingerprint != fingerprint {
+				updated[sess] = append(updated[sess], uri)
+			}
+			sess.subscriptions[uri] = subscription{fingerprint: fingerprint, known: true}
+		}
+	}
+	s.subMu.Unlock()
+
+	for _, sess := range subscribers {
+		uris := updated[sess]
+		sort.Strings(uris)
+		for _, uri := range uris {
+			sess.notify("notifications/resources/updated", map[string]interface{}{"uri": uri})
+		}
+	}
+	if listChanged {
+		for _, sess := range listeners {
+			sess.notify("notifications/resources/list_changed", nil)
+		}
+	}
+
+	return nil
+}
+
+// watched reports whether any session wants to hear about changes. When
+// none does, the snapshot is dropped, so the next poll only records a
+// baseline instead of reporting changes from before anyone was watching.
+func (s *Server) watched() bool {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	for sess := range s.sessions {
+		if sess.listsResources || len(sess.subscriptions) > 0 {
+			return true
+		}
+	}
+	s.snapshot = nil
+	s.listing = ""
+	return false
+}
+
+// snapshotResources fingerprints every resource, plus the listing as a whole
+// (which only changes when resources are added, removed or renamed).
+func (s *Server) snapshotResources() (map[string]string, string, error) {
+	current := make(map[string]string)
+	var entries []string
+
+	err := s.walkStorage(context.Background(), func(dir koneksi.DirectoryInfo, files []koneksi.FileInfo) {
+		dirState := make([]string, 0, len(files))
+		entries = append(entries, directoryURI(dir.ID)+"\x00"+dir.Name)
+
+		for _, file := range files {
+			state := fmt.Sprintf("%s\x00%s\x00%d", file.Name, file.Hash, file.Size)
+			current[fileURI(file.ID)] = state
+			dirState = append(dirState, file.ID+"\x00"+state)
+			entries = append(entries, fileURI(file.ID)+"\x00"+file.Name)
+		}
+
+		sort.Strings(dirState)
+		current[directoryURI(dir.ID)] = hashStrings(dirState)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Strings(entries)
+	return current, hashStrings(entries), nil
+}
+
+func hashStrings(values []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(values, "\n")))
+	return hex.EncodeToString(sum[:])
+}
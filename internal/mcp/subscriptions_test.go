@@ -0,0 +1,182 @@
+package mcp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+type recordedNotifications struct {
+	mu       sync.Mutex
+	messages []map[string]interface{}
+}
+
+func (r *recordedNotifications) record(message interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, message.(map[string]interface{}))
+	return nil
+}
+
+func (r *recordedNotifications) take() []map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := r.messages
+	r.messages = nil
+	return messages
+}
+
+func TestServer_ResourceSubscriptions(t *testing.T) {
+	var mu sync.Mutex
+	files := []map[string]interface{}{
+		{"id": "file1", "name": "notes.md", "size": 10, "hash": "h1"},
+		{"id": "file2", "name": "todo.md", "size": 20, "hash": "h2"},
+	}
+
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/directories/root"):
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"directory":      map[string]interface{}{"id": "root", "name": "root"},
+					"subdirectories": []map[string]interface{}{{"id": "docs", "name": "Docs"}},
+				},
+			})
+		case strings.HasSuffix(r.URL.Path, "/directories/docs"):
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"files": files},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := NewServer("test-server", "1.0.0", client)
+
+	notifications := &recordedNotifications{}
+	server.SetNotifier(notifications.record)
+
+	// Nobody is watching yet, so storage is not walked
+	if err := server.pollResources(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("Expected no polling without subscriptions, got %d requests", requests)
+	}
+
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"koneksi://file/file1"}}`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first poll only records a baseline
+	if err := server.pollResources(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if messages := notifications.take(); len(messages) != 0 {
+		t.Fatalf("Expected no notifications on the first poll, got %v", messages)
+	}
+
+	// Changing the subscribed file's content sends an update, but the listing is unchanged
+	mu.Lock()
+	files[0]["hash"] = "h1-changed"
+	mu.Unlock()
+
+	if err := server.pollResources(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages := notifications.take()
+	if len(messages) != 1 || messages[0]["method"] != "notifications/resources/updated" {
+		t.Fatalf("Expected a single resources/updated notification, got %v", messages)
+	}
+	if params := messages[0]["params"].(map[string]interface{}); params["uri"] != "koneksi://file/file1" {
+		t.Errorf("Expected update for koneksi://file/file1, got %v", params["uri"])
+	}
+
+	// Removing an unsubscribed file only changes the listing, which is
+	// reported to sessions that listed resources
+	other := server.NewSession()
+	defer other.Close()
+	otherNotifications := &recordedNotifications{}
+	other.SetNotifier(otherNotifications.record)
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":2,"method":"resources/list"}`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	files = files[:1]
+	mu.Unlock()
+
+	if err := server.pollResources(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages = notifications.take()
+	if len(messages) != 1 || messages[0]["method"] != "notifications/resources/list_changed" {
+		t.Fatalf("Expected a single list_changed notification, got %v", messages)
+	}
+	if messages := otherNotifications.take(); len(messages) != 0 {
+		t.Errorf("Expected no notifications for a session that did not list resources, got %v", messages)
+	}
+
+	// Nothing is sent after unsubscribing
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":3,"method":"resources/unsubscribe","params":{"uri":"koneksi://file/file1"}}`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mu.Lock()
+	files[0]["hash"] = "h1-changed-again"
+	mu.Unlock()
+
+	if err := server.pollResources(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if messages := notifications.take(); len(messages) != 0 {
+		t.Errorf("Expected no notifications after unsubscribing, got %v", messages)
+	}
+}
+
+func TestServer_ResourceSubscribe_InvalidURI(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	if _, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"file:///etc/passwd"}}`); err == nil {
+		t.Error("Expected error for a non-koneksi URI")
+	}
+}
+
+func TestServer_ServeStdio_StopsWatching(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	client := koneksi.NewClient(mockServer.URL, "test-id", "test-secret", "")
+	server := NewServer("test-server", "1.0.0", client)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"koneksi://file/file1"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"resources/list"}`,
+	}, "\n")
+	if err := server.ServeStdio(strings.NewReader(input), io.Discard, StdioOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Once the client is gone nobody is left to tell about changes
+	if server.watched() {
+		t.Error("Expected the stdio session to stop watching when its input closes")
+	}
+}
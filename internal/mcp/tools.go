@@ -0,0 +1,442 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Tool is a tool the server offers through tools/list and tools/call
+type Tool interface {
+	// Info describes the tool
+	Info() ToolInfo
+
+	// Call runs the tool with the raw JSON object of its arguments. Invalid
+	// arguments are reported as *RPCError, other errors become a tool
+	// result with isError set.
+	Call(ctx context.Context, arguments []byte) (interface{}, error)
+}
+
+// ToolInfo describes a tool
+type ToolInfo struct {
+	Name        string
+	Description string
+
+	// Title is a human-readable name for the tool
+	Title string
+
+	// Annotations describe how the tool affects its environment
+	Annotations ToolAnnotations
+
+	// Permission is what the tool does with Koneksi storage or the server's
+	// local files, which decides the OAuth scope needed to call it
+	Permission Permission
+
+	// InputSchema is the JSON schema of the tool's arguments. NewTool
+	// generates it from the argument struct.
+	InputSchema map[string]interface{}
+
+	// OutputSchema is the JSON schema of the structuredContent in the tool's
+	// results, if it has any. NewStructuredTool generates it from the
+	// result struct.
+	OutputSchema map[string]interface{}
+}
+
+// ToolAnnotations are the hints clients use to decide which tool calls need
+// the user's approval. They are hints about the tool, not guarantees, and
+// are all sent explicitly, as their defaults assume the worst.
+type ToolAnnotations struct {
+	// ReadOnly tools do not modify their environment
+	ReadOnly bool
+
+	// Destructive tools may overwrite or delete data, rather than only add
+	// to it. Only meaningful for tools that are not read-only.
+	Destructive bool
+
+	// Idempotent tools have no further effect when called again with the
+	// same arguments. Only meaningful for tools that are not read-only.
+	Idempotent bool
+
+	// OpenWorld tools interact with entities beyond the user's Koneksi
+	// storage and local files, such as the web
+	OpenWorld bool
+}
+
+// ToolResult is the result of a tool with an output schema: content for the
+// model and the same information as structured data for programs
+type ToolResult[R any] struct {
+	Content    []map[string]interface{}
+	Structured R
+}
+
+// typedTool is a Tool whose arguments are decoded into a struct of type A
+type typedTool[A any] struct {
+	info ToolInfo
+	call func(ctx context.Context, args *A) (interface{}, error)
+}
+
+// NewTool creates a tool whose arguments are decoded into a new A before
+// each call. A must be a struct; its fields and their tags define the input
+// schema, see schemaFor.
+func NewTool[A any](info ToolInfo, call func(ctx context.Context, args *A) (interface{}, error)) Tool {
+	t := reflect.TypeOf((*A)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("tool %s: arguments must be a struct, not %s", info.Name, t))
+	}
+
+	// Setting the defaults once checks them before the tool is ever called
+	setDefaults(reflect.ValueOf(new(A)))
+
+	info.InputSchema = schemaFor(t)
+	return &typedTool[A]{info: info, call: call}
+}
+
+// NewStructuredTool creates a tool like NewTool whose results also carry
+// structuredContent of type R. R must be a struct; its fields and their tags
+// define the output schema.
+func NewStructuredTool[A, R any](info ToolInfo, call func(ctx context.Context, args *A) (*ToolResult[R], error)) Tool {
+	t := reflect.TypeOf((*R)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("tool %s: results must be a struct, not %s", info.Name, t))
+	}
+	info.OutputSchema = schemaFor(t)
+
+	return NewTool(info, func(ctx context.Context, args *A) (interface{}, error) {
+		result, err := call(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"content":           result.Content,
+			"structuredContent": result.Structured,
+		}, nil
+	})
+}
+
+func (t *typedTool[A]) Info() ToolInfo {
+	return t.info
+}
+
+func (t *typedTool[A]) Call(ctx context.Context, arguments []byte) (interface{}, error) {
+	args := new(A)
+	if err := decodeArguments(arguments, args); err != nil {
+		return nil, err
+	}
+	return t.call(ctx, args)
+}
+
+// AddTool registers a tool, replacing any tool of the same name. Tools are
+// listed in the order they were first added.
+func (s *Server) AddTool(tool Tool) error {
+	info := tool.Info()
+	if info.Name == "" {
+		return fmt.Errorf("tool name is required")
+	}
+	if info.InputSchema["type"] != "object" {
+		return fmt.Errorf("tool %s: input schema must be an object schema", info.Name)
+	}
+	if info.OutputSchema != nil && info.OutputSchema["type"] != "object" {
+		return fmt.Errorf("tool %s: output schema must be an object schema", info.Name)
+	}
+	if info.Annotations.ReadOnly && (info.Annotations.Destructive || info.Permission != PermissionRead) {
+		return fmt.Errorf("tool %s: read-only tools cannot be destructive or need more than read permission", info.Name)
+	}
+
+	s.toolMu.Lock()
+	defer s.toolMu.Unlock()
+
+	if _, exists := s.tools[info.Name]; !exists {
+		s.toolOrder = append(s.toolOrder, info.Name)
+	}
+	s.tools[info.Name] = tool
+	return nil
+}
+
+// lookupTool returns the registered tool with the given name
+func (s *Server) lookupTool(name string) (Tool, bool) {
+	s.toolMu.RLock()
+	defer s.toolMu.RUnlock()
+
+	tool, ok := s.tools[name]
+	return tool, ok
+}
+
+// listTools returns the registered tools in order
+func (s *Server) listTools() []Tool {
+	s.toolMu.RLock()
+	defer s.toolMu.RUnlock()
+
+	tools := make([]Tool, 0, len(s.toolOrder))
+	for _, name := range s.toolOrder {
+		tools = append(tools, s.tools[name])
+	}
+	return tools
+}
+
+// Arguments of the built-in tools
+
+type uploadFileArgs struct {
+	FilePath    string `json:"filePath" description:"Path to the file to upload"`
+	DirectoryID string `json:"directoryId,omitempty" description:"Directory ID to upload to (optional)"`
+	Overwrite   bool   `json:"overwrite,omitempty" description:"Upload even if the directory already has a file with this name (optional, default false)"`
+	DryRun      bool   `json:"dryRun,omitempty" description:"Report what the call would do without storing anything (optional, default false)"`
+}
+
+type downloadFileArgs struct {
+	FileID     string `json:"fileId" description:"ID of the file to download"`
+	OutputPath string `json:"outputPath" description:"Path where to save the downloaded file, in an existing directory"`
+	Overwrite  bool   `json:"overwrite,omitempty" description:"Replace outputPath if it already exists (optional, default false)"`
+}
+
+type restoreBackupArgs struct {
+	FileID          string `json:"fileId" description:"ID of the backup to restore"`
+	OutputPath      string `json:"outputPath" description:"Path where to save the restored file, in an existing directory"`
+	Decompress      bool   `json:"decompress,omitempty" description:"Decompress a backup made with compress, usually named .gz or .gz.enc (optional, default false)"`
+	DecryptPassword string `json:"decryptPassword,omitempty" description:"Password of a backup made with encrypt, usually named .enc (optional)"`
+	Overwrite       bool   `json:"overwrite,omitempty" description:"Replace outputPath if it already exists (optional, default false)"`
+}
+
+type readFileArgs struct {
+	FileID string `json:"fileId" description:"ID of the file to read"`
+	Offset int64  `json:"offset,omitempty" description:"Byte offset to start reading text from (optional, default 0)" minimum:"0"`
+	Length int64  `json:"length,omitempty" description:"Maximum number of bytes of text to return (optional, default 65536, max 1048576)" minimum:"1" maximum:"1048576" default:"65536"`
+}
+
+type listDirectoriesArgs struct{}
+
+type createDirectoryArgs struct {
+	Name        string `json:"name" description:"Name of the directory"`
+	Description string `json:"description,omitempty" description:"Description of the directory"`
+	DryRun      bool   `json:"dryRun,omitempty" description:"Report what the call would do without storing anything (optional, default false)"`
+}
+
+type searchFilesArgs struct {
+	DirectoryID string `json:"directoryId" description:"Directory ID to search in"`
+}
+
+type uploadContentArgs struct {
+	FileName    string `json:"fileName" description:"Name for the file"`
+	Content     string `json:"content" description:"Base64 encoded file content"`
+	DirectoryID string `json:"directoryId,omitempty" description:"Directory ID to upload to (optional)"`
+	Overwrite   bool   `json:"overwrite,omitempty" description:"Upload even if the directory already has a file with this name (optional, default false)"`
+	DryRun      bool   `json:"dryRun,omitempty" description:"Report what the call would do without storing anything (optional, default false)"`
+}
+
+type backupFileArgs struct {
+	FilePath        string `json:"filePath" description:"Path to the file to backup"`
+	DirectoryID     string `json:"directoryId,omitempty" description:"Directory ID to backup to (optional)"`
+	Compress        bool   `json:"compress,omitempty" description:"Compress the file with gzip before backup"`
+	Encrypt         bool   `json:"encrypt,omitempty" description:"Encrypt the file with AES-256-GCM before backup (requires encryptPassword)"`
+	EncryptPassword string `json:"encryptPassword,omitempty" description:"Password the encryption key is derived from"`
+	Overwrite       bool   `json:"overwrite,omitempty" description:"Back up even if the directory already has a file with this name (optional, default false)"`
+	DryRun          bool   `json:"dryRun,omitempty" description:"Report what the call would do without storing anything (optional, default false)"`
+}
+
+type searchContentArgs struct {
+	Query       string `json:"query" description:"Words to search for"`
+	DirectoryID string `json:"directoryId,omitempty" description:"Only search files in this directory (optional)"`
+	Limit       int    `json:"limit,omitempty" description:"Maximum number of results (optional, default 10)" minimum:"1" default:"10"`
+}
+
+// Results of the built-in tools
+
+type uploadOutput struct {
+	FileID      string `json:"fileId,omitempty" description:"ID of the stored file; absent in dry runs"`
+	FileName    string `json:"fileName" description:"Name of the stored file"`
+	Size        int64  `json:"size" description:"Size of the stored file in bytes"`
+	SHA256      string `json:"sha256" description:"Hex SHA-256 of the uploaded bytes"`
+	DirectoryID string `json:"directoryId,omitempty" description:"Directory the file was stored in, if not the root"`
+	URI         string `json:"uri,omitempty" description:"Resource URI of the file; absent in dry runs"`
+
+	Secrets  []secretOutput `json:"secrets,omitempty" description:"Secrets found in the content before upload"`
+	Redacted bool           `json:"redacted,omitempty" description:"Whether the secrets were masked in the stored file"`
+
+	DryRun          bool     `json:"dryRun,omitempty" description:"Whether this was a dry run, which stored nothing and describes what would be stored"`
+	Transformations []string `json:"transformations,omitempty" description:"What a dry run would do to the file on the way, such as redacting secrets"`
+}
+
+type secretOutput struct {
+	Rule        string `json:"rule" description:"Kind of secret, e.g. aws-access-key"`
+	Description string `json:"description"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	Preview     string `json:"preview" description:"The secret with all but its first characters masked"`
+}
+
+type backupOutput struct {
+	FileID       string `json:"fileId,omitempty" description:"ID of the stored backup; absent in dry runs"`
+	FileName     string `json:"fileName" description:"Name of the stored backup"`
+	Size         int64  `json:"size" description:"Size of the stored backup in bytes"`
+	OriginalSize int64  `json:"originalSize" description:"Size of the backed up file in bytes"`
+	SHA256       string `json:"sha256" description:"Hex SHA-256 of the uploaded backup"`
+	DirectoryID  string `json:"directoryId,omitempty" description:"Directory the backup was stored in, if not the root"`
+	Compressed   bool   `json:"compressed"`
+	Encrypted    bool   `json:"encrypted"`
+	URI          string `json:"uri,omitempty" description:"Resource URI of the backup; absent in dry runs"`
+
+	Secrets  []secretOutput `json:"secrets,omitempty" description:"Secrets found in the file before backup"`
+	Redacted bool           `json:"redacted,omitempty" description:"Whether the secrets were masked in the backup"`
+
+	DryRun          bool     `json:"dryRun,omitempty" description:"Whether this was a dry run, which stored nothing and describes what would be stored"`
+	Transformations []string `json:"transformations,omitempty" description:"What a dry run would do to the file on the way, such as compressing it"`
+}
+
+type downloadOutput struct {
+	FileID string `json:"fileId"`
+	Path   string `json:"path" description:"Where the file was saved"`
+	Size   int64  `json:"size" description:"Size of the file in bytes"`
+	SHA256 string `json:"sha256" description:"Hex SHA-256 of the downloaded bytes"`
+}
+
+type restoreOutput struct {
+	FileID       string `json:"fileId"`
+	Path         string `json:"path" description:"Where the restored file was saved"`
+	Size         int64  `json:"size" description:"Size of the restored file in bytes"`
+	SHA256       string `json:"sha256" description:"Hex SHA-256 of the restored file"`
+	Decompressed bool   `json:"decompressed"`
+	Decrypted    bool   `json:"decrypted"`
+}
+
+type readFileOutput struct {
+	FileID   string `json:"fileId"`
+	MimeType string `json:"mimeType"`
+	Charset  string `json:"charset,omitempty" description:"Charset the text was decoded from; absent for binary files"`
+	Text     string `json:"text,omitempty" description:"The text window, decoded to UTF-8; absent for binary files"`
+	Offset   int64  `json:"offset" description:"Byte offset of the window in the file"`
+	End      int64  `json:"end" description:"Byte offset just past the window"`
+	Next     *int64 `json:"next,omitempty" description:"Offset to continue reading from, if more text is available"`
+}
+
+type directoryOutput struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	FileCount   int       `json:"fileCount"`
+	TotalSize   int64     `json:"totalSize" description:"Total size of the files in bytes"`
+	CreatedAt   time.Time `json:"createdAt"`
+	URI         string    `json:"uri"`
+}
+
+type listDirectoriesOutput struct {
+	Directories []directoryOutput `json:"directories"`
+}
+
+type createDirectoryOutput struct {
+	DirectoryID string     `json:"directoryId,omitempty" description:"ID of the new directory; absent in dry runs"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty" description:"When the directory was created; absent in dry runs"`
+	URI         string     `json:"uri,omitempty" description:"Resource URI of the directory; absent in dry runs"`
+	DryRun      bool       `json:"dryRun,omitempty" description:"Whether this was a dry run, which created nothing"`
+}
+
+type fileOutput struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size" description:"Size in bytes"`
+	ContentType string `json:"contentType,omitempty"`
+	Hash        string `json:"hash,omitempty" description:"Content hash reported by Koneksi"`
+	URI         string `json:"uri"`
+}
+
+type searchFilesOutput struct {
+	DirectoryID string       `json:"directoryId"`
+	Files       []fileOutput `json:"files"`
+}
+
+type searchMatchOutput struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	DirectoryID string  `json:"directoryId,omitempty"`
+	Score       float64 `json:"score"`
+	Snippet     string  `json:"snippet"`
+	URI         string  `json:"uri"`
+}
+
+type searchContentOutput struct {
+	Query    string              `json:"query"`
+	Results  []searchMatchOutput `json:"results"`
+	Indexing bool                `json:"indexing" description:"Whether the index is still being built, so results may be missing"`
+}
+
+// addBuiltinTools registers the tools every server offers
+func (s *Server) addBuiltinTools() {
+	tools := []Tool{
+		NewStructuredTool(ToolInfo{
+			Name:        "upload_file",
+			Title:       "Upload File",
+			Description: "Upload a file to Koneksi Storage",
+			Permission:  PermissionWrite,
+		}, s.uploadFile),
+		NewStructuredTool(ToolInfo{
+			Name:        "download_file",
+			Title:       "Download File",
+			Description: "Download a file from Koneksi Storage",
+			// It writes local files, so reading storage is not enough
+			Permission: PermissionWrite,
+			// It can replace local files, but downloading again has no further effect
+			Annotations: ToolAnnotations{Destructive: true, Idempotent: true},
+		}, s.downloadFile),
+		NewStructuredTool(ToolInfo{
+			Name:        "read_file",
+			Title:       "Read File",
+			Description: "Read a file from Koneksi Storage and return its contents inline. Text is returned in windows; images and other binaries are returned whole",
+			Annotations: ToolAnnotations{ReadOnly: true},
+		}, s.readFile),
+		NewStructuredTool(ToolInfo{
+			Name:        "list_directories",
+			Title:       "List Directories",
+			Description: "List all directories in Koneksi Storage",
+			Annotations: ToolAnnotations{ReadOnly: true},
+		}, s.listDirectories),
+		NewStructuredTool(ToolInfo{
+			Name:        "create_directory",
+			Title:       "Create Directory",
+			Description: "Create a new directory in Koneksi Storage",
+			Permission:  PermissionWrite,
+		}, s.createDirectory),
+		NewStructuredTool(ToolInfo{
+			Name:        "search_files",
+			Title:       "List Files in Directory",
+			Description: "List files in a directory",
+			Annotations: ToolAnnotations{ReadOnly: true},
+		}, s.searchFiles),
+		NewStructuredTool(ToolInfo{
+			Name:        "upload_content",
+			Title:       "Upload Content",
+			Description: "Upload content directly to Koneksi Storage (for attached files)",
+			Permission:  PermissionWrite,
+		}, s.uploadContent),
+		NewStructuredTool(ToolInfo{
+			Name:        "backup_file",
+			Title:       "Back Up File",
+			Description: "Backup a file with optional gzip compression and password-based encryption",
+			Permission:  PermissionWrite,
+		}, s.backupFile),
+		NewStructuredTool(ToolInfo{
+			Name:        "restore_backup",
+			Title:       "Restore Backup",
+			Description: "Download a backup made by backup_file and decrypt and decompress it into the original file",
+			Permission:  PermissionWrite,
+			// Like download_file, it can replace local files
+			Annotations: ToolAnnotations{Destructive: true, Idempotent: true},
+		}, s.restoreBackup),
+	}
+
+	for _, tool := range tools {
+		if err := s.AddTool(tool); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// searchContentTool is the tool registered along with an indexer
+func (s *Server) searchContentTool() Tool {
+	return NewStructuredTool(ToolInfo{
+		Name:        "search_content",
+		Title:       "Search File Contents",
+		Description: "Full-text search over the contents of stored text files",
+		Annotations: ToolAnnotations{ReadOnly: true},
+	}, s.searchContent)
+}
@@ -0,0 +1,431 @@
+package mcp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/koneksi/mcp-server/internal/backup"
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+type testToolArgs struct {
+	Name    string   `json:"name" description:"A name" minLength:"1" pattern:"^[a-z]+$"`
+	Mode    string   `json:"mode,omitempty" enum:"fast,slow" default:"fast"`
+	Count   int      `json:"count,omitempty" minimum:"1" maximum:"10" default:"3"`
+	Ratio   float64  `json:"ratio,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Verbose *bool    `json:"verbose,omitempty"`
+	Ignored string   `json:"-"`
+	hidden  string
+}
+
+func TestNewTool_Schema(t *testing.T) {
+	tool := NewTool(ToolInfo{Name: "test"}, func(ctx context.Context, args *testToolArgs) (interface{}, error) {
+		return nil, nil
+	})
+
+	got, _ := json.Marshal(tool.Info().InputSchema)
+	want := `{"additionalProperties":false,"properties":{` +
+		`"count":{"default":3,"maximum":10,"minimum":1,"type":"integer"},` +
+		`"mode":{"default":"fast","enum":["fast","slow"],"type":"string"},` +
+		`"name":{"description":"A name","minLength":1,"pattern":"^[a-z]+$","type":"string"},` +
+		`"ratio":{"type":"number"},` +
+		`"tags":{"items":{"type":"string"},"type":"array"},` +
+		`"verbose":{"type":"boolean"}},` +
+		`"required":["name"],"type":"object"}`
+	if string(got) != want {
+		t.Errorf("Unexpected schema\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestTool_DecodeArguments(t *testing.T) {
+	var received *testToolArgs
+	tool := NewTool(ToolInfo{Name: "test"}, func(ctx context.Context, args *testToolArgs) (interface{}, error) {
+		received = args
+		return nil, nil
+	})
+
+	if _, err := tool.Call(context.Background(), []byte(`{"name":"abc","count":5}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := (testToolArgs{Name: "abc", Mode: "fast", Count: 5}); !reflect.DeepEqual(*received, want) {
+		t.Errorf("Expected defaults for missing arguments, got %+v", *received)
+	}
+
+	tests := map[string]string{
+		`{}`:                          "name is required",
+		`{"name":null}`:               "name is required",
+		`{"name":42}`:                 "name must be a string",
+		`{"name":"a","count":"five"}`: "count must be an integer",
+		`{"name":"a","count":1.5}`:    "count must be an integer",
+		`{"name":"a","tags":"x"}`:     "tags must be an array",
+		`["name"]`:                    "arguments must be an object",
+	}
+	for arguments, errMsg := range tests {
+		_, err := tool.Call(context.Background(), []byte(arguments))
+		if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Code != CodeInvalidParams || !strings.Contains(rpcErr.Message, errMsg) {
+			t.Errorf("%s: expected invalid params %q, got %v", arguments, errMsg, err)
+		}
+	}
+}
+
+func TestServer_AddTool(t *testing.T) {
+	server := NewServer("test-server", "1.0.0", nil)
+
+	echo := func(prefix string) Tool {
+		return NewTool(ToolInfo{Name: "echo", Description: prefix}, func(ctx context.Context, args *struct {
+			Text string `json:"text"`
+		}) (interface{}, error) {
+			return map[string]interface{}{
+				"content": []map[string]interface{}{{"type": "text", "text": prefix + args.Text}},
+			}, nil
+		})
+	}
+	if err := server.AddTool(echo("first: ")); err != nil {
+		t.Fatalf("AddTool failed: %v", err)
+	}
+	if err := server.AddTool(echo("second: ")); err != nil {
+		t.Fatalf("AddTool failed: %v", err)
+	}
+
+	// Replacing a tool keeps its place at the end of the list
+	tools := listToolNames(t, server)
+	if len(tools) != 10 || tools[0] != "upload_file" || tools[9] != "echo" {
+		t.Errorf("Unexpected tools %v", tools)
+	}
+
+	response, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if text := resultText(t, response); text != "second: hi" {
+		t.Errorf("Expected the replacing tool to run, got %q", text)
+	}
+
+	if err := server.AddTool(NewTool(ToolInfo{}, func(ctx context.Context, args *struct{}) (interface{}, error) { return nil, nil })); err == nil {
+		t.Error("Expected a tool without a name to be refused")
+	}
+}
+
+func listToolNames(t *testing.T, server *Server) []string {
+	t.Helper()
+
+	response, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, tool := range response.(map[string]interface{})["result"].(map[string]interface{})["tools"].([]map[string]interface{}) {
+		names = append(names, tool["name"].(string))
+	}
+	return names
+}
+
+func resultText(t *testing.T, response interface{}) string {
+	t.Helper()
+
+	result := response.(map[string]interface{})["result"].(map[string]interface{})
+	return result["content"].([]map[string]interface{})[0]["text"].(string)
+}
+
+func TestServer_BackupFile(t *testing.T) {
+	original := bytes.Repeat([]byte("backup me\n"), 10000)
+	source := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(source, original, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Backups are staged in the temporary directory, which must be left empty
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	var uploadedName string
+	var uploaded []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// The directory listing uploads check for existing files
+			w.Write([]byte(`{"data":{"files":[]}}`))
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected a multipart upload: %v", err)
+			return
+		}
+		uploadedName = header.Filename
+		uploaded, _ = io.ReadAll(file)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"file_id": "backup-id", "name": header.Filename, "size": len(uploaded)},
+		})
+	}))
+	defer mockServer.Close()
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+
+	tests := []struct {
+		arguments string
+		name      string
+		opts      backup.Options
+	}{
+		{`{"compress":true}`, "notes.txt.gz", backup.Options{Compress: true}},
+		{`{"encrypt":true,"encryptPassword":"s3cret"}`, "notes.txt.enc", backup.Options{Password: "s3cret"}},
+		{`{"compress":true,"encrypt":true,"encryptPassword":"s3cret"}`, "notes.txt.gz.enc", backup.Options{Compress: true, Password: "s3cret"}},
+	}
+
+	for _, tt := range tests {
+		arguments := strings.TrimSuffix(tt.arguments, "}") + fmt.Sprintf(`,"filePath":%q}`, source)
+		response, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"backup_file","arguments":` + arguments + `}}`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.arguments, err)
+		}
+		if text := resultText(t, response); !strings.Contains(text, "File backed up successfully!") {
+			t.Fatalf("%s: unexpected result %q", tt.arguments, text)
+		}
+
+		if uploadedName != tt.name {
+			t.Errorf("%s: expected the backup to be named %s, got %s", tt.arguments, tt.name, uploadedName)
+		}
+		if tt.opts.Compress && len(uploaded) >= len(original)/10 {
+			t.Errorf("%s: expected the backup to be compressed, got %d bytes", tt.arguments, len(uploaded))
+		}
+
+		var r io.Reader = bytes.NewReader(uploaded)
+		if tt.opts.Password != "" {
+			dr, err := backup.NewDecryptReader(r, tt.opts.Password)
+			if err != nil {
+				t.Fatalf("%s: failed to decrypt the backup: %v", tt.arguments, err)
+			}
+			r = dr
+		}
+		if tt.opts.Compress {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatalf("%s: failed to decompress the backup: %v", tt.arguments, err)
+			}
+			r = gr
+		}
+		restored, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: failed to read the backup: %v", tt.arguments, err)
+		}
+		if !bytes.Equal(restored, original) {
+			t.Errorf("%s: restored backup differs from the original", tt.arguments)
+		}
+	}
+
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("Expected temporary backups to be removed, found %d files", len(entries))
+	}
+
+	_, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"backup_file","arguments":{"filePath":%q,"encrypt":true}}}`, source))
+	if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("Expected encryption without a password to be invalid params, got %v", err)
+	}
+}
+
+func TestServer_RestoreBackup(t *testing.T) {
+	original := bytes.Repeat([]byte("restore me\n"), 10000)
+	var stored bytes.Buffer
+	if err := backup.Write(&stored, bytes.NewReader(original), backup.Options{Compress: true, Password: "s3cret"}); err != nil {
+		t.Fatalf("Failed to create the backup: %v", err)
+	}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(stored.Bytes())
+	}))
+	defer mockServer.Close()
+
+	dir := t.TempDir()
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	server.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	restore := func(arguments string) map[string]interface{} {
+		response, err := server.HandleRequest(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"restore_backup","arguments":` + arguments + `}}`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", arguments, err)
+		}
+		return response.(map[string]interface{})["result"].(map[string]interface{})
+	}
+
+	outputPath := filepath.Join(dir, "notes.txt")
+	result := restore(fmt.Sprintf(`{"fileId":"backup-id","outputPath":%q,"decompress":true,"decryptPassword":"s3cret"}`, outputPath))
+	if result["isError"] == true {
+		t.Fatalf("Expected the backup to be restored, got %v", result["content"])
+	}
+	if restored, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(restored, original) {
+		t.Errorf("Expected the original file to be restored, got %d bytes, %v", len(restored), err)
+	}
+	if output := result["structuredContent"].(restoreOutput); output.Size != int64(len(original)) || !output.Decompressed || !output.Decrypted {
+		t.Errorf("Unexpected restore output %+v", output)
+	}
+
+	// A wrong password or a missing option fails without leaving a file
+	for _, arguments := range []string{
+		`"decompress":true,"decryptPassword":"wrong"`,
+		`"decryptPassword":"wrong"`,
+		`"decompress":true`,
+	} {
+		outputPath := filepath.Join(dir, "failed.txt")
+		result := restore(fmt.Sprintf(`{"fileId":"backup-id","outputPath":%q,%s}`, outputPath, arguments))
+		if text := result["content"].([]map[string]interface{})[0]["text"].(string); result["isError"] != true || !strings.Contains(text, "failed to restore backup") {
+			t.Errorf("%s: expected the restore to fail, got %v", arguments, result["content"])
+		}
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no file to be left, got %v", arguments, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the restored file, found %d files", len(entries))
+	}
+}
+
+func TestServer_BackupFile_Cancelled(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(source, []byte("backup me"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient("http://localhost", "test-id", "test-secret", ""))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	response, err := server.HandleRequestContext(ctx, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"backup_file","arguments":{"filePath":%q,"compress":true}}}`, source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result := response.(map[string]interface{})["result"].(map[string]interface{}); result["isError"] != true {
+		t.Errorf("Expected a cancelled backup to fail, got %v", result)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("Expected the temporary backup to be removed, found %d files", len(entries))
+	}
+}
+
+func TestServer_StructuredOutput(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/clients/v1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"file_id": "file-1", "name": "notes.txt", "size": 5},
+		})
+	})
+	mux.HandleFunc("/api/clients/v1/files/file-1/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/api/clients/v1/directories", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"id": "dir-2", "name": "docs", "created_at": "2025-01-02T03:04:05Z"},
+		})
+	})
+	mux.HandleFunc("/api/clients/v1/directories/root", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"directory":      map[string]interface{}{"id": "root", "name": "Root", "size": 5},
+				"subdirectories": []map[string]interface{}{{"id": "dir-2", "name": "docs"}},
+				"files":          []map[string]interface{}{{"id": "file-0", "name": "readme.txt", "size": 5}},
+			},
+		})
+	})
+	mux.HandleFunc("/api/clients/v1/directories/dir-2", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"files": []map[string]interface{}{{"id": "file-1", "name": "notes.txt", "size": 5, "content_type": "text/plain"}},
+			},
+		})
+	})
+	mockServer := httptest.NewServer(mux)
+	defer mockServer.Close()
+
+	source := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(source, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	output := filepath.Join(t.TempDir(), "out.txt")
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	server.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	server.HandleMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	calls := map[string]string{
+		"upload_file":      fmt.Sprintf(`{"filePath":%q}`, source),
+		"upload_content":   `{"fileName":"notes.txt","content":"aGVsbG8="}`,
+		"backup_file":      fmt.Sprintf(`{"filePath":%q,"compress":true}`, source),
+		"download_file":    fmt.Sprintf(`{"fileId":"file-1","outputPath":%q}`, output),
+		"restore_backup":   fmt.Sprintf(`{"fileId":"file-1","outputPath":%q}`, filepath.Join(filepath.Dir(output), "restored.txt")),
+		"read_file":        `{"fileId":"file-1"}`,
+		"list_directories": `{}`,
+		"create_directory": `{"name":"docs"}`,
+		"search_files":     `{"directoryId":"dir-2"}`,
+	}
+
+	for name, arguments := range calls {
+		tool, _ := server.lookupTool(name)
+		response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + arguments + `}}`)
+		result := response.(map[string]interface{})["result"].(map[string]interface{})
+		if result["isError"] == true {
+			t.Errorf("%s failed: %v", name, result["content"])
+			continue
+		}
+
+		// The structured content must match the declared output schema
+		data, _ := json.Marshal(result["structuredContent"])
+		if err := validateArguments(tool.Info().OutputSchema, data); err != nil {
+			t.Errorf("%s: structured content %s does not match its schema: %v", name, data, err)
+		}
+	}
+
+	// The values are the ones the text describes
+	hello := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	response := server.HandleMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"upload_file","arguments":{"filePath":%q}}}`, source))
+	upload := response.(map[string]interface{})["result"].(map[string]interface{})["structuredContent"].(uploadOutput)
+	if upload.FileID != "file-1" || upload.SHA256 != hello || upload.URI != "koneksi://file/file-1" {
+		t.Errorf("Unexpected upload output %+v", upload)
+	}
+
+	response = server.HandleMessage(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"search_files","arguments":{"directoryId":"dir-2"}}}`)
+	listing := response.(map[string]interface{})["result"].(map[string]interface{})["structuredContent"].(searchFilesOutput)
+	if len(listing.Files) != 1 || listing.Files[0].ID != "file-1" || listing.Files[0].ContentType != "text/plain" {
+		t.Errorf("Unexpected listing %+v", listing)
+	}
+}
+
+func TestServer_StructuredOutputGating(t *testing.T) {
+	for version, structured := range map[string]bool{"2025-03-26": false, "2025-06-18": true} {
+		server := NewServer("test-server", "1.0.0", nil)
+		server.HandleMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"` + version + `"}}`)
+
+		response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+		for _, tool := range response.(map[string]interface{})["result"].(map[string]interface{})["tools"].([]map[string]interface{}) {
+			if _, ok := tool["outputSchema"]; ok != structured {
+				t.Errorf("%s: expected outputSchema on %s to be listed: %t", version, tool["name"], structured)
+			}
+		}
+
+		server.AddTool(NewStructuredTool(ToolInfo{Name: "answer"}, func(ctx context.Context, args *struct{}) (*ToolResult[struct {
+			Value int `json:"value"`
+		}], error) {
+			result := &ToolResult[struct {
+				Value int `json:"value"`
+			}]{Content: textContent("42")}
+			result.Structured.Value = 42
+			return result, nil
+		}))
+		response = server.HandleMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"answer"}}`)
+		if _, ok := response.(map[string]interface{})["result"].(map[string]interface{})["structuredContent"]; ok != structured {
+			t.Errorf("%s: expected structuredContent in the result: %t", version, structured)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// rootDirectory is the key of the rules for uploads that go to the storage
+// root, and for create_directory
+const rootDirectory = "root"
+
+// UploadPolicy holds the organisation's rules for what may be stored in
+// Koneksi, checked before anything is sent. It is read from a JSON file:
+//
+//	{
+//	  "default": {"maxSize": 104857600, "denyTypes": ["application/x-executable"]},
+//	  "directories": {
+//	    "dir-123": {"allowTypes": ["image/*"], "denyNames": ["(?i)\\.psd$"]},
+//	    "root": {"readOnly": true}
+//	  }
+//	}
+//
+// The rules of a directory override the default ones rule by rule. Uploads
+// without a directory ID go by the rules of the default directory, or of
+// "root" when there is none.
+type UploadPolicy struct {
+	Default     UploadRules            `json:"default"`
+	Directories map[string]UploadRules `json:"directories"`
+}
+
+// UploadRules limit the uploads to a directory. Rules that are not set do
+// not limit anything.
+type UploadRules struct {
+	// MaxSize is the largest file in bytes
+	MaxSize *int64 `json:"maxSize,omitempty"`
+
+	// AllowTypes and DenyTypes are content types such as "image/png" or
+	// "text/*". Types are detected from the content, not the file name.
+	// With AllowTypes, a file must be of one of them.
+	AllowTypes []string `json:"allowTypes,omitempty"`
+	DenyTypes  []string `json:"denyTypes,omitempty"`
+
+	// AllowNames and DenyNames are regular expressions matched against the
+	// file name. With AllowNames, the name must match one of them.
+	AllowNames []string `json:"allowNames,omitempty"`
+	DenyNames  []string `json:"denyNames,omitempty"`
+
+	// ReadOnly directories accept no uploads; a read-only root also refuses
+	// create_directory
+	ReadOnly *bool `json:"readOnly,omitempty"`
+}
+
+// uploadRules are UploadRules with a directory's rules merged into the
+// default ones and the name patterns compiled
+type uploadRules struct {
+	maxSize    int64
+	allowTypes []string
+	denyTypes  []string
+	allowNames []*regexp.Regexp
+	denyNames  []*regexp.Regexp
+	readOnly   bool
+}
+
+// uploadPolicy is a validated UploadPolicy
+type uploadPolicy struct {
+	defaults    uploadRules
+	directories map[string]uploadRules
+}
+
+// SetUploadPolicy validates policy and makes it the one uploads are checked against
+func (s *Server) SetUploadPolicy(policy UploadPolicy) error {
+	compiled := &uploadPolicy{directories: make(map[string]uploadRules)}
+
+	var err error
+	if compiled.defaults, err = compileRules(uploadRules{}, policy.Default); err != nil {
+		return fmt.Errorf("default rules: %w", err)
+	}
+	for dir, rules := range policy.Directories {
+		if compiled.directories[dir], err = compileRules(compiled.defaults, rules); err != nil {
+			return fmt.Errorf("rules for %s: %w", dir, err)
+		}
+	}
+
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+
+	s.uploadPolicy = compiled
+	return nil
+}
+
+// compileRules applies the rules that are set on top of base
+func compileRules(base uploadRules, rules UploadRules) (uploadRules, error) {
+	if rules.MaxSize != nil {
+		if *rules.MaxSize <= 0 {
+			return base, fmt.Errorf("maxSize must be positive")
+		}
+		base.maxSize = *rules.MaxSize
+	}
+	for _, types := range [][]string{rules.AllowTypes, rules.DenyTypes} {
+		for _, t := range types {
+			if !strings.Contains(t, "/") {
+				return base, fmt.Errorf("invalid content type %q, expected e.g. text/plain or image/*", t)
+			}
+		}
+	}
+	if rules.AllowTypes != nil {
+		base.allowTypes = rules.AllowTypes
+	}
+	if rules.DenyTypes != nil {
+		base.denyTypes = rules.DenyTypes
+	}
+
+	var err error
+	if rules.AllowNames != nil {
+		if base.allowNames, err = compilePatterns(rules.AllowNames); err != nil {
+			return base, err
+		}
+	}
+	if rules.DenyNames != nil {
+		if base.denyNames, err = compilePatterns(rules.DenyNames); err != nil {
+			return base, err
+		}
+	}
+	if rules.ReadOnly != nil {
+		base.readOnly = *rules.ReadOnly
+	}
+	return base, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// LoadUploadPolicy reads the upload policy from a JSON file. An invalid
+// file leaves the current policy in place.
+func (s *Server) LoadUploadPolicy(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read upload policy: %w", err)
+	}
+	return s.parseUploadPolicy(path, data)
+}
+
+func (s *Server) parseUploadPolicy(path string, data []byte) error {
+	var policy UploadPolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return fmt.Errorf("failed to parse upload policy %s: %w", path, err)
+	}
+	if err := s.SetUploadPolicy(policy); err != nil {
+		return fmt.Errorf("invalid upload policy %s: %w", path, err)
+	}
+	return nil
+}
+
+// WatchUploadPolicy reads the upload policy file every interval until stop
+// is closed, and loads it again whenever its contents changed. Policy files
+// are small, so comparing their contents is cheap and, unlike modification
+// times, never misses a quick succession of edits.
+func (s *Server) WatchUploadPolicy(path string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			// Logged once, not on every tick until the file is back
+			if last == nil || len(last) > 0 {
+				log.Printf("Keeping the current upload policy: %v", err)
+			}
+			last = []byte{}
+			continue
+		}
+		if last != nil && bytes.Equal(data, last) {
+			continue
+		}
+		first := last == nil
+		last = data
+
+		if err := s.parseUploadPolicy(path, data); err != nil {
+			log.Printf("Keeping the current upload policy: %v", err)
+			continue
+		}
+		if !first {
+			log.Printf("Reloaded the upload policy from %s", path)
+		}
+	}
+}
+
+// uploadRulesFor returns the rules for uploads to a directory, and whether
+// there is a policy at all
+func (s *Server) uploadRulesFor(directoryId string) (uploadRules, bool) {
+	s.uploadMu.RLock()
+	policy := s.uploadPolicy
+	s.uploadMu.RUnlock()
+
+	if policy == nil {
+		return uploadRules{}, false
+	}
+	if rules, ok := policy.directories[directoryId]; ok {
+		return rules, true
+	}
+	return policy.defaults, true
+}
+
+// policyDirectory returns the directory an upload to directoryId goes to,
+// for looking up its rules. directoryId is where the upload is sent, which
+// is the root when empty.
+func (s *Server) policyDirectory(directoryId string) string {
+	if directoryId == "" {
+		return rootDirectory
+	}
+	return directoryId
+}
+
+// checkUpload checks an upload against the upload policy. head is the start
+// of the content, which its type is detected from.
+func (s *Server) checkUpload(directoryId, name string, size int64, head []byte) error {
+	dir := s.policyDirectory(directoryId)
+	rules, ok := s.uploadRulesFor(dir)
+	if !ok {
+		return nil
+	}
+
+	if rules.readOnly {
+		return fmt.Errorf("upload policy: directory %s is read-only", dir)
+	}
+
+	var violations []string
+	if rules.maxSize > 0 && size > rules.maxSize {
+		violations = append(violations, fmt.Sprintf("it is %d bytes, more than the limit of %d bytes", size, rules.maxSize))
+	}
+
+	contentType := sniffContentType(head)
+	if len(rules.allowTypes) > 0 && !matchesContentType(contentType, rules.allowTypes) {
+		violations = append(violations, fmt.Sprintf("its content is %s, which is not one of the allowed types %s", contentType, strings.Join(rules.allowTypes, ", ")))
+	}
+	if matchesContentType(contentType, rules.denyTypes) {
+		violations = append(violations, fmt.Sprintf("its content is %s, which is not allowed", contentType))
+	}
+
+	if len(rules.allowNames) > 0 && !matchesName(name, rules.allowNames) {
+		violations = append(violations, fmt.Sprintf("its name does not match any of the allowed patterns %s", patternList(rules.allowNames)))
+	}
+	for _, re := range rules.denyNames {
+		if re.MatchString(name) {
+			violations = append(violations, fmt.Sprintf("its name matches the blocked pattern %q", re.String()))
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("upload policy: %s cannot be stored in directory %s: %s", name, dir, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// checkCreateDirectory checks create_directory against the upload policy
+func (s *Server) checkCreateDirectory() error {
+	if rules, ok := s.uploadRulesFor(rootDirectory); ok && rules.readOnly {
+		return fmt.Errorf("upload policy: directory %s is read-only, no directories can be created", rootDirectory)
+	}
+	return nil
+}
+
+// executableSignatures are the magic numbers of executables, which
+// http.DetectContentType does not know
+var executableSignatures = []struct {
+	magic       string
+	contentType string
+}{
+	{"\x7fELF", "application/x-executable"},
+	{"MZ", "application/x-msdownload"},
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xca\xfe\xba\xbe", "application/x-mach-binary"},
+}
+
+// sniffContentType detects the content type of data from its first bytes,
+// without parameters such as the charset
+func sniffContentType(head []byte) string {
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(head, []byte(sig.magic)) {
+			return sig.contentType
+		}
+	}
+
+	contentType := http.DetectContentType(head)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// matchesContentType reports whether contentType is one of types, which may end in
+// a wildcard subtype such as "text/*"
+func matchesContentType(contentType string, types []string) bool {
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == contentType || t == "*/*" || (strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesName(name string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func patternList(patterns []*regexp.Regexp) string {
+	quoted := make([]string, len(patterns))
+	for i, re := range patterns {
+		quoted[i] = fmt.Sprintf("%q", re.String())
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// peekHead returns the first bytes of r, to detect its content type from,
+// and a reader that still yields all of r
+func peekHead(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), err
+}
@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koneksi/mcp-server/internal/koneksi"
+)
+
+// pngHeader is the start of a PNG file, enough to be sniffed as image/png
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestServer_UploadPolicy(t *testing.T) {
+	uploads := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// The directory listing uploads check for existing files
+			w.Write([]byte(`{"data":{"files":[]}}`))
+			return
+		}
+		uploads++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"file_id": "f1", "directory_id": "d1", "name": "x", "size": 1},
+		})
+	}))
+	defer mockServer.Close()
+
+	server := NewServer("test-server", "1.0.0", koneksi.NewClient(mockServer.URL, "test-id", "test-secret", ""))
+	var policy UploadPolicy
+	if err := json.Unmarshal([]byte(`{
+		"default": {"maxSize": 64, "denyTypes": ["application/x-executable"], "denyNames": ["(?i)\\.exe$"]},
+		"directories": {
+			"images": {"maxSize": 1024, "allowTypes": ["image/*"]},
+			"reports": {"allowNames": ["^report-[0-9]{4}\\.txt$"]},
+			"root": {"readOnly": true}
+		}
+	}`), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetUploadPolicy(policy); err != nil {
+		t.Fatalf("Failed to set the upload policy: %v", err)
+	}
+
+	upload := func(directoryId, name, content string) string {
+		arguments, _ := json.Marshal(map[string]string{
+			"fileName":    name,
+			"content":     base64.StdEncoding.EncodeToString([]byte(content)),
+			"directoryId": directoryId,
+		})
+		response, err := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"upload_content","arguments":%s}}`, arguments))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(t, response)
+	}
+
+	tests := []struct {
+		directoryId, name, content string
+		want                       string
+	}{
+		{"docs", "notes.txt", "hello", ""},
+		{"docs", "big.txt", strings.Repeat("a", 65), "it is 65 bytes, more than the limit of 64 bytes"},
+		{"docs", "tool.bin", "\x7fELF\x02\x01\x01", "its content is application/x-executable, which is not allowed"},
+		{"docs", "setup.EXE", "hello", `its name matches the blocked pattern "(?i)\\.exe$"`},
+		{"images", "photo.png", pngHeader + strings.Repeat("\x00", 100), ""},
+		{"images", "photo.png", "not an image at all", "its content is text/plain, which is not one of the allowed types image/*"},
+		{"reports", "report-2025.txt", "q3", ""},
+		{"reports", "notes.txt", "q3", `its name does not match any of the allowed patterns "^report-[0-9]{4}\\.txt$"`},
+		{"", "notes.txt", "hello", "directory root is read-only"},
+	}
+
+	for _, tt := range tests {
+		uploads = 0
+		text := upload(tt.directoryId, tt.name, tt.content)
+		if tt.want == "" {
+			if !strings.Contains(text, "Content uploaded successfully!") || uploads != 1 {
+				t.Errorf("%s/%s: expected the upload to succeed, got %q", tt.directoryId, tt.name, text)
+			}
+			continue
+		}
+		if !strings.Contains(text, "upload policy: ") || !strings.Contains(text, tt.want) {
+			t.Errorf("%s/%s: expected an error containing %q, got %q", tt.directoryId, tt.name, tt.want, text)
+		}
+		if uploads != 0 {
+			t.Errorf("%s/%s: expected nothing to reach Koneksi", tt.directoryId, tt.name)
+		}
+	}
+
+	// Several violations are reported at once
+	text := upload("images", "setup.exe", strings.Repeat("a", 2000))
+	if !strings.Contains(text, "more than the limit of 1024 bytes; its content is text/plain") || !strings.Contains(text, "blocked pattern") {
+		t.Errorf("Expected every violation to be reported, got %q", text)
+	}
+
+	// Backups are checked by the type of the file, not of the backup
+	source := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(source, []byte("\x7fELF\x02\x01\x01"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uploads = 0
+	response, _ := server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"backup_file","arguments":{"filePath":%q,"directoryId":"docs","compress":true}}}`, source))
+	if text := resultText(t, response); !strings.Contains(text, "its content is application/x-executable") || uploads != 0 {
+		t.Errorf("Expected the compressed backup to be refused, got %q", text)
+	}
+
+	// Uploads are checked against the directory they are sent to:
+	// upload_content goes to the configured directory, upload_file to the root
+	server.client.DirectoryID = "docs"
+	if text := upload("", "notes.txt", "hello"); !strings.Contains(text, "Content uploaded successfully!") {
+		t.Errorf("Expected the upload to the configured directory to succeed, got %q", text)
+	}
+	response, _ = server.HandleRequest(fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"upload_file","arguments":{"filePath":%q}}}`, source))
+	if text := resultText(t, response); !strings.Contains(text, "directory root is read-only") {
+		t.Errorf("Expected the upload to the root to be refused, got %q", text)
+	}
+	server.client.DirectoryID = ""
+
+	// A read-only root also refuses new directories
+	response, _ = server.HandleRequest(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"create_directory","arguments":{"name":"new"}}}`)
+	if text := resultText(t, response); !strings.Contains(text, "no directories can be created") {
+		t.Errorf("Expected create_directory to be refused, got %q", text)
+	}
+}
+
+func TestServer_WatchUploadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	write := func(policy string) {
+		if err := os.WriteFile(path, []byte(policy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := NewServer("test-server", "1.0.0", nil)
+	write(`{"default": {"maxSize": 10}}`)
+	if err := server.LoadUploadPolicy(path); err != nil {
+		t.Fatalf("Failed to load the upload policy: %v", err)
+	}
+	if err := server.checkUpload("d1", "a.txt", 20, []byte("a")); err == nil {
+		t.Fatal("Expected the loaded policy to apply")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go server.WatchUploadPolicy(path, 10*time.Millisecond, stop)
+
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	write(`{"default": {"maxSize": 100}}`)
+	waitFor("the policy to be reloaded", func() bool {
+		return server.checkUpload("d1", "a.txt", 20, []byte("a")) == nil
+	})
+
+	// An invalid file keeps the current policy
+	write(`{"default": {"maxSize": 100, "denyNames": ["("]}}`)
+	time.Sleep(100 * time.Millisecond)
+	if err := server.checkUpload("d1", "a.txt", 20, []byte("a")); err != nil {
+		t.Errorf("Expected the previous policy to stay in place, got %v", err)
+	}
+	if err := server.LoadUploadPolicy(path); err == nil || !strings.Contains(err.Error(), "invalid name pattern") {
+		t.Errorf("Expected the invalid pattern to be reported, got %v", err)
+	}
+
+	write(`{"default": {"maxSize": 100}, "unknown": true}`)
+	if err := server.LoadUploadPolicy(path); err == nil {
+		t.Error("Expected unknown fields to be refused")
+	}
+}
@@ -0,0 +1,309 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// schemaViolation is one way a value fails its schema, located by a JSON
+// pointer (RFC 6901) into the value
+type schemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (v schemaViolation) String() string {
+	if v.Pointer == "" {
+		return "arguments " + v.Message
+	}
+	return v.Pointer + " " + v.Message
+}
+
+// validateArguments checks raw tool arguments against a tool's input schema
+// and reports every violation in one invalid params error, so the caller can
+// fix them all at once
+func validateArguments(schema map[string]interface{}, raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return invalidParams("failed to parse arguments: %v", err)
+	}
+
+	violations := validateValue(schema, value, "")
+	if len(violations) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.String()
+	}
+	err := invalidParams("invalid arguments: %s", strings.Join(messages, "; "))
+	err.Data = map[string]interface{}{
+		"violations": violations,
+	}
+	return err
+}
+
+// validateValue checks a value decoded with json.Number against a JSON
+// schema. It supports the keywords tool schemas use: type, enum, const,
+// properties, required, additionalProperties, items, pattern, minLength,
+// maxLength, minimum, maximum, exclusiveMinimum, exclusiveMaximum, minItems
+// and maxItems.
+func validateValue(schema map[string]interface{}, value interface{}, pointer string) []schemaViolation {
+	violation := func(format string, args ...interface{}) []schemaViolation {
+		return []schemaViolation{{Pointer: pointer, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	// Nothing else is worth checking once the type is wrong
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !matchesType(types, value) {
+		return violation("must be %s, not %s", joinTypes(types), withArticle(typeOf(value)))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		return violation("must be one of %s", formatValues(enum))
+	}
+	if constant, ok := schema["const"]; ok && !sameValue(constant, value) {
+		return violation("must be %s", formatValues([]interface{}{constant}))
+	}
+
+	var violations []schemaViolation
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				violations = append(violations, schemaViolation{Pointer: pointer + "/" + escapePointer(name), Message: "is required"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			child := pointer + "/" + escapePointer(name)
+			if propSchema, ok := properties[name].(map[string]interface{}); ok {
+				violations = append(violations, validateValue(propSchema, v[name], child)...)
+				continue
+			}
+			if _, ok := properties[name]; ok {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					violations = append(violations, schemaViolation{Pointer: child, Message: "is not an allowed property"})
+				}
+			case map[string]interface{}:
+				violations = append(violations, validateValue(additional, v[name], child)...)
+			}
+		}
+
+	case []interface{}:
+		if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < min {
+			violations = append(violations, violation("must have at least %s items", formatNumber(min))...)
+		}
+		if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > max {
+			violations = append(violations, violation("must have at most %s items", formatNumber(max))...)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				violations = append(violations, validateValue(items, item, fmt.Sprintf("%s/%d", pointer, i))...)
+			}
+		}
+
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema["minLength"]); ok && length < min {
+			violations = append(violations, violation("must be at least %s characters long", formatNumber(min))...)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && length > max {
+			violations = append(violations, violation("must be at most %s characters long", formatNumber(max))...)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				violations = append(violations, violation("cannot be checked against the invalid pattern %q", pattern)...)
+			} else if !re.MatchString(v) {
+				violations = append(violations, violation("must match the pattern %q", pattern)...)
+			}
+		}
+
+	case json.Number:
+		n, _ := v.Float64()
+		if min, ok := schemaNumber(schema["minimum"]); ok && n < min {
+			violations = append(violations, violation("must be at least %s", formatNumber(min))...)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && n > max {
+			violations = append(violations, violation("must be at most %s", formatNumber(max))...)
+		}
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && n <= min {
+			violations = append(violations, violation("must be greater than %s", formatNumber(min))...)
+		}
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && n >= max {
+			violations = append(violations, violation("must be less than %s", formatNumber(max))...)
+		}
+	}
+	return violations
+}
+
+// schemaTypes returns the types allowed by a type keyword, which is a string
+// or a list of strings
+func schemaTypes(keyword interface{}) []string {
+	if t, ok := keyword.(string); ok {
+		return []string{t}
+	}
+	return stringList(keyword)
+}
+
+func stringList(keyword interface{}) []string {
+	switch list := keyword.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		var strs []string
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf names the JSON schema type of a decoded value. Whole numbers are
+// integers, as in JSON schema.
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if n, err := v.Float64(); err == nil && n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func withArticle(t string) string {
+	switch t {
+	case "null":
+		return t
+	case "array", "integer", "object":
+		return "an " + t
+	default:
+		return "a " + t
+	}
+}
+
+func joinTypes(types []string) string {
+	named := make([]string, len(types))
+	for i, t := range types {
+		named[i] = withArticle(t)
+	}
+	return strings.Join(named, " or ")
+}
+
+// schemaNumber reads a numeric keyword, whether it was written in Go or
+// decoded from JSON
+func schemaNumber(keyword interface{}) (float64, bool) {
+	switch n := keyword.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if sameValue(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue compares a schema value with a decoded one, numbers by value
+func sameValue(schemaValue, value interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		f, _ := n.Float64()
+		want, isNumber := schemaNumber(schemaValue)
+		return isNumber && f == want
+	}
+	return reflect.DeepEqual(schemaValue, value)
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func formatValues(values []interface{}) string {
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		data, _ := json.Marshal(v)
+		formatted[i] = string(data)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// escapePointer escapes a property name for use in a JSON pointer
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// patterns caches compiled schema patterns
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
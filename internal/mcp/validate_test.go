@@ -0,0 +1,106 @@
+package mcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"mode": {"type": "string", "enum": ["fast", "slow"]},
+			"count": {"type": "integer", "minimum": 1, "maximum": 10},
+			"ratio": {"type": "number", "exclusiveMinimum": 0},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"meta": {"type": "object", "additionalProperties": {"type": "boolean"}},
+			"a/b": {"type": ["string", "null"]}
+		},
+		"required": ["name", "count"],
+		"additionalProperties": false
+	}`), &schema)
+
+	tests := []struct {
+		arguments string
+		want      []schemaViolation
+	}{
+		{`{"name":"abc","count":3}`, nil},
+		{`{"name":"abc","count":3.0,"ratio":0.5,"tags":["x"],"meta":{"k":true},"a/b":null}`, nil},
+		{`[]`, []schemaViolation{{"", "must be an object, not an array"}}},
+		{`{}`, []schemaViolation{{"/name", "is required"}, {"/count", "is required"}}},
+		{`{"name":7,"count":"3"}`, []schemaViolation{
+			{"/count", "must be an integer, not a string"},
+			{"/name", "must be a string, not an integer"},
+		}},
+		{`{"name":"ABC","count":1.5,"extra":1}`, []schemaViolation{
+			{"/count", "must be an integer, not a number"},
+			{"/extra", "is not an allowed property"},
+			{"/name", `must match the pattern "^[a-z]+$"`},
+		}},
+		{`{"name":"a","count":0,"mode":"medium"}`, []schemaViolation{
+			{"/count", "must be at least 1"},
+			{"/mode", `must be one of "fast", "slow"`},
+			{"/name", "must be at least 2 characters long"},
+		}},
+		{`{"name":"abcdef","count":11,"ratio":0}`, []schemaViolation{
+			{"/count", "must be at most 10"},
+			{"/name", "must be at most 5 characters long"},
+			{"/ratio", "must be greater than 0"},
+		}},
+		{`{"name":"ab","count":1,"tags":["x",2,"z"],"meta":{"k":"yes"},"a/b":1}`, []schemaViolation{
+			{"/a~1b", "must be a string or null, not an integer"},
+			{"/meta/k", "must be a boolean, not a string"},
+			{"/tags", "must have at most 2 items"},
+			{"/tags/1", "must be a string, not an integer"},
+		}},
+	}
+
+	for _, tt := range tests {
+		err := validateArguments(schema, []byte(tt.arguments))
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.arguments, err)
+			}
+			continue
+		}
+
+		rpcErr, ok := err.(*RPCError)
+		if !ok || rpcErr.Code != CodeInvalidParams {
+			t.Errorf("%s: expected invalid params, got %v", tt.arguments, err)
+			continue
+		}
+		got := rpcErr.Data.(map[string]interface{})["violations"].([]schemaViolation)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got violations %v, want %v", tt.arguments, got, tt.want)
+		}
+		for _, v := range tt.want {
+			if !strings.Contains(rpcErr.Message, v.String()) {
+				t.Errorf("%s: expected the message to contain %q, got %q", tt.arguments, v.String(), rpcErr.Message)
+			}
+		}
+	}
+}
+
+func TestServer_ToolArgumentValidation(t *testing.T) {
+	server := newInitializedServer(t, nil)
+
+	response := server.HandleMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file","arguments":{"fileId":123,"length":0,"lenght":100}}}`)
+	errObj := errorObject(t, response)
+	if errObj["code"] != CodeInvalidParams {
+		t.Fatalf("Expected invalid params, got %v", errObj)
+	}
+
+	// Every problem is reported at once, with a pointer to the argument
+	want := "invalid arguments: /fileId must be a string, not an integer; /lenght is not an allowed property; /length must be at least 1"
+	if errObj["message"] != want {
+		t.Errorf("Expected message %q, got %q", want, errObj["message"])
+	}
+	data, _ := json.Marshal(errObj["data"])
+	if !strings.Contains(string(data), `{"pointer":"/lenght","message":"is not an allowed property"}`) {
+		t.Errorf("Expected the violations in the error data, got %s", data)
+	}
+}
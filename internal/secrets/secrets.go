@@ -0,0 +1,293 @@
+// Package secrets finds credentials in files before they leave the machine:
+// private keys, cloud and service API keys, secret assignments as found in
+// .env files, and other high-entropy tokens.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces secrets in redacted data
+const Mask = "[REDACTED]"
+
+// maxLine is the longest line scanned at once; longer lines are scanned in
+// pieces, and a secret across two pieces can be missed
+const maxLine = 1 << 20
+
+// sniffSize is how much of the data is checked for NUL bytes, which mark it
+// as binary and not worth scanning
+const sniffSize = 8000
+
+// Finding is a secret found in scanned data
+type Finding struct {
+	// Rule identifies the kind of secret, e.g. "aws-access-key"
+	Rule string
+
+	// Description says what the secret is
+	Description string
+
+	// Line and Column are where the secret starts, both from 1, with the
+	// column counted in bytes
+	Line   int
+	Column int
+
+	// Preview is the secret with all but its first characters masked, safe
+	// to show to the model and the user
+	Preview string
+
+	// Start and End are the byte offsets of the secret in the data
+	Start int64
+	End   int64
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("line %d, column %d: %s (%s)", f.Line, f.Column, f.Description, f.Preview)
+}
+
+// rule finds one kind of secret on a line. The secret is the first
+// submatch, or the whole match if the pattern has none.
+type rule struct {
+	id          string
+	description string
+	pattern     *regexp.Regexp
+}
+
+var rules = []rule{
+	{"aws-access-key", "AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github-token", "GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"gitlab-token", "GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}\b`)},
+	{"slack-token", "Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9\-]{10,}`)},
+	{"stripe-key", "Stripe live key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}\b`)},
+	{"google-api-key", "Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"azure-storage-key", "Azure storage account key", regexp.MustCompile(`AccountKey=([A-Za-z0-9+/]{80,}={0,2})`)},
+	{"jwt", "JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`)},
+	{"secret-assignment", "Secret assigned to a variable", regexp.MustCompile(`(?i)^\s*(?:export\s+)?[a-z0-9_.]*(?:secret|passw(?:or)?d|token|api_?key|private_?key|access_?key|credential)[a-z0-9_.]*\s*=\s*["']?([^\s"'#]{6,})`)},
+}
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	tokenPattern    = regexp.MustCompile(`[A-Za-z0-9+/_\-]{32,}={0,2}`)
+)
+
+// minTokenEntropy is the Shannon entropy in bits per character from which a
+// long token is taken to be random, and so likely a secret. Hex strings
+// such as hashes stay below it, as they only use 16 characters.
+const minTokenEntropy = 4.3
+
+// Scan reads r to the end and returns the secrets in it, in order. Data
+// that looks binary is not scanned.
+func Scan(r io.Reader) ([]Finding, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		_, err := io.Copy(io.Discard, br)
+		return nil, err
+	}
+
+	var findings []Finding
+	var key *Finding // private key block still open
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		line, err := readLine(br)
+		if len(line) > 0 {
+			findings, key = scanLine(findings, key, line, lineNo, offset)
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A key without its END line is redacted to the end of the data
+	if key != nil {
+		key.End = offset
+		findings = append(findings, *key)
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	return findings, nil
+}
+
+// readLine returns the next line including its newline, at most maxLine bytes
+func readLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull && len(line) < maxLine {
+			continue
+		}
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		return line, err
+	}
+}
+
+// scanLine adds the secrets on one line to findings. key is the private key
+// block the line is in, if any, and the one open after it is returned.
+func scanLine(findings []Finding, key *Finding, line []byte, lineNo int, offset int64) ([]Finding, *Finding) {
+	// taken are the parts of the line already found to be secrets
+	var taken [][2]int
+	at := func(start, end int) Finding {
+		return Finding{Line: lineNo, Column: start + 1, Start: offset + int64(start), End: offset + int64(end)}
+	}
+
+	from := 0
+	for {
+		if key != nil {
+			end := privateKeyEnd.FindIndex(line[from:])
+			if end == nil {
+				return findings, key
+			}
+			key.End = offset + int64(from+end[1])
+			findings = append(findings, *key)
+			taken = append(taken, [2]int{0, from + end[1]})
+			key, from = nil, from+end[1]
+		}
+
+		begin := privateKeyBegin.FindIndex(line[from:])
+		if begin == nil {
+			break
+		}
+		f := at(from+begin[0], from+begin[1])
+		f.Rule, f.Description = "private-key", "Private key"
+		f.Preview = string(line[from+begin[0] : from+begin[1]])
+		key, from = &f, from+begin[1]
+	}
+	if key != nil {
+		taken = append(taken, [2]int{int(key.Start - offset), len(line)})
+	}
+
+	overlaps := func(start, end int) bool {
+		for _, t := range taken {
+			if start < t[1] && end > t[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range rules {
+		for _, m := range r.pattern.FindAllSubmatchIndex(line, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			secret := string(line[start:end])
+			if overlaps(start, end) || (r.id == "secret-assignment" && isPlaceholder(secret)) {
+				continue
+			}
+			f := at(start, end)
+			f.Rule, f.Description, f.Preview = r.id, r.description, preview(secret)
+			findings = append(findings, f)
+			taken = append(taken, [2]int{start, end})
+		}
+	}
+
+	for _, m := range tokenPattern.FindAllIndex(line, -1) {
+		token := string(line[m[0]:m[1]])
+		if overlaps(m[0], m[1]) || !looksRandom(token) {
+			continue
+		}
+		f := at(m[0], m[1])
+		f.Rule, f.Description, f.Preview = "high-entropy-token", "High-entropy token", preview(token)
+		findings = append(findings, f)
+		taken = append(taken, [2]int{m[0], m[1]})
+	}
+
+	return findings, key
+}
+
+// isPlaceholder reports whether an assigned value is an obvious stand-in
+// rather than a real secret, as found in example configuration
+func isPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(value, "${"), strings.HasPrefix(value, "$("), strings.HasPrefix(value, "<"):
+		return true
+	case strings.HasPrefix(lower, "your"), strings.HasPrefix(lower, "change"), strings.Contains(lower, "example"),
+		strings.Contains(lower, "placeholder"), strings.Contains(lower, "redacted"):
+		return true
+	case strings.Trim(lower, "x*.-") == "":
+		return true
+	}
+	return false
+}
+
+// looksRandom reports whether a token mixes upper case letters, lower case
+// letters and digits with high entropy
+func looksRandom(token string) bool {
+	var upper, lower, digit bool
+	counts := make(map[rune]int)
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		counts[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(token))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minTokenEntropy
+}
+
+// preview masks all but the first four characters of a secret, and all of
+// a short one
+func preview(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	masked := len(secret) - 4
+	if masked > 12 {
+		masked = 12
+	}
+	return secret[:4] + strings.Repeat("*", masked)
+}
+
+// Redact copies r to w with every secret found by Scan replaced by Mask.
+// The findings must come from scanning the same data.
+func Redact(w io.Writer, r io.Reader, findings []Finding) error {
+	var offset int64
+	for _, f := range findings {
+		if f.Start < offset {
+			continue
+		}
+		if _, err := io.CopyN(w, r, f.Start-offset); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, r, f.End-f.Start); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, Mask); err != nil {
+			return err
+		}
+		offset = f.End
+	}
+	_, err := io.Copy(w, r)
+	return err
+}